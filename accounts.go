@@ -0,0 +1,131 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+// Multi-user mode: when lush runs as root it can serve several people, each
+// with their own login. Commands run as the Unix account of whoever is master.
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hraban/httpauth"
+	"github.com/hraban/lush/liblush"
+)
+
+type lushUser struct {
+	password string
+	// name of the Unix account to run commands as
+	account string
+}
+
+// Parse a users file. One user per line: name:password[:account], where
+// account defaults to name. Empty lines and lines starting with # are
+// ignored. Passwords can't contain colons, sorry.
+func parseUsersFile(fname string) (map[string]lushUser, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	users := map[string]lushUser{}
+	scanner := bufio.NewScanner(f)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) < 2 || len(fields) > 3 || fields[0] == "" || fields[1] == "" {
+			return nil, fmt.Errorf("%s:%d: expected name:password[:account]", fname, lineno)
+		}
+		u := lushUser{password: fields[1], account: fields[0]}
+		if len(fields) == 3 && fields[2] != "" {
+			u.account = fields[2]
+		}
+		users[fields[0]] = u
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("%s: no users", fname)
+	}
+	return users, nil
+}
+
+// Like SetPassword but for multiple users. Can only be called once, and not
+// in combination with SetPassword.
+func (s *server) SetUsers(users map[string]lushUser) {
+	if s.password != "" || s.users != nil {
+		panic("Authentication can only be set once")
+	}
+	if len(users) == 0 {
+		panic("Need at least one user")
+	}
+	s.users = users
+	s.httpHandler = httpauth.Basic("lush", s.httpHandler, func(user, pass string) bool {
+		u, ok := users[user]
+		return ok && u.password == pass
+	})
+}
+
+// Make the session run commands as the account of the user who sent this
+// request. Once bound the session belongs to that account: requests from
+// other users are refused.
+func (s *server) bindAccount(r *http.Request) error {
+	if s.users == nil {
+		// single user mode: everything runs as us
+		return nil
+	}
+	name, _, _ := r.BasicAuth()
+	u, ok := s.users[name]
+	if !ok {
+		// authentication middleware should have caught this
+		return errors.New("unknown user " + name)
+	}
+	s.accountlock.Lock()
+	defer s.accountlock.Unlock()
+	if a := s.session.Account(); a != nil {
+		if a.Name != u.account {
+			return fmt.Errorf("session belongs to %s, not %s", a.Name, u.account)
+		}
+		return nil
+	}
+	a, err := liblush.LookupAccount(u.account)
+	if err != nil {
+		return fmt.Errorf("couldn't find account for %s: %v", name, err)
+	}
+	s.session.SetAccount(a)
+	log.Printf("Running commands as %s (uid %d) for %s", a.Name, a.Uid, name)
+	s.openHomeFiles(a)
+	return nil
+}
+
+// use the files in the home dir of the account the session was just bound
+// to, rather than those of the user running the server
+func (s *server) openHomeFiles(a *liblush.Account) {
+	if s.homeHistory {
+		err := s.history.Open(filepath.Join(a.Home, historyFileName), a)
+		if err != nil {
+			log.Printf("Failed to load history of %s: %v", a.Name, err)
+		}
+	}
+	if s.homeAliases {
+		err := s.OpenAliases(filepath.Join(a.Home, aliasFileName), a)
+		if err != nil {
+			log.Printf("Failed to load aliases of %s: %v", a.Name, err)
+		}
+	}
+	if s.homeRc {
+		s.LoadRc(filepath.Join(a.Home, ".lushrc"))
+	}
+}
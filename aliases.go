@@ -0,0 +1,79 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+// Persistence of the session aliases (see liblush/alias.go), as a JSON object
+// mapping names to templates.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/hraban/lush/liblush"
+)
+
+// Load aliases from a file into the session and save them there after every
+// change. A non-existing file is fine, it's created on the first change. The
+// file belongs to owner, or to us if nil.
+func (s *server) OpenAliases(fname string, owner *liblush.Account) error {
+	s.aliaslock.Lock()
+	defer s.aliaslock.Unlock()
+	f, err := openOwnedFile(fname, os.O_RDONLY, owner)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		data, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		var aliases map[string][]string
+		err = json.Unmarshal(data, &aliases)
+		if err != nil {
+			return fmt.Errorf("corrupt alias file %s: %v", fname, err)
+		}
+		for name, template := range aliases {
+			err = s.session.SetAlias(name, template)
+			if err != nil {
+				return fmt.Errorf("alias file %s: %v", fname, err)
+			}
+		}
+	}
+	s.aliasfile = fname
+	s.aliasowner = owner
+	return nil
+}
+
+// write all aliases to the alias file, if any
+func (s *server) saveAliases() {
+	s.aliaslock.Lock()
+	defer s.aliaslock.Unlock()
+	if s.aliasfile == "" {
+		return
+	}
+	data, err := json.Marshal(s.session.Aliases())
+	if err == nil {
+		err = writeFileAtomic(s.aliasfile, data, s.aliasowner)
+	}
+	if err != nil {
+		log.Print("Failed to save aliases: ", err)
+	}
+}
+
+// ~/.lush_aliases, or nothing if we don't know where home is
+func defaultAliasFile() string {
+	home := os.Getenv("HOME")
+	if home == "" {
+		return ""
+	}
+	return filepath.Join(home, aliasFileName)
+}
+
+const aliasFileName = ".lush_aliases"
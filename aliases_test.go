@@ -0,0 +1,92 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hraban/lush/liblush"
+)
+
+func TestAliasFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lush-aliases")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "aliases")
+	s := newServer()
+	var events bytes.Buffer
+	s.ctrlclients.AddWriter(&events)
+	err = s.OpenAliases(fname, nil)
+	if err != nil {
+		t.Fatal("Opening non-existing alias file failed:", err)
+	}
+	err = wseventSetalias(s, `{"name":"gco","template":["git","checkout","$1"]}`)
+	if err != nil {
+		t.Fatal("setalias failed:", err)
+	}
+	wseventSetalias(s, `{"name":"ll","template":["ls","-l"]}`)
+	err = wseventDelalias(s, "ll")
+	if err != nil {
+		t.Fatal("delalias failed:", err)
+	}
+	if wseventDelalias(s, "ll") == nil {
+		t.Error("expected error deleting non-existing alias")
+	}
+	const expected = `alias;{"name":"gco","template":["git","checkout","$1"]}` +
+		`alias;{"name":"ll","template":["ls","-l"]}` +
+		`alias_deleted;ll`
+	if events.String() != expected {
+		t.Errorf("Expected events %q, got %q", expected, events.String())
+	}
+	s2 := newServer()
+	err = s2.OpenAliases(fname, nil)
+	if err != nil {
+		t.Fatal("Reopening alias file failed:", err)
+	}
+	aliases := s2.session.Aliases()
+	if len(aliases) != 1 || len(aliases["gco"]) != 3 {
+		t.Errorf("Unexpected aliases after reload: %v", aliases)
+	}
+}
+
+// with -users the aliases and history live in the home dir of the account
+func TestHomeFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lush-aliases")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, aliasFileName)
+	err = ioutil.WriteFile(fname, []byte(`{"ll":["ls","-l"]}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newServer()
+	s.homeAliases = true
+	s.homeHistory = true
+	s.openHomeFiles(&liblush.Account{Name: "someone", Home: dir})
+	if aliases := s.session.Aliases(); len(aliases["ll"]) != 2 {
+		t.Errorf("Aliases not loaded from home dir: %v", aliases)
+	}
+	err = wseventSetalias(s, `{"name":"gco","template":["git","checkout"]}`)
+	if err != nil {
+		t.Fatal("setalias failed:", err)
+	}
+	data, _ := ioutil.ReadFile(fname)
+	if !bytes.Contains(data, []byte(`"gco"`)) {
+		t.Errorf("Alias not saved in home dir: %s", data)
+	}
+	s.history.Add([]string{"ls"}, dir, time.Now())
+	if _, err := os.Stat(filepath.Join(dir, historyFileName)); err != nil {
+		t.Errorf("History not saved in home dir: %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+// lush client: drive a running lush server from the command line.
+//
+//     lush client [-url http://localhost:8081] [-user lush] [-p password]
+//                 [-insecure] command [args]
+//
+// The password can also be set through $LUSH_PASSWORD, to keep it out of ps.
+// Commands:
+//
+//     list                       all commands: id, status, argv
+//     new [-name N] [-start] [-attach] cmd [arg...]
+//                                create a command and print its id
+//     start ID
+//     attach ID                  stream stdout and stderr here and send stdin
+//                                there until it exits, then exit like it
+//     stop ID                    walk the stop sequence
+//     signal ID SIGNAL           eg SIGINT
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/hraban/lush/liblush"
+	"github.com/hraban/lush/lushclient"
+)
+
+func clientUsage(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintln(os.Stderr, `usage: lush client [options] command [args]
+
+commands:
+  list
+  new [-name N] [-start] [-attach] cmd [arg...]
+  start ID
+  attach ID
+  stop ID
+  signal ID SIGNAL
+
+options:`)
+		fs.PrintDefaults()
+	}
+}
+
+func parseClientCmdId(args []string, n int) (liblush.CmdId, error) {
+	if len(args) != n {
+		return 0, errors.New("wrong number of arguments")
+	}
+	return liblush.ParseCmdId(args[0])
+}
+
+// exit code of the client for a command with this status
+func statusExitCode(status lushclient.Status) int {
+	if status.Success() {
+		return 0
+	}
+	return 1
+}
+
+// attach to a command, return the exit code for the client
+func clientAttach(c *lushclient.Conn, id liblush.CmdId) (int, error) {
+	status, err := c.Attach(id, os.Stdin, os.Stdout, os.Stderr)
+	if err != nil {
+		return 1, err
+	}
+	if status.Err != "" {
+		fmt.Fprintln(os.Stderr, "lush client:", status.Err)
+	}
+	return statusExitCode(status), nil
+}
+
+// entry point of lush client, returns the exit code
+func clientMain(args []string) int {
+	fs := flag.NewFlagSet("lush client", flag.ContinueOnError)
+	fs.Usage = clientUsage(fs)
+	rawurl := fs.String("url", "http://localhost:8081", "lush server")
+	user := fs.String("user", "lush", "user name")
+	pass := fs.String("p", os.Getenv("LUSH_PASSWORD"), "password (default $LUSH_PASSWORD)")
+	insecure := fs.Bool("insecure", false, "don't verify the TLS certificate of the server")
+	if fs.Parse(args) != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	c, err := lushclient.Dial(*rawurl, &lushclient.Options{
+		User:      *user,
+		Password:  *pass,
+		TLSConfig: &tls.Config{InsecureSkipVerify: *insecure},
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "lush client:", err)
+		return 1
+	}
+	defer c.Close()
+	code, err := runClientCommand(c, fs.Arg(0), fs.Args()[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lush client: %s: %v\n", fs.Arg(0), err)
+		if code == 0 {
+			code = 1
+		}
+	}
+	return code
+}
+
+func runClientCommand(c *lushclient.Conn, name string, args []string) (int, error) {
+	switch name {
+	case "list":
+		mds, err := c.List()
+		if err != nil {
+			return 1, err
+		}
+		sort.Slice(mds, func(i, j int) bool { return mds[i].Id < mds[j].Id })
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSTATUS\tCOMMAND")
+		for _, md := range mds {
+			fmt.Fprintf(w, "%d\t%s\t%s\n", md.Id, md.Status,
+				strings.Join(append([]string{md.Cmd}, md.Args...), " "))
+		}
+		return 0, w.Flush()
+	case "new":
+		fs := flag.NewFlagSet("new", flag.ContinueOnError)
+		cmdname := fs.String("name", "", "name of the command")
+		start := fs.Bool("start", false, "start it right away")
+		attach := fs.Bool("attach", false, "start it and attach to it")
+		if fs.Parse(args) != nil {
+			return 2, nil
+		}
+		if fs.NArg() == 0 {
+			return 2, errors.New("no command given")
+		}
+		md, err := c.New(lushclient.NewOptions{
+			Cmd:  fs.Arg(0),
+			Args: fs.Args()[1:],
+			Name: *cmdname,
+		})
+		if err != nil {
+			return 1, err
+		}
+		if !*attach {
+			fmt.Println(md.Id)
+		}
+		if *start || *attach {
+			err = c.Start(md.Id)
+			if err != nil {
+				return 1, err
+			}
+		}
+		if *attach {
+			return clientAttach(c, md.Id)
+		}
+		return 0, nil
+	case "start", "stop":
+		id, err := parseClientCmdId(args, 1)
+		if err != nil {
+			return 2, err
+		}
+		if name == "start" {
+			return 0, c.Start(id)
+		}
+		return 0, c.Stop(id)
+	case "attach":
+		id, err := parseClientCmdId(args, 1)
+		if err != nil {
+			return 2, err
+		}
+		return clientAttach(c, id)
+	case "signal":
+		id, err := parseClientCmdId(args, 2)
+		if err != nil {
+			return 2, err
+		}
+		return 0, c.Signal(id, args[1])
+	}
+	return 2, errors.New("unknown command")
+}
@@ -138,12 +138,7 @@ function processCmd(options, callback?: (c: Command.Command) => {}) {
     if (!$.isPlainObject(options.userdata)) {
         options.userdata = {};
     }
-    if (!options.hasOwnProperty('stdoutScrollback')) {
-        options.stdoutScrollback = 1000;
-    }
-    if (!options.hasOwnProperty('stderrScrollback')) {
-        options.stderrScrollback = 1000;
-    }
+    // no scrollback sizes: the server has defaults (see the rc file)
     options.userdata.god = globals.moi;
     if (callback !== undefined) {
         // subscribe to the "newcmdcallback" event in a unique namespace. every
@@ -0,0 +1,86 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/hraban/lush/lushclient"
+)
+
+// the client library against a real server
+func TestClient(t *testing.T) {
+	if _, err := exec.LookPath("cat"); err != nil {
+		t.Skip("no cat in PATH")
+	}
+	s := newServer()
+	s.SetPassword("secret")
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	if c, err := lushclient.Dial(ts.URL, &lushclient.Options{Password: "wrong"}); err == nil {
+		c.Close()
+		t.Fatal("connected with the wrong password")
+	}
+	c := connectClient(t, ts, &lushclient.Options{Password: "secret"})
+	defer c.Close()
+	md, err := c.New(lushclient.NewOptions{Cmd: "cat", Name: "kitty"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := md.Id
+	if md.Name != "kitty" || md.Status.Code != 0 {
+		t.Errorf("Unexpected new command: %#v", md)
+	}
+	err = c.SetProp(id, "name", "tiger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var name string
+	err = c.GetProp(id, "name", &name)
+	if err != nil || name != "tiger" {
+		t.Errorf("Expected name tiger, got %q (%v)", name, err)
+	}
+	err = c.Start(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Start(id)
+	if _, ok := err.(*lushclient.ErrorEvent); !ok {
+		t.Errorf("Expected an error event starting a command twice, got %v", err)
+	}
+	// twice, like the browser and Attach both do: no duplicate output
+	err = c.Subscribe(id, "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	status, err := c.Attach(id, strings.NewReader("hello\nworld\n"), &stdout, &stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Success() || stdout.String() != "hello\nworld\n" || stderr.Len() != 0 {
+		t.Errorf("attach: %v, stdout %q, stderr %q", status, stdout.String(), stderr.String())
+	}
+	// exited already: writes the scrollback
+	stdout.Reset()
+	status, err = c.Attach(id, nil, &stdout, &stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Success() || stdout.String() != "hello\nworld\n" {
+		t.Errorf("attach after exit: %v, stdout %q", status, stdout.String())
+	}
+	mds, err := c.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mds) != 1 || mds[0].Id != id || mds[0].Status.String() != "done" {
+		t.Errorf("unexpected list: %#v", mds)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Candidates for the arguments of a specific command. args are the words
+// before the one being completed, starting with the command itself. Filtering
+// by word is optional, the caller takes care of that.
+type argCompleter func(args []string, word, cwd string) []completion
+
+// by command name
+var argCompleters = map[string]argCompleter{
+	"git":  completeGit,
+	"make": completeMake,
+}
+
+// subcommands to complete. git itself isn't asked: it could be anything the
+// master put in PATH, it runs hooks and commands from the repository config,
+// and with -users we're root.
+var gitCommands = []string{
+	"add", "bisect", "branch", "checkout", "cherry-pick", "clean", "clone",
+	"commit", "config", "diff", "fetch", "grep", "init", "log", "merge", "mv",
+	"pull", "push", "rebase", "remote", "reset", "restore", "revert", "rm",
+	"show", "stash", "status", "switch", "tag",
+}
+
+// the git dir of the repository containing dir, "" if none. a .git file
+// (worktrees, submodules) points to it.
+func findGitDir(dir string) string {
+	for {
+		gitdir := filepath.Join(dir, ".git")
+		fi, err := os.Stat(gitdir)
+		if err == nil && fi.IsDir() {
+			return gitdir
+		}
+		if err == nil {
+			data, _ := ioutil.ReadFile(gitdir)
+			line := strings.TrimSpace(string(data))
+			if !strings.HasPrefix(line, "gitdir: ") {
+				return ""
+			}
+			gitdir = strings.TrimPrefix(line, "gitdir: ")
+			if !filepath.IsAbs(gitdir) {
+				gitdir = filepath.Join(dir, gitdir)
+			}
+			return gitdir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// short names of the branches and tags in a git dir, read from the files
+// like git for-each-ref would
+func gitRefs(gitdir string) []string {
+	// a worktree keeps its refs in the main repository
+	if data, err := ioutil.ReadFile(filepath.Join(gitdir, "commondir")); err == nil {
+		common := strings.TrimSpace(string(data))
+		if !filepath.IsAbs(common) {
+			common = filepath.Join(gitdir, common)
+		}
+		gitdir = common
+	}
+	refs := map[string]bool{}
+	for _, prefix := range []string{"refs/heads/", "refs/tags/"} {
+		root := filepath.Join(gitdir, filepath.FromSlash(prefix))
+		filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+			if err == nil && fi.Mode().IsRegular() {
+				rel, _ := filepath.Rel(root, path)
+				refs[prefix+filepath.ToSlash(rel)] = true
+			}
+			return nil
+		})
+	}
+	// lines of "<sha> <ref>", and "^<sha>" for the commit of a tag
+	if f, err := os.Open(filepath.Join(gitdir, "packed-refs")); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) == 2 && !strings.HasPrefix(fields[0], "^") &&
+				(strings.HasPrefix(fields[1], "refs/heads/") || strings.HasPrefix(fields[1], "refs/tags/")) {
+				refs[fields[1]] = true
+			}
+		}
+		f.Close()
+	}
+	var names []string
+	for ref := range refs {
+		names = append(names, ref)
+	}
+	sort.Strings(names)
+	for i, ref := range names {
+		names[i] = strings.SplitN(ref, "/", 3)[2]
+	}
+	return names
+}
+
+func completeGit(args []string, word, cwd string) []completion {
+	var names []string
+	var typ string
+	if len(args) == 1 {
+		typ = "subcommand"
+		names = gitCommands
+	} else {
+		switch args[1] {
+		case "checkout", "switch", "merge", "rebase", "branch", "log", "diff",
+			"reset", "cherry-pick", "show":
+			typ = "branch"
+			if gitdir := findGitDir(cwd); gitdir != "" {
+				names = gitRefs(gitdir)
+			}
+		}
+	}
+	comps := make([]completion, len(names))
+	for i, name := range names {
+		comps[i] = completion{name, typ}
+	}
+	return comps
+}
+
+// lines like "foo bar: baz", but not variable assignments like "foo := bar"
+var makeRuleRegexp = regexp.MustCompile(`^([^\s:#=][^:#=]*):($|[^=])`)
+
+// explicit targets defined in a makefile. no includes, no variables, no
+// pattern rules.
+func makeTargets(fname string) []string {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var targets []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		m := makeRuleRegexp.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		for _, t := range strings.Fields(m[1]) {
+			// .PHONY and friends
+			if strings.HasPrefix(t, ".") || strings.ContainsAny(t, "%$") {
+				continue
+			}
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
+
+func completeMake(args []string, word, cwd string) []completion {
+	fname := ""
+	for i, arg := range args {
+		if arg == "-f" && i+1 < len(args) {
+			fname = args[i+1]
+		}
+	}
+	if fname == "" {
+		// same order as GNU make
+		for _, name := range []string{"GNUmakefile", "makefile", "Makefile"} {
+			if _, err := os.Stat(filepath.Join(cwd, name)); err == nil {
+				fname = name
+				break
+			}
+		}
+	}
+	if fname == "" {
+		return nil
+	}
+	if !filepath.IsAbs(fname) {
+		fname = filepath.Join(cwd, fname)
+	}
+	var comps []completion
+	for _, t := range makeTargets(fname) {
+		comps = append(comps, completion{t, "target"})
+	}
+	return comps
+}
@@ -0,0 +1,265 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+// Tab completion of command lines. The interesting part is in complete(),
+// per-command completers live in completers.go.
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hraban/lush/liblush"
+)
+
+type completion struct {
+	// replacement for the entire word being completed
+	Text string `json:"text"`
+	// builtin, command, dir, file, executable, or whatever a command
+	// completer says (eg subcommand, branch, target)
+	Type string `json:"type"`
+}
+
+// Executables in PATH, by directory. Directories are read once and then kept
+// up to date by watching them, because reading all of PATH on every keystroke
+// is slow.
+type execIndex struct {
+	lock    sync.Mutex
+	dirs    map[string][]string
+	watcher *fsWatcher
+	// watching failed: don't cache
+	nowatch bool
+}
+
+func newExecIndex() *execIndex {
+	return &execIndex{dirs: map[string][]string{}}
+}
+
+// path is a changed entry in an indexed dir, or the dir itself
+func (x *execIndex) invalidate(path string) {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	delete(x.dirs, filepath.Dir(path))
+	delete(x.dirs, path)
+}
+
+func readExecutables(dir string) []string {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		// ignore unreadable dirs
+		return nil
+	}
+	var names []string
+	for _, fi := range fis {
+		if fi.Mode()&os.ModeSymlink != 0 {
+			fi, err = os.Stat(filepath.Join(dir, fi.Name()))
+			if err != nil {
+				continue
+			}
+		}
+		if isExecutable(fi) {
+			names = append(names, fi.Name())
+		}
+	}
+	return names
+}
+
+// caller must hold the lock
+func (x *execIndex) dir(dir string) []string {
+	if names, ok := x.dirs[dir]; ok {
+		return names
+	}
+	if x.watcher == nil && !x.nowatch {
+		var err error
+		x.watcher, err = newFsWatcher(x.invalidate)
+		if err != nil {
+			log.Print("Not caching executables, failed to watch PATH: ", err)
+			x.nowatch = true
+		}
+	}
+	// watch before reading so no change goes unnoticed
+	cache := !x.nowatch && x.watcher.Add(dir) == nil
+	names := readExecutables(dir)
+	if cache {
+		x.dirs[dir] = names
+	}
+	return names
+}
+
+// Names of all executables in these dirs starting with prefix, without
+// duplicates
+func (x *execIndex) Complete(dirs []string, prefix string) []string {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	seen := map[string]bool{}
+	var names []string
+	for _, d := range dirs {
+		if d == "" {
+			continue
+		}
+		for _, name := range x.dir(d) {
+			if !seen[name] && strings.HasPrefix(name, prefix) {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// Split a partial command line in the finished words and the word being
+// completed (which is empty if the line ends in whitespace). No quoting, yet.
+func splitCmdline(line string) (args []string, word string) {
+	args = strings.Fields(line)
+	if len(args) == 0 || strings.TrimRight(line, " \t") != line {
+		return args, ""
+	}
+	return args[:len(args)-1], args[len(args)-1]
+}
+
+// home directory of the named user, or of the session if name is empty
+func homeDir(s *server, name string) string {
+	if name != "" {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return ""
+		}
+		return u.HomeDir
+	}
+	if a := s.session.Account(); a != nil {
+		return a.Home
+	}
+	return os.Getenv("HOME")
+}
+
+// Complete word as a path, relative to cwd. Hidden files are only included if
+// the word's last component starts with a dot.
+func completePath(s *server, word, cwd string) []completion {
+	i := strings.LastIndex(word, "/")
+	dir, prefix := word[:i+1], word[i+1:]
+	lookdir := dir
+	if strings.HasPrefix(dir, "~") {
+		// ~/foo or ~user/foo
+		slash := strings.Index(dir, "/")
+		home := homeDir(s, dir[1:slash])
+		if home == "" {
+			return nil
+		}
+		lookdir = home + dir[slash:]
+	}
+	if !filepath.IsAbs(lookdir) {
+		lookdir = filepath.Join(cwd, lookdir)
+	}
+	fis, err := ioutil.ReadDir(lookdir)
+	if err != nil {
+		return nil
+	}
+	var comps []completion
+	for _, fi := range fis {
+		name := fi.Name()
+		if strings.HasPrefix(name, ".") && !strings.HasPrefix(prefix, ".") {
+			continue
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if target, err := os.Stat(filepath.Join(lookdir, name)); err == nil {
+				fi = target
+			}
+		}
+		c := completion{Text: dir + name, Type: "file"}
+		switch {
+		case fi.IsDir():
+			c.Text += "/"
+			c.Type = "dir"
+		case isExecutable(fi):
+			c.Type = "executable"
+		}
+		comps = append(comps, c)
+	}
+	return comps
+}
+
+// Keep the candidates that complete word and sort them: exact matches, then
+// prefix matches, then case insensitive prefix matches. Within those, earlier
+// sources go first and then it's alphabetical. Duplicates are removed,
+// earliest source wins.
+func rankCompletions(word string, sources ...[]completion) []completion {
+	type ranked struct {
+		completion
+		rank, source int
+	}
+	var all []ranked
+	seen := map[string]bool{}
+	lword := strings.ToLower(word)
+	for i, source := range sources {
+		for _, c := range source {
+			if seen[c.Text] {
+				continue
+			}
+			r := ranked{c, 0, i}
+			switch {
+			case c.Text == word:
+				r.rank = 0
+			case strings.HasPrefix(c.Text, word):
+				r.rank = 1
+			case strings.HasPrefix(strings.ToLower(c.Text), lword):
+				r.rank = 2
+			default:
+				continue
+			}
+			seen[c.Text] = true
+			all = append(all, r)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		a, b := all[i], all[j]
+		if a.rank != b.rank {
+			return a.rank < b.rank
+		}
+		if a.source != b.source {
+			return a.source < b.source
+		}
+		return a.Text < b.Text
+	})
+	comps := make([]completion, len(all))
+	for i, r := range all {
+		comps[i] = r.completion
+	}
+	return comps
+}
+
+// All completions for the last word of a partial command line, best first
+func complete(s *server, line string) []completion {
+	args, word := splitCmdline(line)
+	cwd, err := os.Getwd()
+	if err != nil {
+		cwd = "/"
+	}
+	var sources [][]completion
+	if len(args) == 0 && !strings.ContainsRune(word, '/') && !strings.HasPrefix(word, "~") {
+		var cmds []completion
+		for _, name := range liblush.BuiltinNames() {
+			cmds = append(cmds, completion{name, "builtin"})
+		}
+		// no prefix: case insensitive matches are welcome too
+		for _, name := range s.execIndex.Complete(getPath(), "") {
+			cmds = append(cmds, completion{name, "command"})
+		}
+		sources = append(sources, cmds)
+	} else {
+		if len(args) > 0 {
+			if f := argCompleters[filepath.Base(args[0])]; f != nil {
+				sources = append(sources, f(args, word, cwd))
+			}
+		}
+		sources = append(sources, completePath(s, word, cwd))
+	}
+	return rankCompletions(word, sources...)
+}
@@ -0,0 +1,170 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestSplitCmdline(t *testing.T) {
+	for _, c := range []struct {
+		line, word string
+		args       []string
+	}{
+		{"", "", nil},
+		{"gi", "gi", nil},
+		{"git ", "", []string{"git"}},
+		{"git  che", "che", []string{"git"}},
+	} {
+		args, word := splitCmdline(c.line)
+		if word != c.word || len(args) != len(c.args) ||
+			(len(args) > 0 && !reflect.DeepEqual(args, c.args)) {
+			t.Errorf("splitCmdline(%q) = %q, %q", c.line, args, word)
+		}
+	}
+}
+
+func TestRankCompletions(t *testing.T) {
+	comps := rankCompletions("fo",
+		[]completion{{"foo", "a"}, {"Fob", "a"}, {"bar", "a"}},
+		[]completion{{"fo", "b"}, {"foo", "b"}, {"fa", "b"}, {"fob", "b"}})
+	expected := []completion{{"fo", "b"}, {"foo", "a"}, {"fob", "b"}, {"Fob", "a"}}
+	if !reflect.DeepEqual(comps, expected) {
+		t.Errorf("Expected %v, got %v", expected, comps)
+	}
+}
+
+func TestCompletePath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no executable bits on windows")
+	}
+	dir, err := ioutil.TempDir("", "lush-complete")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "sub", "file"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "sub", "run"), nil, 0755)
+	ioutil.WriteFile(filepath.Join(dir, "sub", ".hidden"), nil, 0644)
+	s := newServer()
+	comps := rankCompletions("sub/", completePath(s, "sub/", dir))
+	expected := []completion{{"sub/file", "file"}, {"sub/run", "executable"}}
+	if !reflect.DeepEqual(comps, expected) {
+		t.Errorf("Expected %v, got %v", expected, comps)
+	}
+	comps = rankCompletions("sub/.", completePath(s, "sub/.", dir))
+	if len(comps) != 1 || comps[0].Text != "sub/.hidden" {
+		t.Errorf("Expected only hidden file, got %v", comps)
+	}
+	comps = rankCompletions("s", completePath(s, "s", dir))
+	if len(comps) != 1 || comps[0] != (completion{"sub/", "dir"}) {
+		t.Errorf("Expected dir completion, got %v", comps)
+	}
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", dir)
+	comps = rankCompletions("~/sub/f", completePath(s, "~/sub/f", "/"))
+	if len(comps) != 1 || comps[0].Text != "~/sub/file" {
+		t.Errorf("Expected completion in home dir, got %v", comps)
+	}
+}
+
+func TestMakeTargets(t *testing.T) {
+	f, err := ioutil.TempFile("", "lush-makefile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`CC := gcc
+.PHONY: all clean
+all: lush
+lush test: $(SRC)
+	go build
+%.o: %.c
+clean:
+`)
+	f.Close()
+	targets := makeTargets(f.Name())
+	expected := []string{"all", "lush", "test", "clean"}
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("Expected targets %q, got %q", expected, targets)
+	}
+}
+
+func TestExecIndex(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no executable bits on windows")
+	}
+	dir, err := ioutil.TempDir("", "lush-path")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "lushfoo"), nil, 0755)
+	ioutil.WriteFile(filepath.Join(dir, "lushdata"), nil, 0644)
+	x := newExecIndex()
+	names := x.Complete([]string{dir}, "lush")
+	if !reflect.DeepEqual(names, []string{"lushfoo"}) {
+		t.Fatalf("Expected only lushfoo, got %q", names)
+	}
+	// the index must notice new executables by itself
+	ioutil.WriteFile(filepath.Join(dir, "lushbar"), nil, 0755)
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		names = x.Complete([]string{dir}, "lush")
+		if len(names) == 2 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("New executable not picked up: %q", names)
+}
+
+func TestCompleteGit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lush-complete")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	gitdir := filepath.Join(dir, "repo", ".git")
+	for _, ref := range []string{"heads/master", "heads/feature/x", "tags/v1"} {
+		fname := filepath.Join(gitdir, "refs", filepath.FromSlash(ref))
+		os.MkdirAll(filepath.Dir(fname), 0755)
+		ioutil.WriteFile(fname, []byte("0123abcd\n"), 0644)
+	}
+	ioutil.WriteFile(filepath.Join(gitdir, "packed-refs"), []byte(
+		"# pack-refs with: peeled fully-peeled sorted\n"+
+			"0123abcd refs/heads/master\n"+
+			"0123abcd refs/heads/old\n"+
+			"0123abcd refs/remotes/origin/master\n"+
+			"0123abcd refs/tags/v0\n"+
+			"^4567abcd\n"), 0644)
+	// a worktree elsewhere, with its own git dir pointing to the common one
+	wtgitdir := filepath.Join(gitdir, "worktrees", "wt")
+	os.MkdirAll(wtgitdir, 0755)
+	ioutil.WriteFile(filepath.Join(wtgitdir, "commondir"), []byte("../..\n"), 0644)
+	os.MkdirAll(filepath.Join(dir, "wt", "sub"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "wt", ".git"), []byte("gitdir: "+wtgitdir+"\n"), 0644)
+	os.MkdirAll(filepath.Join(dir, "repo", "sub"), 0755)
+	expected := []completion{
+		{"feature/x", "branch"}, {"master", "branch"}, {"old", "branch"},
+		{"v0", "branch"}, {"v1", "branch"},
+	}
+	for _, cwd := range []string{"repo/sub", "wt/sub"} {
+		comps := completeGit([]string{"git", "checkout"}, "", filepath.Join(dir, cwd))
+		if !reflect.DeepEqual(comps, expected) {
+			t.Errorf("%s: expected %v, got %v", cwd, expected, comps)
+		}
+	}
+	if comps := completeGit([]string{"git", "checkout"}, "", dir); len(comps) != 0 {
+		t.Errorf("Expected no refs outside a repository, got %v", comps)
+	}
+}
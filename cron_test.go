@@ -0,0 +1,70 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// a wednesday
+	now := time.Date(2016, 3, 2, 10, 17, 30, 0, time.UTC)
+	for _, tc := range []struct {
+		expr, next string
+	}{
+		{"* * * * *", "2016-03-02 10:18"},
+		{"*/15 * * * *", "2016-03-02 10:30"},
+		{"0 * * * *", "2016-03-02 11:00"},
+		{"5,10 9-11 * * *", "2016-03-02 11:05"},
+		{"0 0 * * *", "2016-03-03 00:00"},
+		{"@daily", "2016-03-03 00:00"},
+		{"@weekly", "2016-03-06 00:00"},
+		{"30 8 * * 7", "2016-03-06 08:30"},
+		{"0 12 * * 1-5", "2016-03-02 12:00"},
+		{"0 0 1 * *", "2016-04-01 00:00"},
+		{"@yearly", "2017-01-01 00:00"},
+		// either day field when both are restricted
+		{"0 0 15 * 5", "2016-03-04 00:00"},
+		{"0 0 29 2 *", "2020-02-29 00:00"},
+		{"0 0 30 2 *", ""},
+		{"@every 90s", "2016-03-02 10:19"},
+	} {
+		sched, err := parseCron(tc.expr)
+		if err != nil {
+			t.Errorf("%q: %v", tc.expr, err)
+			continue
+		}
+		next := sched.Next(now)
+		var got string
+		if !next.IsZero() {
+			got = next.Format("2006-01-02 15:04")
+		}
+		if got != tc.next {
+			t.Errorf("%q: expected %q, got %q", tc.expr, tc.next, got)
+		}
+	}
+}
+
+func TestCronInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"@every 1ms",
+		"@every soon",
+	} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("%q: expected error", expr)
+		}
+	}
+}
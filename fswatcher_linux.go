@@ -0,0 +1,121 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const fsWatchMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM |
+	syscall.IN_MOVED_TO | syscall.IN_ATTRIB | syscall.IN_CLOSE_WRITE |
+	syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// Calls a function for every change to the entries of a set of directories.
+// Not recursive. Uses inotify.
+type fsWatcher struct {
+	f        *os.File
+	fd       int
+	lock     sync.Mutex
+	dirs     map[int32]string
+	wds      map[string]int32
+	closed   bool
+	onchange func(path string)
+}
+
+// onchange is called from a separate goroutine with the full path of the
+// changed entry, or of the watched directory itself if that went away.
+func newFsWatcher(onchange func(path string)) (*fsWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	w := &fsWatcher{
+		f:        os.NewFile(uintptr(fd), "inotify"),
+		fd:       fd,
+		dirs:     map[int32]string{},
+		wds:      map[string]int32{},
+		onchange: onchange,
+	}
+	go w.run()
+	return w, nil
+}
+
+func (w *fsWatcher) Add(dir string) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if _, ok := w.wds[dir]; ok {
+		return nil
+	}
+	wd, err := syscall.InotifyAddWatch(w.fd, dir, fsWatchMask)
+	if err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+	}
+	w.dirs[int32(wd)] = dir
+	w.wds[dir] = int32(wd)
+	return nil
+}
+
+func (w *fsWatcher) Remove(dir string) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	wd, ok := w.wds[dir]
+	if !ok {
+		return nil
+	}
+	delete(w.wds, dir)
+	delete(w.dirs, wd)
+	_, err := syscall.InotifyRmWatch(w.fd, uint32(wd))
+	return err
+}
+
+func (w *fsWatcher) Close() error {
+	w.lock.Lock()
+	w.closed = true
+	w.lock.Unlock()
+	return w.f.Close()
+}
+
+func (w *fsWatcher) run() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.f.Read(buf)
+		if err != nil {
+			w.lock.Lock()
+			closed := w.closed
+			w.lock.Unlock()
+			if !closed {
+				log.Print("Error reading file system events: ", err)
+			}
+			return
+		}
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			nameStart := off + syscall.SizeofInotifyEvent
+			off = nameStart + int(ev.Len)
+			name := strings.TrimRight(string(buf[nameStart:off]), "\x00")
+			w.lock.Lock()
+			dir, ok := w.dirs[ev.Wd]
+			if ok && ev.Mask&syscall.IN_IGNORED != 0 {
+				// watch removed by the kernel, eg because dir was deleted
+				delete(w.dirs, ev.Wd)
+				delete(w.wds, dir)
+			}
+			w.lock.Unlock()
+			if !ok {
+				continue
+			}
+			if name != "" {
+				dir = filepath.Join(dir, name)
+			}
+			w.onchange(dir)
+		}
+	}
+}
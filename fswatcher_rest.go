@@ -0,0 +1,119 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+// +build !linux
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const fsPollInterval = 2 * time.Second
+
+// Calls a function for every change to the entries of a set of directories.
+// Not recursive. Polls, for lack of a portable alternative.
+type fsWatcher struct {
+	lock sync.Mutex
+	// last seen modification time and mode of every entry, by directory. nil
+	// for directories that couldn't be read.
+	dirs     map[string]map[string]string
+	done     chan struct{}
+	onchange func(path string)
+}
+
+// onchange is called from a separate goroutine with the full path of the
+// changed entry, or of the watched directory itself if that went away.
+func newFsWatcher(onchange func(path string)) (*fsWatcher, error) {
+	w := &fsWatcher{
+		dirs:     map[string]map[string]string{},
+		done:     make(chan struct{}),
+		onchange: onchange,
+	}
+	go w.run()
+	return w, nil
+}
+
+func snapshotDir(dir string) (map[string]string, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	snap := map[string]string{}
+	for _, fi := range fis {
+		snap[fi.Name()] = fi.ModTime().String() + fi.Mode().String()
+	}
+	return snap, nil
+}
+
+func (w *fsWatcher) Add(dir string) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if _, ok := w.dirs[dir]; ok {
+		return nil
+	}
+	snap, err := snapshotDir(dir)
+	if err != nil {
+		return err
+	}
+	w.dirs[dir] = snap
+	return nil
+}
+
+func (w *fsWatcher) Remove(dir string) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	delete(w.dirs, dir)
+	return nil
+}
+
+func (w *fsWatcher) Close() error {
+	close(w.done)
+	return nil
+}
+
+func (w *fsWatcher) poll() (changed []string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for dir, old := range w.dirs {
+		snap, err := snapshotDir(dir)
+		if err != nil {
+			// stop watching, like inotify does
+			delete(w.dirs, dir)
+			changed = append(changed, dir)
+			continue
+		}
+		for name, stamp := range snap {
+			if old[name] != stamp {
+				changed = append(changed, filepath.Join(dir, name))
+			}
+		}
+		for name := range old {
+			if _, ok := snap[name]; !ok {
+				changed = append(changed, filepath.Join(dir, name))
+			}
+		}
+		w.dirs[dir] = snap
+	}
+	return
+}
+
+func (w *fsWatcher) run() {
+	ticker := time.NewTicker(fsPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			// not under lock: onchange may well call Add or Remove
+			for _, path := range w.poll() {
+				w.onchange(path)
+			}
+		}
+	}
+}
@@ -0,0 +1,307 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hraban/lush/liblush"
+)
+
+// oldest entries are forgotten beyond this
+const maxHistory = 10000
+
+// the history file is rewritten once it has this many more records than twice
+// the number of entries. with a full history that's every maxHistory/2
+// commands or so.
+const compactSlack = 100
+
+type historyEntry struct {
+	Id      int64       `json:"id"`
+	Argv    []string    `json:"argv"`
+	Cwd     string      `json:"cwd"`
+	Started time.Time   `json:"started"`
+	Exited  *time.Time  `json:"exited,omitempty"`
+	Status  *statusJson `json:"status,omitempty"`
+}
+
+func (e *historyEntry) cmdline() string {
+	return strings.Join(e.Argv, " ")
+}
+
+// on-disk format: one record per line, appended on every change. a record
+// replaces the entry with the same id, if any, or deletes it.
+type historyRecord struct {
+	historyEntry
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// Every command line ever started, oldest first. Safe for concurrent use.
+type history struct {
+	lock    sync.Mutex
+	entries []*historyEntry
+	lastid  int64
+	// changes are appended here, if not empty
+	fname string
+	// of the file, nil for us. see openOwnedFile.
+	owner *liblush.Account
+	// lines in the file, see compactSlack
+	records int
+}
+
+// defaults to in-memory until Open is called
+func newHistory() *history {
+	return &history{}
+}
+
+// Load history from a file and save it there from now on. A non-existing file
+// is fine, it's created on the first change. The file belongs to owner, or to
+// us if nil.
+func (h *history) Open(fname string, owner *liblush.Account) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	saved, lastid, records, clean, err := readHistory(fname, owner)
+	if err != nil {
+		return err
+	}
+	// entries recorded before opening come after the saved ones
+	for _, e := range h.entries {
+		lastid++
+		e.Id = lastid
+	}
+	h.entries = append(saved, h.entries...)
+	h.trim()
+	h.lastid = lastid
+	h.fname = fname
+	h.owner = owner
+	h.records = records
+	// a record cut short by a crash would swallow the next one
+	if !clean || len(h.entries) > len(saved) {
+		h.compact()
+	}
+	return nil
+}
+
+// replay the records in a history file. clean is false if the last one was
+// cut short.
+func readHistory(fname string, owner *liblush.Account) (entries []*historyEntry, lastid int64, records int, clean bool, err error) {
+	f, err := openOwnedFile(fname, os.O_RDONLY, owner)
+	if os.IsNotExist(err) {
+		return nil, 0, 0, true, nil
+	}
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	byid := map[int64]*historyEntry{}
+	r := bufio.NewReader(f)
+	for {
+		line, rerr := r.ReadBytes('\n')
+		if rerr == io.EOF && len(line) == 0 {
+			return entries, lastid, records, true, nil
+		}
+		if rerr != nil && rerr != io.EOF {
+			return nil, 0, 0, false, rerr
+		}
+		var rec historyRecord
+		err = json.Unmarshal(line, &rec)
+		if err != nil && rerr == io.EOF {
+			// crashed while appending
+			return entries, lastid, records, false, nil
+		}
+		if err != nil {
+			err = fmt.Errorf("corrupt history file %s, line %d: %v", fname, records+1, err)
+			return nil, 0, 0, false, err
+		}
+		records++
+		if rec.Id > lastid {
+			lastid = rec.Id
+		}
+		e := byid[rec.Id]
+		switch {
+		case rec.Deleted && e != nil:
+			delete(byid, rec.Id)
+			for i := range entries {
+				if entries[i] == e {
+					entries = append(entries[:i], entries[i+1:]...)
+					break
+				}
+			}
+		case rec.Deleted:
+		case e != nil:
+			*e = rec.historyEntry
+		default:
+			e = new(historyEntry)
+			*e = rec.historyEntry
+			byid[e.Id] = e
+			entries = append(entries, e)
+		}
+		if rerr == io.EOF {
+			// complete, but missing its newline
+			return entries, lastid, records, false, nil
+		}
+	}
+}
+
+// forget the oldest entries beyond maxHistory. caller must hold the lock.
+func (h *history) trim() {
+	if len(h.entries) > maxHistory {
+		h.entries = h.entries[len(h.entries)-maxHistory:]
+	}
+}
+
+// append a record to the file, or rewrite it if it's grown too much. the
+// change must already be applied. caller must hold the lock.
+func (h *history) write(rec historyRecord) {
+	if h.fname == "" {
+		return
+	}
+	if h.records >= 2*len(h.entries)+compactSlack {
+		h.compact()
+		return
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		log.Print("Failed to encode history: ", err)
+		return
+	}
+	f, err := openOwnedFile(h.fname, os.O_WRONLY|os.O_APPEND|os.O_CREATE, h.owner)
+	if err == nil {
+		_, err = f.Write(append(data, '\n'))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		log.Print("Failed to save history: ", err)
+		return
+	}
+	h.records++
+}
+
+// rewrite the file with one record per entry. caller must hold the lock.
+func (h *history) compact() {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range h.entries {
+		enc.Encode(historyRecord{historyEntry: *e})
+	}
+	records := len(h.entries)
+	// ids are never reused, even after deleting the most recent entry
+	if n := len(h.entries); h.lastid != 0 && (n == 0 || h.entries[n-1].Id != h.lastid) {
+		enc.Encode(historyRecord{historyEntry{Id: h.lastid}, true})
+		records++
+	}
+	err := writeFileAtomic(h.fname, buf.Bytes(), h.owner)
+	if err != nil {
+		log.Print("Failed to save history: ", err)
+		return
+	}
+	h.records = records
+}
+
+// Record a started command, returns the id of its entry
+func (h *history) Add(argv []string, cwd string, started time.Time) int64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.lastid++
+	e := &historyEntry{
+		Id:      h.lastid,
+		Argv:    argv,
+		Cwd:     cwd,
+		Started: started,
+	}
+	h.entries = append(h.entries, e)
+	h.trim()
+	h.write(historyRecord{historyEntry: *e})
+	return h.lastid
+}
+
+// caller must hold the lock
+func (h *history) find(id int64) int {
+	for i, e := range h.entries {
+		if e.Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Record how a command ended. Fine if its entry has been deleted in the
+// meantime.
+func (h *history) Finish(id int64, exited time.Time, status statusJson) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	i := h.find(id)
+	if i == -1 {
+		return
+	}
+	h.entries[i].Exited = &exited
+	h.entries[i].Status = &status
+	h.write(historyRecord{historyEntry: *h.entries[i]})
+}
+
+func (h *history) Delete(id int64) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	i := h.find(id)
+	if i == -1 {
+		return fmt.Errorf("no such history entry: %d", id)
+	}
+	h.entries = append(h.entries[:i], h.entries[i+1:]...)
+	h.write(historyRecord{historyEntry{Id: id}, true})
+	return nil
+}
+
+// Entries whose command line matches q, most recent first. mode is "prefix"
+// or "substring" (the default). At most limit entries are returned, unless
+// limit is 0.
+func (h *history) Search(q, mode string, limit int) ([]historyEntry, error) {
+	var match func(string) bool
+	switch mode {
+	case "prefix":
+		match = func(line string) bool { return strings.HasPrefix(line, q) }
+	case "substring", "":
+		match = func(line string) bool { return strings.Contains(line, q) }
+	default:
+		return nil, errors.New("unknown history search mode: " + mode)
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	results := []historyEntry{}
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		if limit > 0 && len(results) == limit {
+			break
+		}
+		e := h.entries[i]
+		if match(e.cmdline()) {
+			// copy: entries change when commands finish
+			results = append(results, *e)
+		}
+	}
+	return results, nil
+}
+
+// ~/.lush_history, or nothing if we don't know where home is
+func defaultHistoryFile() string {
+	home := os.Getenv("HOME")
+	if home == "" {
+		return ""
+	}
+	return filepath.Join(home, historyFileName)
+}
+
+const historyFileName = ".lush_history"
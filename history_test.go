@@ -0,0 +1,119 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lush-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "history")
+	h := newHistory()
+	err = h.Open(fname, nil)
+	if err != nil {
+		t.Fatal("Opening non-existing history file failed:", err)
+	}
+	now := time.Now()
+	h.Add([]string{"git", "status"}, "/", now)
+	id := h.Add([]string{"ls", "-l"}, "/tmp", now)
+	h.Add([]string{"git", "log"}, "/", now)
+	h.Finish(id, now, statusJson{Code: 2})
+	entries, err := h.Search("git", "prefix", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Argv[1] != "log" {
+		t.Errorf("Unexpected prefix search results: %v", entries)
+	}
+	entries, _ = h.Search("l", "", 1)
+	if len(entries) != 1 || entries[0].Argv[1] != "log" {
+		t.Errorf("Expected only most recent match with limit 1, got %v", entries)
+	}
+	_, err = h.Search("git", "fuzzy", 0)
+	if err == nil {
+		t.Error("Expected error for unknown search mode")
+	}
+	err = h.Delete(id + 1)
+	if err != nil {
+		t.Fatal("Failed to delete history entry:", err)
+	}
+	// fresh history from the same file
+	h = newHistory()
+	err = h.Open(fname, nil)
+	if err != nil {
+		t.Fatal("Failed to load history:", err)
+	}
+	entries, _ = h.Search("", "", 0)
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries after reload, got %v", entries)
+	}
+	if entries[0].Id != id || entries[0].Cwd != "/tmp" ||
+		entries[0].Status == nil || entries[0].Status.Code != 2 {
+		t.Errorf("Entry not restored correctly: %#v", entries[0])
+	}
+	if h.Add(nil, "", now) <= id+1 {
+		t.Error("Reused id of a deleted entry after reload")
+	}
+}
+
+func TestHistoryFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lush-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "history")
+	lines := func() int {
+		data, _ := ioutil.ReadFile(fname)
+		return bytes.Count(data, []byte("\n"))
+	}
+	h := newHistory()
+	h.Open(fname, nil)
+	now := time.Now()
+	id := h.Add([]string{"make"}, "/", now)
+	h.Finish(id, now, statusJson{Code: 2})
+	if n := lines(); n != 2 {
+		t.Errorf("Expected a record per change, got %d", n)
+	}
+	// the last record was cut short by a crash
+	f, err := os.OpenFile(fname, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"id":2,"argv":["ma`)
+	f.Close()
+	h = newHistory()
+	err = h.Open(fname, nil)
+	if err != nil {
+		t.Fatal("Failed to load history with a partial record:", err)
+	}
+	h.Add([]string{"ls"}, "/", now)
+	// rewritten often enough to stay small
+	for i := 0; i < 5*compactSlack; i++ {
+		h.Finish(id, now, statusJson{Code: 3})
+	}
+	if n := lines(); n > 2*2+compactSlack {
+		t.Errorf("History file not compacted: %d records for 2 entries", n)
+	}
+	h = newHistory()
+	err = h.Open(fname, nil)
+	if err != nil {
+		t.Fatal("Failed to load history:", err)
+	}
+	entries, _ := h.Search("", "", 0)
+	if len(entries) != 2 || entries[0].Argv[0] != "ls" || entries[1].Status.Code != 3 {
+		t.Errorf("Unexpected entries after compaction: %#v", entries)
+	}
+}
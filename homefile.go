@@ -0,0 +1,63 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+// Files lush keeps in the home dir of an account (see openHomeFiles). lush
+// runs as root then, and the account can replace those files by links to any
+// other file on the system before we get to them.
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/hraban/lush/liblush"
+)
+
+// open a file in the home dir of owner, refusing links and files of anyone
+// else. files of ours are handed over to owner. without an owner this is a
+// plain open.
+func openOwnedFile(fname string, flag int, owner *liblush.Account) (*os.File, error) {
+	if owner == nil {
+		return os.OpenFile(fname, flag, 0600)
+	}
+	f, err := os.OpenFile(fname, flag|oNoFollow, 0600)
+	if err != nil {
+		return nil, err
+	}
+	err = claimFile(f, owner)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// like ioutil.WriteFile, readable only by us (or owner, see openOwnedFile),
+// but doesn't leave a half-written file if we crash
+func writeFileAtomic(fname string, data []byte, owner *liblush.Account) error {
+	// a fresh name nobody could have put a link at
+	f, err := ioutil.TempFile(filepath.Dir(fname), filepath.Base(fname)+".tmp")
+	if err != nil {
+		return err
+	}
+	if owner != nil {
+		err = claimFile(f, owner)
+	}
+	if err == nil {
+		_, err = f.Write(data)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		// replaces a link rather than following it
+		err = os.Rename(f.Name(), fname)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
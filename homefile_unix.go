@@ -0,0 +1,37 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/hraban/lush/liblush"
+)
+
+const oNoFollow = syscall.O_NOFOLLOW
+
+// make sure f is a file of owner, not a (hard) link to someone else's, and
+// give it to them if it's ours
+func claimFile(f *os.File, owner *liblush.Account) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	st := fi.Sys().(*syscall.Stat_t)
+	if !fi.Mode().IsRegular() || st.Nlink != 1 {
+		return fmt.Errorf("%s: not a regular file with a single link", f.Name())
+	}
+	switch int(st.Uid) {
+	case int(owner.Uid):
+		return nil
+	case os.Getuid():
+		return f.Chown(int(owner.Uid), int(owner.Gid))
+	}
+	return fmt.Errorf("%s: owned by uid %d, not %s", f.Name(), st.Uid, owner.Name)
+}
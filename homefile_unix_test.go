@@ -0,0 +1,107 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+// +build !windows
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hraban/lush/liblush"
+)
+
+// in the home dir of an account, which could point the history file anywhere
+func TestHistoryOwned(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lush-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	owner := &liblush.Account{Name: "me", Uid: uint32(os.Getuid()), Gid: uint32(os.Getgid())}
+	if os.Getuid() == 0 {
+		if a, err := liblush.LookupAccount("nobody"); err == nil {
+			owner = a
+		}
+	}
+	fname := filepath.Join(dir, historyFileName)
+	target := filepath.Join(dir, "target")
+	ioutil.WriteFile(target, []byte("precious\n"), 0600)
+	h := newHistory()
+	err = h.Open(fname, owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Add([]string{"ls"}, "/", time.Now())
+	fi, err := os.Stat(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uid := fi.Sys().(*syscall.Stat_t).Uid; uid != owner.Uid {
+		t.Errorf("History file owned by %d, not %d", uid, owner.Uid)
+	}
+	os.Remove(fname)
+	os.Symlink(target, fname)
+	h.Add([]string{"ls"}, "/", time.Now())
+	if data, _ := ioutil.ReadFile(target); string(data) != "precious\n" {
+		t.Errorf("Appended to the target of a symlink: %q", data)
+	}
+	if newHistory().Open(fname, owner) == nil {
+		t.Error("Expected error opening a symlink as history file")
+	}
+	os.Remove(fname)
+	os.Link(target, fname)
+	if newHistory().Open(fname, owner) == nil {
+		t.Error("Expected error opening a hard link as history file")
+	}
+}
+
+func TestAliasesOwned(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("must be root to keep files for another user")
+	}
+	a, err := liblush.LookupAccount("nobody")
+	if err != nil {
+		t.Skipf("no account to test with: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "lush-aliases")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, aliasFileName)
+	s := newServer()
+	err = s.OpenAliases(fname, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wseventSetalias(s, `{"name":"ll","template":["ls","-l"]}`)
+	fi, err := os.Stat(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uid := fi.Sys().(*syscall.Stat_t).Uid; uid != a.Uid {
+		t.Errorf("Alias file owned by %d, not %d", uid, a.Uid)
+	}
+	// someone else's file
+	target := filepath.Join(dir, "target")
+	ioutil.WriteFile(target, []byte(`{"secret":["x"]}`), 0600)
+	os.Remove(fname)
+	os.Symlink(target, fname)
+	if newServer().OpenAliases(fname, a) == nil {
+		t.Error("Expected error opening a symlink as alias file")
+	}
+	wseventSetalias(s, `{"name":"la","template":["ls","-a"]}`)
+	if data, _ := ioutil.ReadFile(target); string(data) != `{"secret":["x"]}` {
+		t.Errorf("Overwrote the target of a symlink: %s", data)
+	}
+	if fi, err := os.Lstat(fname); err != nil || !fi.Mode().IsRegular() {
+		t.Errorf("Expected the symlink to be replaced by the alias file: %v", err)
+	}
+}
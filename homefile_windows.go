@@ -0,0 +1,18 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"os"
+
+	"github.com/hraban/lush/liblush"
+)
+
+const oNoFollow = 0
+
+// no accounts on windows, see liblush/account_rest.go
+func claimFile(f *os.File, owner *liblush.Account) error {
+	return nil
+}
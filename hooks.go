@@ -0,0 +1,202 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+// Hooks: tell the outside world when commands exit. Configured with -hooks as
+// a JSON list, eg:
+//
+//     [{"on": "failure", "script": "/home/me/bin/notify-failure"},
+//      {"on": "exit", "minduration": 60, "url": "http://localhost:9000/done"}]
+//
+// A hook runs a script with the payload (see hookPayload) as JSON on its stdin,
+// or POSTs it to a URL. Hooks run in the background, failures are logged.
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os/exec"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hraban/lush/liblush"
+)
+
+// scripts and requests taking longer than this are killed
+const hookTimeout = 30 * time.Second
+
+// default number of bytes of scrollback in the payload, per stream
+const defaultHookTail = 1024
+
+type hook struct {
+	// exit, success or failure
+	On string `json:"on"`
+	// only fire for commands that ran at least this many seconds
+	MinDuration float64 `json:"minduration,omitempty"`
+	// either one of these
+	Script string `json:"script,omitempty"`
+	Url    string `json:"url,omitempty"`
+	// bytes of scrollback per stream in the payload, 0 for the default,
+	// negative for none
+	Tail int `json:"tail,omitempty"`
+}
+
+func (h hook) validate() error {
+	switch h.On {
+	case "exit", "success", "failure":
+	default:
+		return fmt.Errorf("unknown hook event: %q", h.On)
+	}
+	if (h.Script == "") == (h.Url == "") {
+		return errors.New("a hook needs either a script or a url")
+	}
+	return nil
+}
+
+// does this hook fire for a command that exited with this status?
+func (h hook) matches(status liblush.CmdStatus, duration time.Duration) bool {
+	if duration.Seconds() < h.MinDuration {
+		return false
+	}
+	switch h.On {
+	case "success":
+		return status.Success()
+	case "failure":
+		return !status.Success()
+	}
+	return true
+}
+
+type hookPayload struct {
+	// the "on" of the hook
+	Event    string        `json:"event"`
+	Id       liblush.CmdId `json:"nid"`
+	Name     string        `json:"name"`
+	Argv     []string      `json:"argv"`
+	Status   statusJson    `json:"status"`
+	Started  time.Time     `json:"started"`
+	Exited   time.Time     `json:"exited"`
+	Duration float64       `json:"duration"`
+	Stdout   string        `json:"stdout"`
+	Stderr   string        `json:"stderr"`
+}
+
+// the last n bytes of a scrollback buffer, without a broken character at the
+// start
+func scrollbackTail(rb liblush.Ringbuffer, n int) string {
+	if n > rb.Size() {
+		n = rb.Size()
+	}
+	if n <= 0 {
+		return ""
+	}
+	buf := make([]byte, n)
+	buf = buf[:rb.Last(buf)]
+	for len(buf) > 0 && !utf8.RuneStart(buf[0]) {
+		buf = buf[1:]
+	}
+	return string(buf)
+}
+
+// Load hooks from a JSON file
+func (s *server) LoadHooks(fname string) error {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return err
+	}
+	var hooks []hook
+	err = json.Unmarshal(data, &hooks)
+	if err != nil {
+		return fmt.Errorf("corrupt hooks file %s: %v", fname, err)
+	}
+	for i, h := range hooks {
+		err = h.validate()
+		if err != nil {
+			return fmt.Errorf("hooks file %s: hook %d: %v", fname, i+1, err)
+		}
+	}
+	s.hooks = hooks
+	return nil
+}
+
+func runHook(h hook, payload []byte, dir string) error {
+	if h.Script != "" {
+		cmd := exec.Command(h.Script)
+		cmd.Dir = dir
+		cmd.Stdin = bytes.NewReader(payload)
+		err := cmd.Start()
+		if err != nil {
+			return err
+		}
+		timer := time.AfterFunc(hookTimeout, func() { cmd.Process.Kill() })
+		defer timer.Stop()
+		return cmd.Wait()
+	}
+	client := http.Client{Timeout: hookTimeout}
+	resp, err := client.Post(h.Url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("POST %s: %s", h.Url, resp.Status)
+	}
+	return nil
+}
+
+// fire the hooks when this command exits (status listeners are dropped after
+// that, so this happens once)
+func addHooks(s *server, c liblush.Cmd) {
+	if len(s.hooks) == 0 {
+		return
+	}
+	c.Status().NotifyChange(func(status liblush.CmdStatus) error {
+		if status.Exited() == nil {
+			return nil
+		}
+		exited := *status.Exited()
+		started := exited
+		if status.Started() != nil {
+			started = *status.Started()
+		}
+		duration := exited.Sub(started)
+		for _, h := range s.hooks {
+			if !h.matches(status, duration) {
+				continue
+			}
+			tail := h.Tail
+			if tail == 0 {
+				tail = defaultHookTail
+			}
+			payload, err := json.Marshal(hookPayload{
+				Event:    h.On,
+				Id:       c.Id(),
+				Name:     c.Name(),
+				Argv:     c.Argv(),
+				Status:   cmdstatus2json(status),
+				Started:  started,
+				Exited:   exited,
+				Duration: duration.Seconds(),
+				Stdout:   scrollbackTail(c.Stdout().Scrollback(), tail),
+				Stderr:   scrollbackTail(c.Stderr().Scrollback(), tail),
+			})
+			if err != nil {
+				log.Print("Failed to encode hook payload: ", err)
+				continue
+			}
+			go func(h hook) {
+				err := runHook(h, payload, c.StartWd())
+				if err != nil {
+					log.Printf("Hook on %s for command %d failed: %v", h.On, c.Id(), err)
+				}
+			}(h)
+		}
+		return nil
+	})
+}
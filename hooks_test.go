@@ -0,0 +1,163 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// run a command to completion
+func runCmdJson(t *testing.T, s *server, options string) {
+	c, err := newCmd(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Start()
+	c.Wait()
+}
+
+func TestHooks(t *testing.T) {
+	payloads := make(chan hookPayload, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p hookPayload
+		if r.Method != "POST" || json.NewDecoder(r.Body).Decode(&p) != nil {
+			t.Errorf("Unexpected hook request: %s %s", r.Method, r.URL)
+		}
+		p.Event = r.URL.Path[1:] + ":" + p.Event
+		payloads <- p
+	}))
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "lush-hooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "hooks.json")
+	err = ioutil.WriteFile(fname, []byte(`[
+		{"on": "failure", "url": "`+ts.URL+`/a"},
+		{"on": "exit", "url": "`+ts.URL+`/b", "tail": 3},
+		{"on": "success", "url": "`+ts.URL+`/c", "minduration": 3600}
+	]`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newServer()
+	err = s.LoadHooks(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runCmdJson(t, s, `{"cmd": "pwd", "name": "where"}`)
+	wd, _ := os.Getwd()
+	select {
+	case p := <-payloads:
+		if p.Event != "b:exit" || p.Name != "where" || p.Argv[0] != "pwd" || p.Status.Code != 2 {
+			t.Errorf("Unexpected payload for pwd: %#v", p)
+		}
+		if p.Stdout != wd[len(wd)-2:]+"\n" || p.Stderr != "" {
+			t.Errorf("Expected tail of %q in stdout, got %q", wd, p.Stdout)
+		}
+		if p.Exited.Before(p.Started) || p.Duration < 0 {
+			t.Errorf("Unexpected times: %v - %v (%f)", p.Started, p.Exited, p.Duration)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Exit hook didn't fire")
+	}
+	// failing, and failing to start at all
+	for _, options := range []string{
+		`{"cmd": "cd", "args": ["/no/such/dir"]}`,
+		`{"cmd": "/no/such/dir/cmd"}`,
+	} {
+		c, err := newCmd(s, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Start()
+		seen := map[string]bool{}
+		for i := 0; i < 2; i++ {
+			select {
+			case p := <-payloads:
+				seen[p.Event] = true
+				if p.Status.Code != 3 || !strings.Contains(p.Status.ErrStr, "no/such/dir") {
+					t.Errorf("Unexpected payload for failure: %#v", p)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Hooks didn't fire on failure of %s", options)
+			}
+		}
+		if !seen["a:failure"] || !seen["b:exit"] {
+			t.Errorf("Expected failure and exit hooks for %s, got %v", options, seen)
+		}
+	}
+	select {
+	case p := <-payloads:
+		t.Errorf("Unexpected hook: %#v", p)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestHookScript(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh in PATH")
+	}
+	dir, err := ioutil.TempDir("", "lush-hooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "payload.json")
+	script := filepath.Join(dir, "hook.sh")
+	err = ioutil.WriteFile(script, []byte("#!/bin/sh\ncat > "+out+"\n"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newServer()
+	s.hooks = []hook{{On: "exit", Script: script}}
+	runCmdJson(t, s, `{"cmd": "pwd"}`)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, err := ioutil.ReadFile(out)
+		var p hookPayload
+		if err == nil && json.Unmarshal(data, &p) == nil {
+			if p.Event != "exit" || p.Argv[0] != "pwd" {
+				t.Errorf("Unexpected payload: %s", data)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Hook script didn't write the payload")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLoadHooksInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lush-hooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "hooks.json")
+	s := newServer()
+	for _, data := range []string{
+		`{"on": "exit"}`,
+		`[{"on": "exit"}]`,
+		`[{"on": "start", "url": "http://localhost/"}]`,
+		`[{"on": "exit", "url": "http://localhost/", "script": "/bin/true"}]`,
+	} {
+		ioutil.WriteFile(fname, []byte(data), 0600)
+		if s.LoadHooks(fname) == nil {
+			t.Errorf("Expected error loading %s", data)
+		}
+	}
+}
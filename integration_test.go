@@ -12,7 +12,7 @@ import (
 	"os"
 	"testing"
 
-	"github.com/gorilla/websocket"
+	"github.com/hraban/lush/lushclient"
 )
 
 // Changing directory in the shell causes all web requests to 404
@@ -26,15 +26,18 @@ func TestIntegrationChangeDirectory(t *testing.T) {
 	s := newServer()
 	ts := httptest.NewServer(s.httpHandler)
 	defer ts.Close()
-	ws := connectWebsocketSimple(t, ts)
-	defer ws.Close()
-	err = ws.WriteMessage(websocket.TextMessage, []byte("chdir;/"))
+	c := connectClient(t, ts, nil)
+	defer c.Close()
+	err = c.Send("chdir", "/")
 	if err != nil {
 		t.Fatal("Error sending chdir command:", err)
 	}
-	msg := getTextMessage(t, ws)
-	if msg != "chdir;\"/\"" {
-		t.Fatalf("Unexpected response to chdir command: %q", msg)
+	e, err := c.Next()
+	if err != nil {
+		t.Fatal("Error reading websocket message:", err)
+	}
+	if raw, ok := e.(*lushclient.RawEvent); !ok || raw.Name != "chdir" || raw.Payload != `"/"` {
+		t.Fatalf("Unexpected response to chdir command: %#v", e)
 	}
 	testGetIndexPage(t, ts.URL+"/")
 }
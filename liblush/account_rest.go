@@ -0,0 +1,22 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+// +build !linux,!darwin
+
+package liblush
+
+import (
+	"errors"
+	"runtime"
+)
+
+var errAccountUnsupported = errors.New("running as another user unsupported on " + runtime.GOOS)
+
+func LookupAccount(name string) (*Account, error) {
+	return nil, errAccountUnsupported
+}
+
+func setCredential(c *cmd, a *Account) error {
+	return errAccountUnsupported
+}
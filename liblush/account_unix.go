@@ -0,0 +1,88 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+// +build linux darwin
+
+package liblush
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+func parseId(id string) (uint32, error) {
+	i, err := strconv.ParseUint(id, 10, 32)
+	return uint32(i), err
+}
+
+// Look up a Unix account by user name
+func LookupAccount(name string) (*Account, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	a := &Account{Name: u.Username, Home: u.HomeDir}
+	a.Uid, err = parseId(u.Uid)
+	if err != nil {
+		return nil, fmt.Errorf("invalid uid for %s: %q", name, u.Uid)
+	}
+	a.Gid, err = parseId(u.Gid)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gid for %s: %q", name, u.Gid)
+	}
+	gids, err := u.GroupIds()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get groups of %s: %v", name, err)
+	}
+	for _, gidstr := range gids {
+		gid, err := parseId(gidstr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid group id for %s: %q", name, gidstr)
+		}
+		a.Groups = append(a.Groups, gid)
+	}
+	a.Shell = loginShell(name)
+	return a, nil
+}
+
+// os/user doesn't know about shells. this misses accounts from NSS sources
+// other than /etc/passwd but a sensible default will do for those.
+func loginShell(name string) string {
+	f, err := os.Open("/etc/passwd")
+	if err != nil {
+		return "/bin/sh"
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// name:password:uid:gid:gecos:home:shell
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) == 7 && fields[0] == name && fields[6] != "" {
+			return fields[6]
+		}
+	}
+	return "/bin/sh"
+}
+
+// make the command run as given account. nothing to do if that's us already,
+// which (unlike setting it anyway) also works when we're not root.
+func setCredential(c *cmd, a *Account) error {
+	if int(a.Uid) == os.Getuid() && int(a.Gid) == os.Getgid() {
+		return nil
+	}
+	if c.execCmd.SysProcAttr == nil {
+		c.execCmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	c.execCmd.SysProcAttr.Credential = &syscall.Credential{
+		Uid:    a.Uid,
+		Gid:    a.Gid,
+		Groups: a.Groups,
+	}
+	return nil
+}
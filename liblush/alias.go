@@ -0,0 +1,107 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package liblush
+
+// Aliases are command templates: a name and the argv it stands for. In the
+// template $1, $2, ... (or ${10} and up) are replaced by those arguments, and
+// a word that is exactly $@ is replaced by all of them. A template without
+// any of those gets the arguments appended, like a shell alias.
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// aliases expanding to aliases expanding to ... give up at some point
+const maxAliasDepth = 16
+
+var aliasParamRegexp = regexp.MustCompile(`\$([1-9]|\{[1-9][0-9]*\})`)
+
+func validAliasName(name string) error {
+	if name == "" || strings.ContainsAny(name, "/ \t\n") {
+		return fmt.Errorf("invalid alias name: %q", name)
+	}
+	return nil
+}
+
+// expand one alias template with these arguments. literal flags (see
+// Cmd.SetLiteralArgs) of the arguments go where they go, template words are
+// never literal.
+func applyAlias(name string, template, args []string, literal []bool) ([]string, []bool, error) {
+	var argv []string
+	var argvLiteral []bool
+	isLiteral := func(i int) bool {
+		return i < len(literal) && literal[i]
+	}
+	params := false
+	for _, word := range template {
+		if word == "$@" {
+			params = true
+			for i, arg := range args {
+				argv = append(argv, arg)
+				argvLiteral = append(argvLiteral, isLiteral(i))
+			}
+			continue
+		}
+		var err error
+		lit := false
+		word = aliasParamRegexp.ReplaceAllStringFunc(word, func(p string) string {
+			params = true
+			n, _ := strconv.Atoi(strings.Trim(p, "${}"))
+			if n > len(args) {
+				err = fmt.Errorf("%s: missing argument %s", name, p)
+				return ""
+			}
+			// can't expand half a word
+			lit = lit || isLiteral(n-1)
+			return args[n-1]
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		argv = append(argv, word)
+		argvLiteral = append(argvLiteral, lit)
+	}
+	if !params {
+		for i, arg := range args {
+			argv = append(argv, arg)
+			argvLiteral = append(argvLiteral, isLiteral(i))
+		}
+	}
+	if len(argv) == 0 {
+		return nil, nil, fmt.Errorf("%s: expands to nothing", name)
+	}
+	return argv, argvLiteral, nil
+}
+
+// Expand argv[0] as long as it's an alias. An alias is not expanded again
+// within its own expansion, so ls can be an alias for ls -F. The literal flags
+// of argv are rearranged along with it.
+func expandAliases(aliases map[string][]string, argv []string, literal []bool) ([]string, []bool, error) {
+	expanded := map[string]bool{}
+	for i := 0; ; i++ {
+		template, ok := aliases[argv[0]]
+		// a literal command name is not an alias
+		if !ok || expanded[argv[0]] || (len(literal) > 0 && literal[0]) {
+			return argv, literal, nil
+		}
+		if i == maxAliasDepth {
+			return nil, nil, errors.New("aliases nested too deep: " + argv[0])
+		}
+		expanded[argv[0]] = true
+		var args []bool
+		if len(literal) > 1 {
+			args = literal[1:]
+		}
+		var err error
+		argv, literal, err = applyAlias(argv[0], template, argv[1:], args)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+}
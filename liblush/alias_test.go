@@ -0,0 +1,72 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package liblush
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestExpandAliases(t *testing.T) {
+	aliases := map[string][]string{
+		"ls":   {"ls", "-F"},
+		"ll":   {"ls", "-l"},
+		"gco":  {"git", "checkout", "$1"},
+		"both": {"echo", "$2-$1", "$@"},
+		"loop": {"loop2"},
+		"big":  {"echo", "${10}"},
+	}
+	aliases["loop2"] = []string{"loop"}
+	for _, tc := range []struct {
+		argv     []string
+		expected string
+	}{
+		{[]string{"true"}, "[true]"},
+		{[]string{"ls", "x"}, "[ls -F x]"},
+		{[]string{"ll", "x"}, "[ls -F -l x]"},
+		{[]string{"gco", "master"}, "[git checkout master]"},
+		{[]string{"gco"}, "error"},
+		{[]string{"both", "a", "b"}, "[echo b-a a b]"},
+		{[]string{"big", "1", "2", "3", "4", "5", "6", "7", "8", "9", "10"}, "[echo 10]"},
+		// loop -> loop2 -> loop: not expanded again
+		{[]string{"loop"}, "[loop]"},
+	} {
+		argv, _, err := expandAliases(aliases, tc.argv, nil)
+		result := fmt.Sprint(argv)
+		if err != nil {
+			result = "error"
+		}
+		if result != tc.expected {
+			t.Errorf("%v: expected %s, got %s (error: %v)", tc.argv, tc.expected, result, err)
+		}
+	}
+}
+
+func TestSessionAlias(t *testing.T) {
+	s := NewSession()
+	if err := s.SetAlias("a/b", []string{"true"}); err == nil {
+		t.Error("expected error for alias name with a slash")
+	}
+	err := s.SetAlias("where-am-i", []string{"pwd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := s.NewCommand("where-am-i")
+	c.(*cmd).SetStartWd("/")
+	if c.ExpandedArgv() != nil {
+		t.Errorf("expanded argv before start: %v", c.ExpandedArgv())
+	}
+	out, err := runInSession(t, s, "/", "where-am-i")
+	if err != nil || out != "/\n" {
+		t.Errorf("alias for pwd printed %q (error: %v)", out, err)
+	}
+	s.UnsetAlias("where-am-i")
+	if len(s.Aliases()) != 0 {
+		t.Errorf("aliases left after unset: %v", s.Aliases())
+	}
+	if _, err = runInSession(t, s, "/", "where-am-i"); err == nil {
+		t.Error("expected error running removed alias")
+	}
+}
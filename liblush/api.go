@@ -21,11 +21,107 @@ type CmdStatus interface {
 	Success() bool
 	// nil iff Success() == true
 	Err() error
+	// True if the command was stopped because it exceeded its timeout
+	TimedOut() bool
 	// Called with this status as an argument on every update. If the callback
 	// returns a non-nil error it will not be called for future updates.
 	NotifyChange(func(CmdStatus) error)
 }
 
+// Condition under which a successor is started when its predecessor exits
+type ChainCondition int
+
+const (
+	// Start the successor no matter how the command exited
+	OnExit ChainCondition = iota
+	// Only start the successor if the command exited successfully
+	OnSuccess
+	// Only start the successor if the command failed, including failure to
+	// start at all
+	OnFailure
+	numChainConditions
+)
+
+// One step in stopping a command: send Signal, then give the command Wait to
+// exit before escalating to the next step.
+type StopStep struct {
+	Signal os.Signal
+	Wait   time.Duration
+}
+
+// Resource limits of a command. Zero values mean no limit.
+type Limits struct {
+	// Size of the virtual address space in bytes (RLIMIT_AS)
+	AddressSpace uint64
+	// CPU time in seconds (RLIMIT_CPU)
+	CPUTime uint64
+	// Number of open file descriptors (RLIMIT_NOFILE)
+	OpenFiles uint64
+	// Scheduling priority, as in nice(1)
+	Nice int
+	// Memory cap in bytes. Requires cgroup v2 (memory.max).
+	Memory uint64
+	// CPU cap in number of CPUs, e.g. 0.5 for half a CPU. Requires cgroup v2
+	// (cpu.max).
+	CPUs float64
+}
+
+// Isolation of commands from the host using Linux namespaces. A sandboxed
+// command gets its own user, mount, PID, UTS and IPC namespace. Its root
+// filesystem is empty save for read-only binds of Dirs, a private /proc, the
+// basic devices and a scratch /tmp.
+type Sandbox struct {
+	// Directories made visible inside the sandbox, at the same path and
+	// read-only. Those that don't exist are skipped.
+	Dirs []string
+	// Share the network of the host instead of getting an isolated (empty)
+	// network namespace
+	Network bool
+}
+
+// Files that rerun a command when they change. Liblush only keeps this
+// around, and copies it to clones; the actual watching is up to its user.
+type Watch struct {
+	// Files, directories (their entries) or glob patterns, relative to the
+	// starting directory of the command
+	Paths []string
+	// Wait this long after a change for more changes before rerunning
+	Debounce time.Duration
+}
+
+// Unix account commands run as, see LookupAccount. Running as anybody but
+// yourself requires lush to run as root.
+type Account struct {
+	Name   string
+	Uid    uint32
+	Gid    uint32
+	Groups []uint32
+	Home   string
+	Shell  string
+}
+
+// Everything a builtin command gets to work with
+type BuiltinContext struct {
+	// The command running this builtin
+	Cmd     Cmd
+	Session Session
+	Argv    []string
+	// Working directory (the StartWd of the command)
+	Dir    string
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// A command implemented in Go and run by Cmd.Start as part of this process,
+// instead of spawning a new one. It runs in a goroutine of its own and the
+// error it returns is the exit status of the command. See RegisterBuiltin.
+//
+// Builtins run with the privileges of lush itself: the resource limits,
+// sandbox and account of the command don't apply. They should stick to the
+// session and their streams.
+type Builtin func(ctx *BuiltinContext) error
+
 // Circular fifo buffer.
 type Ringbuffer interface {
 	Size() int
@@ -41,6 +137,19 @@ type Ringbuffer interface {
 	WriteTo(w io.Writer) (int64, error)
 }
 
+// Scrollback of whole lines: keeps the last MaxLines() lines, as long as they
+// fit in Size() bytes. Characters are never cut in half; when a single line
+// doesn't fit, only its end is kept.
+type LineBuffer interface {
+	Ringbuffer
+	MaxLines() int
+	SetMaxLines(int)
+	// Including an incomplete last line
+	NumLines() int
+	// Lines [start, end), the oldest being 0, without newlines
+	Lines(start, end int) []string
+}
+
 // Output stream of a command
 type OutStream interface {
 	// An output stream has one main listener it forwards all its data to. If
@@ -65,6 +174,19 @@ type OutStream interface {
 	// something different, but that's life.
 	Peeker() *FlexibleMultiWriter
 	Scrollback() Ringbuffer
+	// Scrollback of the last n lines (see LineBuffer) rather than bytes, with
+	// the current size as byte limit. 0 to keep bytes again. Switching keeps
+	// as much of the scrollback as fits.
+	ScrollbackLines() int
+	SetScrollbackLines(n int)
+	// A stream in record mode carries JSON values, one per line (JSON
+	// lines). Besides going through as normal, every line is then also
+	// written to the record peeker as one complete record: one Write per
+	// record, without the newline. Lines that are not valid JSON are sent as
+	// a JSON string.
+	RecordMode() bool
+	SetRecordMode(bool)
+	RecordPeeker() *FlexibleMultiWriter
 }
 
 // Input stream of a command.  Writes to this stream block until the command is
@@ -84,6 +206,21 @@ type Cmd interface {
 	Argv() []string
 	// Error to call this after command has started
 	SetArgv([]string) error
+	// Per argument (by index in Argv, including the command itself): true to
+	// pass it as is, without alias or any other expansion (see expand.go).
+	// Missing entries are false. Error to call this after command has
+	// started.
+	LiteralArgs() []bool
+	SetLiteralArgs([]bool) error
+	// Expand the arguments at start (see expand.go). Off by default, because
+	// callers that parse a command line themselves (like the browser) have
+	// already dealt with quotes and globs. Aliases are expanded either way.
+	// Error to call this after command has started.
+	Expand() bool
+	SetExpand(bool) error
+	// What was actually started: argv after expansion. nil if the command
+	// hasn't been started.
+	ExpandedArgv() []string
 	// Current working directory of this command
 	// TODO: Should allow monitoring because the command can change this
 	// whenever. I'll just tell you right here: that's gonna be tough. Best I
@@ -112,11 +249,59 @@ type Cmd interface {
 	UserData() interface{}
 	SetUserData(interface{})
 	Signal(os.Signal) error
+	// Command that is started automatically when this one exits under the
+	// given condition, nil if none. Chains are run by the shell itself: they
+	// complete regardless of whether any client is still connected.
+	Successor(ChainCondition) Cmd
+	// Set the successor for this condition, nil to clear it. Every condition
+	// has at most one successor.
+	SetSuccessor(ChainCondition, Cmd)
+	// Maximum running time, 0 if none
+	Timeout() time.Duration
+	// A command that exceeds its timeout is stopped as if by Stop(nil). The
+	// deadline is relative to the start time, so this can safely be changed
+	// while it runs.
+	SetTimeout(time.Duration)
+	// Steps taken by Stop, DefaultStopSequence unless set otherwise
+	StopSequence() []StopStep
+	SetStopSequence([]StopStep)
+	// Walk through the stop sequence: send a signal, give the command time to
+	// exit, and escalate to the next signal if it didn't. Only the first
+	// signal is sent synchronously, its error (if any) is returned. The rest
+	// happens in the background. If progress is not nil it is called after
+	// every signal sent, with the result of sending it.
+	Stop(progress func(StopStep, error)) error
+	Limits() Limits
+	// Limits are applied when the command is started; if that fails, so does
+	// Start. Error to call this after the command has started.
+	SetLimits(Limits) error
+	// Sandbox this command runs in, nil if none. Inherited from the session
+	// at creation, see Session.SetSandbox.
+	Sandbox() *Sandbox
+	// Account this command runs as, nil if it runs as the lush process
+	// itself. Inherited from the session at creation.
+	Account() *Account
+	// nil if none
+	Watch() *Watch
+	SetWatch(*Watch)
+	Triggers() []Trigger
+	SetTriggers([]Trigger)
+	// The most recent matches of the triggers, oldest first
+	TriggerMatches() []TriggerMatch
+	// Called for every match, from the goroutine writing the output. Actions
+	// of the trigger are taken after this returns.
+	NotifyTrigger(func(TriggerMatch))
 }
 
 type Session interface {
+	// Change the working directory of this process, so of every session
 	Chdir(dir string) error
+	// Called with the new directory after every successful Chdir
+	NotifyChdir(func(dir string))
 	NewCommand(name string, arg ...string) Cmd
+	// Create a new, unstarted command configured like an existing one. See
+	// the cmd.clone method for what exactly is copied.
+	CloneCommand(id CmdId) (Cmd, error)
 	GetCommand(id CmdId) Cmd
 	GetCommandIds() []CmdId
 	ReleaseCommand(id CmdId) error
@@ -129,4 +314,20 @@ type Session interface {
 	Unsetenv(key string)
 	Getenv(name string) string
 	Environ() map[string]string
+	// Resource limits of every command created from now on
+	DefaultLimits() Limits
+	SetDefaultLimits(Limits)
+	// Sandbox for every command created from now on, nil for none
+	Sandbox() *Sandbox
+	SetSandbox(*Sandbox)
+	// Account every command created from now on runs as, nil for the user
+	// running lush. Also sets HOME, USER, LOGNAME and SHELL in the session
+	// environment.
+	Account() *Account
+	SetAccount(*Account)
+	// Aliases are expanded when a command starts, before everything else in
+	// expand.go. See alias.go for the template syntax.
+	SetAlias(name string, template []string) error
+	UnsetAlias(name string)
+	Aliases() map[string][]string
 }
@@ -0,0 +1,175 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package liblush
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// by name. a command whose argv[0] is exactly one of these names (so no
+// path) runs the builtin.
+var builtins = map[string]Builtin{}
+var builtinslock sync.RWMutex
+
+func RegisterBuiltin(name string, b Builtin) {
+	builtinslock.Lock()
+	defer builtinslock.Unlock()
+	builtins[name] = b
+}
+
+// nil if there is no builtin by that name
+func GetBuiltin(name string) Builtin {
+	builtinslock.RLock()
+	defer builtinslock.RUnlock()
+	return builtins[name]
+}
+
+// the builtin to run for this argv, nil for none. env is only a builtin without
+// arguments: with them (env FOO=bar cmd) it's the real env.
+func builtinFor(argv []string) Builtin {
+	if argv[0] == "env" && len(argv) > 1 {
+		return nil
+	}
+	return GetBuiltin(argv[0])
+}
+
+func BuiltinNames() []string {
+	builtinslock.RLock()
+	defer builtinslock.RUnlock()
+	var names []string
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterBuiltin("cd", builtinCd)
+	RegisterBuiltin("pwd", builtinPwd)
+	RegisterBuiltin("export", builtinExport)
+	RegisterBuiltin("unset", builtinUnset)
+	RegisterBuiltin("which", builtinWhich)
+	RegisterBuiltin("env", builtinEnv)
+}
+
+// cd [dir]. changes the directory of the entire session, like Session.Chdir
+// from anywhere else.
+func builtinCd(ctx *BuiltinContext) error {
+	var dir string
+	switch len(ctx.Argv) {
+	case 1:
+		dir = ctx.Session.Getenv("HOME")
+		if dir == "" {
+			return errors.New("cd: HOME not set")
+		}
+	case 2:
+		dir = ctx.Argv[1]
+	default:
+		return errors.New("usage: cd [dir]")
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(ctx.Dir, dir)
+	}
+	err := ctx.Session.Chdir(dir)
+	if err != nil {
+		return fmt.Errorf("cd: %v", err)
+	}
+	return nil
+}
+
+func builtinPwd(ctx *BuiltinContext) error {
+	_, err := fmt.Fprintln(ctx.Stdout, ctx.Dir)
+	return err
+}
+
+// print environment variables sorted by name, each line formatted by f
+func printEnviron(ctx *BuiltinContext, f string) error {
+	env := ctx.Session.Environ()
+	var keys []string
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		_, err := fmt.Fprintf(ctx.Stdout, f, k, env[k])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// export NAME=value... or just export to list everything. every variable is
+// exported, so export NAME is a no-op.
+func builtinExport(ctx *BuiltinContext) error {
+	if len(ctx.Argv) == 1 {
+		return printEnviron(ctx, "export %s=%q\n")
+	}
+	for _, arg := range ctx.Argv[1:] {
+		kv := strings.SplitN(arg, "=", 2)
+		if kv[0] == "" {
+			return fmt.Errorf("export: invalid name: %q", arg)
+		}
+		if len(kv) == 2 {
+			ctx.Session.Setenv(kv[0], kv[1])
+		}
+	}
+	return nil
+}
+
+func builtinUnset(ctx *BuiltinContext) error {
+	for _, name := range ctx.Argv[1:] {
+		ctx.Session.Unsetenv(name)
+	}
+	return nil
+}
+
+// which name... looks in the PATH of lush itself, like Start does
+func builtinWhich(ctx *BuiltinContext) error {
+	if len(ctx.Argv) == 1 {
+		return errors.New("usage: which name...")
+	}
+	var missing []string
+	path := filepath.SplitList(os.Getenv("PATH"))
+	for _, name := range ctx.Argv[1:] {
+		if GetBuiltin(name) != nil {
+			fmt.Fprintf(ctx.Stdout, "%s: shell builtin\n", name)
+			continue
+		}
+		found := false
+		for _, dir := range path {
+			if dir == "" {
+				continue
+			}
+			// with a separator in it LookPath just checks that file
+			p, err := exec.LookPath(filepath.Join(dir, name))
+			if err == nil {
+				fmt.Fprintln(ctx.Stdout, p)
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, name)
+		}
+	}
+	if missing != nil {
+		return fmt.Errorf("which: not found: %s", strings.Join(missing, " "))
+	}
+	return nil
+}
+
+// env without arguments, see builtinFor
+func builtinEnv(ctx *BuiltinContext) error {
+	return printEnviron(ctx, "%s=%s\n")
+}
@@ -0,0 +1,108 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package liblush
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// run a command in a session, return its stdout
+func runInSession(t *testing.T, s Session, wd string, argv ...string) (string, error) {
+	var b bytes.Buffer
+	c := s.NewCommand(argv[0], argv[1:]...)
+	c.(*cmd).SetStartWd(wd)
+	c.Stdout().SetListener(&b)
+	err := c.Run()
+	return b.String(), err
+}
+
+func TestBuiltinEnv(t *testing.T) {
+	s := NewSession()
+	_, err := runInSession(t, s, "", "export", "LUSHTEST=foo=bar", "LUSHTEST2=baz")
+	if err != nil {
+		t.Fatal("export failed:", err)
+	}
+	if v := s.Getenv("LUSHTEST"); v != "foo=bar" {
+		t.Errorf("expected LUSHTEST=foo=bar, got %q", v)
+	}
+	_, err = runInSession(t, s, "", "unset", "LUSHTEST2")
+	if err != nil {
+		t.Fatal("unset failed:", err)
+	}
+	out, err := runInSession(t, s, "", "env")
+	if err != nil {
+		t.Fatal("env failed:", err)
+	}
+	if !strings.Contains(out, "\nLUSHTEST=foo=bar\n") || strings.Contains(out, "LUSHTEST2") {
+		t.Errorf("unexpected env output: %q", out)
+	}
+	// with arguments it's the real env
+	if _, err = exec.LookPath("env"); err != nil {
+		t.Skip("no env in PATH")
+	}
+	out, err = runInSession(t, s, "", "env", "LUSHTEST3=qux", "sh", "-c", "echo $LUSHTEST3")
+	if err != nil || out != "qux\n" {
+		t.Errorf("env with a command printed %q (error: %v)", out, err)
+	}
+}
+
+func TestBuiltinCd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lush-cd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// resolve symlinks (eg /tmp on OS X) for comparison with Getwd
+	dir, _ = filepath.EvalSymlinks(dir)
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	oldwd, _ := os.Getwd()
+	defer os.Chdir(oldwd)
+	s := NewSession()
+	var changes []string
+	s.NotifyChdir(func(dir string) {
+		changes = append(changes, dir)
+	})
+	_, err = runInSession(t, s, dir, "cd", "sub")
+	if err != nil {
+		t.Fatal("cd failed:", err)
+	}
+	wd, _ := os.Getwd()
+	if wd != filepath.Join(dir, "sub") {
+		t.Errorf("expected to be in %s/sub, am in %s", dir, wd)
+	}
+	if len(changes) != 1 || changes[0] != wd {
+		t.Errorf("expected one chdir notification for %s, got %q", wd, changes)
+	}
+	out, err := runInSession(t, s, "", "pwd")
+	if err != nil || out != wd+"\n" {
+		t.Errorf("pwd printed %q (error: %v), expected %q", out, err, wd)
+	}
+	_, err = runInSession(t, s, "", "cd", "doesnotexist")
+	if err == nil {
+		t.Error("expected error changing to non-existing dir")
+	}
+}
+
+func TestBuiltinWhich(t *testing.T) {
+	s := NewSession()
+	out, err := runInSession(t, s, "", "which", "cd", "sh")
+	if err != nil {
+		t.Fatal("which failed:", err)
+	}
+	lines := strings.Split(out, "\n")
+	if len(lines) != 3 || lines[0] != "cd: shell builtin" || !strings.HasSuffix(lines[1], "/sh") {
+		t.Errorf("unexpected which output: %q", out)
+	}
+	_, err = runInSession(t, s, "", "which", "lush-does-not-exist")
+	if err == nil {
+		t.Error("expected error for unknown command")
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+// +build linux
+
+package liblush
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+const cgroupMount = "/sys/fs/cgroup"
+
+// period for the cpu.max quota, in microseconds (the kernel default)
+const cgroupCPUPeriod = 100000
+
+// child of our own cgroup that we move into, see cgroupParent
+const cgroupLeaf = "lush"
+
+var cgroupParentDir string
+var cgroupParentLock sync.Mutex
+
+// directory of the cgroup v2 this process belongs to
+func ownCgroup() (string, error) {
+	data, err := ioutil.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		// unified hierarchy is always 0 and has no controller list
+		if strings.HasPrefix(line, "0::") {
+			return filepath.Join(cgroupMount, line[3:]), nil
+		}
+	}
+	return "", errors.New("not in a cgroup v2 hierarchy")
+}
+
+func writeCgroupFile(dir, name, value string) error {
+	return ioutil.WriteFile(filepath.Join(dir, name), []byte(value), 0)
+}
+
+// the cgroup to create command cgroups in, with the memory and cpu controllers
+// enabled for its children. that's our own cgroup, but (except for the root)
+// a cgroup can only hand controllers down if it has no processes of its own.
+// if so, the first time everything in it (us and whatever we started so far)
+// moves to a leaf child, and commands get cgroups next to that.
+func cgroupParent() (string, error) {
+	cgroupParentLock.Lock()
+	defer cgroupParentLock.Unlock()
+	if cgroupParentDir != "" {
+		return cgroupParentDir, nil
+	}
+	own, err := ownCgroup()
+	if err != nil {
+		return "", err
+	}
+	if filepath.Base(own) == cgroupLeaf {
+		// started by a lush that already did this
+		own = filepath.Dir(own)
+	}
+	// children only get the controllers their parent hands down
+	err = writeCgroupFile(own, "cgroup.subtree_control", "+memory +cpu")
+	if pe, ok := err.(*os.PathError); ok && pe.Err == syscall.EBUSY {
+		err = moveToCgroupLeaf(own)
+		if err == nil {
+			err = writeCgroupFile(own, "cgroup.subtree_control", "+memory +cpu")
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("couldn't enable memory and cpu controllers: %v", err)
+	}
+	cgroupParentDir = own
+	return own, nil
+}
+
+// move all processes in a cgroup to its cgroupLeaf child
+func moveToCgroupLeaf(dir string) error {
+	leaf := filepath.Join(dir, cgroupLeaf)
+	err := os.Mkdir(leaf, 0755)
+	if err != nil && !os.IsExist(err) {
+		return err
+	}
+	// processes can be started meanwhile, keep at it until it's empty
+	for tries := 0; ; tries++ {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "cgroup.procs"))
+		if err != nil {
+			return err
+		}
+		pids := strings.Fields(string(data))
+		if len(pids) == 0 {
+			return nil
+		}
+		if tries == 10 {
+			return fmt.Errorf("couldn't empty %s", dir)
+		}
+		for _, pid := range pids {
+			err = writeCgroupFile(leaf, "cgroup.procs", pid)
+			if pe, ok := err.(*os.PathError); ok && pe.Err == syscall.ESRCH {
+				// gone already
+				err = nil
+			}
+			if err != nil {
+				return fmt.Errorf("couldn't move process %s to %s: %v", pid, leaf, err)
+			}
+		}
+	}
+}
+
+// create a cgroup enforcing the memory and CPU caps from l, in our own (see
+// cgroupParent). only works if our cgroup is delegated to us.
+func newCgroup(name string, l Limits) (string, error) {
+	_, err := os.Stat(filepath.Join(cgroupMount, "cgroup.controllers"))
+	if err != nil {
+		return "", errors.New("cgroup v2 not available")
+	}
+	parent, err := cgroupParent()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(parent, name)
+	err = os.Mkdir(dir, 0755)
+	if err != nil {
+		return "", err
+	}
+	if l.Memory != 0 {
+		err = writeCgroupFile(dir, "memory.max", strconv.FormatUint(l.Memory, 10))
+	}
+	if err == nil && l.CPUs != 0 {
+		quota := int(l.CPUs * cgroupCPUPeriod)
+		err = writeCgroupFile(dir, "cpu.max", fmt.Sprintf("%d %d", quota, cgroupCPUPeriod))
+	}
+	if err != nil {
+		os.Remove(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// move a process into a cgroup
+func joinCgroup(dir string, pid int) error {
+	return writeCgroupFile(dir, "cgroup.procs", strconv.Itoa(pid))
+}
+
+// fails if there are still processes in it
+func removeCgroup(dir string) error {
+	return os.Remove(dir)
+}
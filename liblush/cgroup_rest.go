@@ -0,0 +1,24 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+// +build !linux
+
+package liblush
+
+import (
+	"errors"
+	"runtime"
+)
+
+func newCgroup(name string, l Limits) (string, error) {
+	return "", errors.New("cgroups unsupported on " + runtime.GOOS)
+}
+
+func joinCgroup(dir string, pid int) error {
+	return errors.New("cgroups unsupported on " + runtime.GOOS)
+}
+
+func removeCgroup(dir string) error {
+	return nil
+}
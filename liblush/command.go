@@ -12,6 +12,7 @@ import (
 	"os"
 	"os/exec"
 	"sync"
+	"time"
 )
 
 // command life-time phases
@@ -32,16 +33,56 @@ func ParseCmdId(idstr string) (CmdId, error) {
 }
 
 type cmd struct {
-	id      CmdId
+	id CmdId
+	// as set by the user. execCmd.Args is only filled in when the command is
+	// started, because what is actually executed can differ (see
+	// wrapExecHelper).
+	argv    []string
 	execCmd *exec.Cmd
 	status  cmdstatus
 	// Released when command finishes
-	done   sync.WaitGroup
+	done sync.WaitGroup
+	// Closed when command finishes
+	exited chan struct{}
 	stdout *richpipe
 	stderr *richpipe
 	stdin  InStream
 	name   string
 	user   interface{}
+	// indexed by ChainCondition
+	successors [numChainConditions]Cmd
+	chainlock  sync.Mutex
+	timeout    time.Duration
+	// fires when the timeout expires, nil if not running or no timeout. the
+	// generation is bumped on every arming, so a stale timer knows it's stale
+	deadline     *time.Timer
+	deadlinegen  int
+	timeoutlock  sync.Mutex
+	stopsequence []StopStep
+	limits       Limits
+	// directory of the cgroup created for this command, if any
+	cgroup string
+	// never modified, safe to share
+	sandbox *Sandbox
+	// read and write end of the pipe the exec helper waits on, if it does
+	helpersync []*os.File
+	// never modified, safe to share
+	account *Account
+	// nil for commands not created through a session, which can't run
+	// builtins
+	session *session
+	// running a builtin instead of a process
+	builtin bool
+	// argv after expansion, set by Start
+	expandedArgv []string
+	// by index in argv: don't expand
+	literal []bool
+	// see Cmd.SetExpand
+	expand bool
+	// see Watch
+	watch     *Watch
+	watchlock sync.Mutex
+	triggers  triggers
 }
 
 func (c *cmd) Id() CmdId {
@@ -58,17 +99,48 @@ func (c *cmd) SetName(name string) {
 
 func (c *cmd) Argv() []string {
 	// copy
-	return append([]string{}, c.execCmd.Args...)
+	return append([]string{}, c.argv...)
 }
 
 func (c *cmd) SetArgv(argv []string) error {
-	if c.status.started != nil {
+	if c.status.Started() != nil {
 		return errors.New("cannot change arguments after command has started")
 	}
 	if len(argv) == 0 {
 		return errors.New("empty argv list")
 	}
-	c.execCmd.Args = argv
+	c.argv = argv
+	return nil
+}
+
+func (c *cmd) ExpandedArgv() []string {
+	if c.expandedArgv == nil {
+		return nil
+	}
+	return append([]string{}, c.expandedArgv...)
+}
+
+func (c *cmd) LiteralArgs() []bool {
+	return append([]bool{}, c.literal...)
+}
+
+func (c *cmd) SetLiteralArgs(literal []bool) error {
+	if wasStarted(c) {
+		return errors.New("cannot change arguments after command has started")
+	}
+	c.literal = append([]bool{}, literal...)
+	return nil
+}
+
+func (c *cmd) Expand() bool {
+	return c.expand
+}
+
+func (c *cmd) SetExpand(expand bool) error {
+	if wasStarted(c) {
+		return errors.New("cannot change expansion after command has started")
+	}
+	c.expand = expand
 	return nil
 }
 
@@ -79,6 +151,10 @@ func (c *cmd) Cwd() (string, error) {
 	if !isRunning(c) {
 		return "", errors.New("command not running")
 	}
+	if c.builtin {
+		// builtins don't move
+		return c.StartWd(), nil
+	}
 	return getCmdWd(c)
 }
 
@@ -106,12 +182,6 @@ func (c *cmd) Start() error {
 	if wasStarted(c) {
 		return errors.New("command has already been started")
 	}
-	// Lookup the executable
-	p, err := exec.LookPath(c.execCmd.Args[0])
-	if err != nil {
-		p = c.execCmd.Args[0]
-	}
-	c.execCmd.Path = p
 	if c.StartWd() == "" {
 		// No explicit starting dir: starting dir of shell process
 		cwd, err := os.Getwd()
@@ -121,32 +191,186 @@ func (c *cmd) Start() error {
 			c.SetStartWd(cwd)
 		}
 	}
+	argv := c.argv
+	if c.session != nil {
+		argv, err = c.session.expand(argv, c.literal, c.expand, c.StartWd())
+		if err != nil {
+			return c.failStart(err)
+		}
+	}
+	c.expandedArgv = argv
+	// Lookup the executable
+	p, lookErr := exec.LookPath(argv[0])
+	if lookErr != nil {
+		p = argv[0]
+	}
+	c.execCmd.Path = p
+	c.execCmd.Args = argv
+	if b := builtinFor(argv); b != nil && c.session != nil {
+		c.startBuiltin(b)
+		return nil
+	}
+	if c.limits != (Limits{}) || c.sandbox != nil {
+		if lookErr != nil {
+			// the helper wouldn't find it either, but fail less obscurely
+			return c.failStart(lookErr)
+		}
+		err = c.wrapExecHelper()
+		if err != nil {
+			return c.failStart(err)
+		}
+	}
+	// a sandbox maps the account in its user namespace instead
+	if c.account != nil && c.sandbox == nil {
+		err = setCredential(c, c.account)
+		if err != nil {
+			c.removeCgroup()
+			return c.failStart(err)
+		}
+	}
 	err = c.execCmd.Start()
+	// also when starting failed, to clean up
+	releaseErr := c.releaseExecHelper()
+	if err == nil {
+		err = releaseErr
+	}
 	if err != nil {
-		c.status.setErr(err)
-		return err
+		c.removeCgroup()
+		return c.failStart(err)
 	}
 	c.status.startNow()
+	c.timeoutlock.Lock()
+	c.armDeadline()
+	c.timeoutlock.Unlock()
 	// TODO: cute, but needs some unit tests.
 	// also, schizos are always pair programming :D
 	// ... or D:
 	go func() {
 		err := c.execCmd.Wait()
-		c.status.setErr(err)
-		c.stdout.Close()
-		c.stderr.Close()
-		c.status.exitNow()
-		c.done.Done()
+		c.timeoutlock.Lock()
+		if c.deadline != nil {
+			c.deadline.Stop()
+			c.deadline = nil
+		}
+		c.timeoutlock.Unlock()
+		c.removeCgroup()
+		c.exit(err)
+	}()
+	return nil
+}
+
+// wrap up after the command finished with this error
+func (c *cmd) exit(err error) {
+	if err == nil && c.status.TimedOut() {
+		// even if it exits cleanly after being told to stop
+		err = errors.New("timed out")
+	}
+	c.status.setErr(err)
+	c.stdout.Close()
+	c.stderr.Close()
+	// trigger listeners hear about the last output before the exit
+	c.drainTriggers()
+	c.status.exitNow()
+	// before signaling Wait() so callers can rely on successors having been
+	// started once it returns
+	c.startSuccessors()
+	close(c.exited)
+	c.done.Done()
+}
+
+// run a builtin instead of a process. resource limits, sandbox and account
+// don't apply: it runs as part of this process.
+func (c *cmd) startBuiltin(b Builtin) {
+	c.builtin = true
+	// read end of the stdin pipe, normally closed by exec.Cmd
+	stdin := c.execCmd.Stdin.(io.ReadCloser)
+	ctx := &BuiltinContext{
+		Cmd:     c,
+		Session: c.session,
+		Argv:    c.ExpandedArgv(),
+		Dir:     c.StartWd(),
+		Stdin:   stdin,
+		Stdout:  c.stdout,
+		Stderr:  c.stderr,
+	}
+	c.status.startNow()
+	go func() {
+		err := b(ctx)
+		stdin.Close()
+		c.exit(err)
 	}()
+}
+
+// record a failure to start. failing to start is a failure like any other as
+// far as chains and status listeners go: it exits without ever starting.
+func (c *cmd) failStart(err error) error {
+	c.status.setErr(err)
+	c.status.exitNow()
+	c.startSuccessors()
+	close(c.exited)
+	c.done.Done()
+	return err
+}
+
+func (c *cmd) removeCgroup() {
+	if c.cgroup == "" {
+		return
+	}
+	err := removeCgroup(c.cgroup)
+	if err != nil {
+		log.Printf("Failed to remove cgroup of command %d: %v", c.id, err)
+	}
+	c.cgroup = ""
+}
+
+func (c *cmd) Limits() Limits {
+	return c.limits
+}
+
+func (c *cmd) SetLimits(l Limits) error {
+	if c.status.Started() != nil {
+		return errors.New("cannot change resource limits after command has started")
+	}
+	c.limits = l
 	return nil
 }
 
+func (c *cmd) Sandbox() *Sandbox {
+	return c.sandbox
+}
+
+func (c *cmd) Account() *Account {
+	return c.account
+}
+
+// copies, because the watcher of this command reads it from another goroutine
+func copyWatch(w *Watch) *Watch {
+	if w == nil {
+		return nil
+	}
+	w2 := *w
+	w2.Paths = append([]string{}, w.Paths...)
+	return &w2
+}
+
+func (c *cmd) Watch() *Watch {
+	c.watchlock.Lock()
+	defer c.watchlock.Unlock()
+	return copyWatch(c.watch)
+}
+
+func (c *cmd) SetWatch(w *Watch) {
+	c.watchlock.Lock()
+	defer c.watchlock.Unlock()
+	c.watch = copyWatch(w)
+}
+
 func (c *cmd) Wait() error {
-	if c.status.started == nil {
+	if c.status.Started() == nil {
 		return errors.New("must start command before calling Wait()")
 	}
 	c.done.Wait()
-	return c.status.err
+	return c.status.Err()
 }
 
 func (c *cmd) Stdin() InStream {
@@ -173,16 +397,156 @@ func (c *cmd) SetUserData(data interface{}) {
 	c.user = data
 }
 
+func (c *cmd) Successor(cond ChainCondition) Cmd {
+	c.chainlock.Lock()
+	defer c.chainlock.Unlock()
+	return c.successors[cond]
+}
+
+func (c *cmd) SetSuccessor(cond ChainCondition, next Cmd) {
+	c.chainlock.Lock()
+	defer c.chainlock.Unlock()
+	c.successors[cond] = next
+}
+
+func (c *cmd) Timeout() time.Duration {
+	c.timeoutlock.Lock()
+	defer c.timeoutlock.Unlock()
+	return c.timeout
+}
+
+func (c *cmd) SetTimeout(d time.Duration) {
+	c.timeoutlock.Lock()
+	defer c.timeoutlock.Unlock()
+	c.timeout = d
+	c.armDeadline()
+}
+
+// (re)schedule the deadline timer according to the current timeout. only
+// does something while the command is running. caller must hold timeoutlock.
+func (c *cmd) armDeadline() {
+	if c.deadline != nil {
+		c.deadline.Stop()
+		c.deadline = nil
+	}
+	// builtins can't be stopped
+	if c.timeout <= 0 || !isRunning(c) || c.builtin {
+		return
+	}
+	// negative durations fire immediately, which is exactly right
+	left := c.status.Started().Add(c.timeout).Sub(time.Now())
+	c.deadlinegen++
+	gen := c.deadlinegen
+	c.deadline = time.AfterFunc(left, func() { c.expire(gen) })
+}
+
+// called when the command has run out of time
+func (c *cmd) expire(gen int) {
+	c.timeoutlock.Lock()
+	// disarmed or rearmed while firing: the command exited or got more time
+	current := c.deadline != nil && c.deadlinegen == gen
+	if current {
+		c.status.setTimedOut()
+	}
+	c.timeoutlock.Unlock()
+	if !current {
+		return
+	}
+	c.status.changed()
+	err := c.Stop(nil)
+	if err != nil {
+		log.Printf("Failed to stop command %d after timeout: %v", c.id, err)
+	}
+}
+
+func (c *cmd) StopSequence() []StopStep {
+	return append([]StopStep{}, c.stopsequence...)
+}
+
+func (c *cmd) SetStopSequence(seq []StopStep) {
+	c.stopsequence = append([]StopStep{}, seq...)
+}
+
+func (c *cmd) Stop(progress func(StopStep, error)) error {
+	seq := c.StopSequence()
+	if len(seq) == 0 {
+		return errors.New("empty stop sequence")
+	}
+	err := c.Signal(seq[0].Signal)
+	if err != nil {
+		return err
+	}
+	if progress != nil {
+		progress(seq[0], nil)
+	}
+	go func() {
+		for i := 1; i < len(seq); i++ {
+			select {
+			case <-c.exited:
+				return
+			case <-time.After(seq[i-1].Wait):
+			}
+			err := c.Signal(seq[i].Signal)
+			if progress != nil {
+				progress(seq[i], err)
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// clear every link from this command to the given successor
+func (c *cmd) dropSuccessor(next Cmd) {
+	c.chainlock.Lock()
+	defer c.chainlock.Unlock()
+	for i, s := range c.successors {
+		if s == next {
+			c.successors[i] = nil
+		}
+	}
+}
+
+// does the (final) status of a command satisfy this condition?
+func (cond ChainCondition) matches(s CmdStatus) bool {
+	switch cond {
+	case OnSuccess:
+		return s.Success()
+	case OnFailure:
+		return !s.Success()
+	}
+	return true
+}
+
+// start all successors whose condition matches how this command ended. errors
+// are logged, not returned: nobody is around to receive them. the successor's
+// own status reflects the failure anyway.
+func (c *cmd) startSuccessors() {
+	for cond := OnExit; cond < numChainConditions; cond++ {
+		next := c.Successor(cond)
+		if next == nil || !cond.matches(&c.status) {
+			continue
+		}
+		err := next.Start()
+		if err != nil {
+			log.Printf("Failed to start successor %d of command %d: %v",
+				next.Id(), c.id, err)
+		}
+	}
+}
+
 // WARNING: CODE SMELL. all code using this function is almost certainly
 // race sensitive.
 // TODO: refactor that code and remove this function
 func isRunning(c *cmd) bool {
-	return c.status.started != nil && c.status.exited == nil
+	return c.status.Started() != nil && c.status.Exited() == nil
 }
 
 // TODO: see isRunning about race &c
 func wasStarted(c *cmd) bool {
-	return c.status.started != nil || c.status.err != nil
+	return c.status.Started() != nil || c.status.Err() != nil
 }
 
 func (c *cmd) Signal(sig os.Signal) error {
@@ -190,6 +554,9 @@ func (c *cmd) Signal(sig os.Signal) error {
 	if !isRunning(c) {
 		return errors.New("can only send signal to running command")
 	}
+	if c.builtin {
+		return errors.New("cannot send signal to builtin command")
+	}
 	return c.execCmd.Process.Signal(sig)
 }
 
@@ -235,6 +602,44 @@ func (d devnull) Close() error {
 	return nil
 }
 
+// Fresh command with the same argv, literal and expand flags, name, starting
+// directory, environment, scrollback sizes and modes, userdata, timeout, stop
+// sequence, resource limits, sandbox, watch, triggers and stdout / stderr
+// listeners as this one. Status, scrollback contents, trigger matches, peekers
+// and successors are not copied: that's what makes it fresh.
+func (c *cmd) clone(id CmdId) (*cmd, error) {
+	execCmd := &exec.Cmd{
+		Args: c.Argv(),
+		Env:  append([]string{}, c.execCmd.Env...),
+		Dir:  c.StartWd(),
+	}
+	c2, err := newcmd(id, execCmd)
+	if err != nil {
+		return nil, err
+	}
+	c2.literal = c.LiteralArgs()
+	c2.expand = c.expand
+	c2.name = c.name
+	c2.user = c.user
+	c2.timeout = c.Timeout()
+	c2.stopsequence = c.StopSequence()
+	c2.watch = c.Watch()
+	c2.triggers.list = c.Triggers()
+	c2.limits = c.limits
+	c2.sandbox = c.sandbox
+	c2.account = c.account
+	c2.session = c.session
+	c2.stdout.SetListener(c.stdout.GetListener())
+	c2.stderr.SetListener(c.stderr.GetListener())
+	c2.stdout.Scrollback().Resize(c.stdout.Scrollback().Size())
+	c2.stderr.Scrollback().Resize(c.stderr.Scrollback().Size())
+	c2.stdout.SetScrollbackLines(c.stdout.ScrollbackLines())
+	c2.stderr.SetScrollbackLines(c.stderr.ScrollbackLines())
+	c2.stdout.SetRecordMode(c.stdout.RecordMode())
+	c2.stderr.SetRecordMode(c.stderr.RecordMode())
+	return c2, nil
+}
+
 // stdout and stderr data is discarded by default, call Stdout/err().SetPipe()
 // to save
 func newcmd(id CmdId, execCmd *exec.Cmd) (*cmd, error) {
@@ -244,15 +649,21 @@ func newcmd(id CmdId, execCmd *exec.Cmd) (*cmd, error) {
 	}
 	c := &cmd{
 		id:      id,
+		argv:    execCmd.Args,
 		execCmd: execCmd,
 		stdout:  newRichPipe(Devnull, 1000),
 		stderr:  newRichPipe(Devnull, 1000),
+		exited:  make(chan struct{}),
+		// copy to protect the default from tinkering
+		stopsequence: append([]StopStep{}, DefaultStopSequence...),
 	}
 	// by doing this here it is guaranteed you can start writing to a new
 	// command's stdin, even before it is started.
 	c.stdin = newLightPipe(c, pw)
 	c.execCmd.Stdout = c.stdout
 	c.execCmd.Stderr = c.stderr
+	c.stdout.Peeker().AddWriter(&triggerPeeker{c: c, stream: "stdout"})
+	c.stderr.Peeker().AddWriter(&triggerPeeker{c: c, stream: "stderr"})
 	c.name = c.execCmd.Path
 	c.done.Add(1)
 	return c, nil
@@ -7,9 +7,11 @@ package liblush
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"regexp"
+	"runtime"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -332,3 +334,266 @@ func TestCommandStartWd(t *testing.T) {
 		t.Errorf("command start dir not in root: %q", c.StartWd())
 	}
 }
+
+// echo a && echo b; nonexistingcmd || echo c
+func TestCommandSuccessor(t *testing.T) {
+	var b bytes.Buffer
+	first := echoCmd("a")
+	onsuccess := echoCmd("b")
+	onfailure := echoCmd("never")
+	onsuccess.Stdout().SetListener(&b)
+	first.SetSuccessor(OnSuccess, onsuccess)
+	first.SetSuccessor(OnFailure, onfailure)
+	err := first.Run()
+	if err != nil {
+		t.Fatalf("error running command: %v", err)
+	}
+	err = onsuccess.Wait()
+	if err != nil {
+		t.Fatalf("error running successor: %v", err)
+	}
+	if b.String() != "b\n" {
+		t.Errorf("unexpected output from successor: %q", b.String())
+	}
+	if onfailure.Status().Started() != nil {
+		t.Errorf("failure successor started after successful command")
+	}
+	b.Reset()
+	broken := newcmdPanicOnError(0, exec.Command("cecinestpasuncommand"))
+	fallback := echoCmd("c")
+	fallback.Stdout().SetListener(&b)
+	broken.SetSuccessor(OnFailure, fallback)
+	err = broken.Start()
+	if err == nil {
+		t.Fatalf("expected error starting non-existing command")
+	}
+	err = fallback.Wait()
+	if err != nil {
+		t.Fatalf("error running fallback successor: %v", err)
+	}
+	if b.String() != "c\n" {
+		t.Errorf("unexpected output from fallback: %q", b.String())
+	}
+}
+
+func TestCommandClone(t *testing.T) {
+	var b bytes.Buffer
+	c := echoCmd("once", "more")
+	c.SetName("encore")
+	c.SetUserData("opaque")
+	c.Stdout().SetListener(&b)
+	c.Stdout().Scrollback().Resize(123)
+	c.Stderr().SetScrollbackLines(10)
+	err := c.Run()
+	if err != nil {
+		t.Fatalf("error running command: %v", err)
+	}
+	c2, err := c.clone(1)
+	if err != nil {
+		t.Fatalf("error cloning command: %v", err)
+	}
+	if c2.Status().Started() != nil {
+		t.Errorf("clone must not inherit status of original")
+	}
+	if c2.Name() != "encore" || c2.UserData() != "opaque" {
+		t.Errorf("clone did not copy name or userdata: %q, %v", c2.Name(),
+			c2.UserData())
+	}
+	if c2.Stdout().Scrollback().Size() != 123 {
+		t.Errorf("clone did not copy scrollback size: %d",
+			c2.Stdout().Scrollback().Size())
+	}
+	if c2.Stdout().ScrollbackLines() != 0 || c2.Stderr().ScrollbackLines() != 10 {
+		t.Errorf("clone did not copy scrollback modes: %d, %d",
+			c2.Stdout().ScrollbackLines(), c2.Stderr().ScrollbackLines())
+	}
+	if c2.StartWd() != c.StartWd() {
+		t.Errorf("clone starts in %q, original in %q", c2.StartWd(), c.StartWd())
+	}
+	err = c2.Run()
+	if err != nil {
+		t.Fatalf("error running clone: %v", err)
+	}
+	if b.String() != "once more\nonce more\n" {
+		t.Errorf("unexpected output from original and clone: %q", b.String())
+	}
+}
+
+func TestCommandTimeout(t *testing.T) {
+	c := newcmdPanicOnError(0, exec.Command("sleep", "10"))
+	c.SetTimeout(100 * time.Millisecond)
+	start := time.Now()
+	err := c.Run()
+	if err == nil {
+		t.Errorf("expected error from command that ran out of time")
+	}
+	if !c.Status().TimedOut() {
+		t.Errorf("status does not reflect timeout: %#v", c.Status())
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("command with 100ms timeout ran for %v", d)
+	}
+	// a timeout that doesn't expire leaves no trace
+	c = echoCmd("quick")
+	c.SetTimeout(time.Minute)
+	err = c.Run()
+	if err != nil {
+		t.Errorf("error running command: %v", err)
+	}
+	if c.Status().TimedOut() {
+		t.Errorf("command timed out before its deadline")
+	}
+}
+
+// running out of time is a failure, even if the command exits cleanly when
+// it's told to stop
+func TestCommandTimeoutCleanExit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no signals to trap on windows")
+	}
+	c := newcmdPanicOnError(0, exec.Command("sh", "-c", "trap 'exit 0' INT; sleep 10 >/dev/null 2>&1 & wait"))
+	c.SetStopSequence([]StopStep{
+		{os.Interrupt, 5 * time.Second},
+		{os.Kill, 0},
+	})
+	// give the shell some time to set up its trap
+	c.SetTimeout(200 * time.Millisecond)
+	onsuccess := echoCmd("success")
+	onfailure := echoCmd("failure")
+	c.SetSuccessor(OnSuccess, onsuccess)
+	c.SetSuccessor(OnFailure, onfailure)
+	err := c.Run()
+	if err == nil || c.Status().Success() || !c.Status().TimedOut() {
+		t.Errorf("expected timeout failure, got %v (%#v)", err, c.Status())
+	}
+	if onsuccess.Status().Started() != nil || onfailure.Status().Started() == nil {
+		t.Errorf("expected only the failure successor to start")
+	}
+	onfailure.Wait()
+}
+
+// a command that ignores the first signal must get the second
+func TestCommandStopEscalation(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no signals to escalate on windows")
+	}
+	// ignored signals stay ignored across exec
+	c := newcmdPanicOnError(0, exec.Command("sh", "-c", "trap '' INT; exec sleep 10"))
+	c.SetStopSequence([]StopStep{
+		{os.Interrupt, 200 * time.Millisecond},
+		{os.Kill, 0},
+	})
+	err := c.Start()
+	if err != nil {
+		t.Fatalf("error starting command: %v", err)
+	}
+	// give the shell some time to set up its trap
+	time.Sleep(100 * time.Millisecond)
+	sent := make(chan os.Signal, 10)
+	err = c.Stop(func(step StopStep, err error) {
+		if err != nil {
+			t.Errorf("error sending %v: %v", step.Signal, err)
+		}
+		sent <- step.Signal
+	})
+	if err != nil {
+		t.Fatalf("error stopping command: %v", err)
+	}
+	c.Wait()
+	for _, expected := range []os.Signal{os.Interrupt, os.Kill} {
+		select {
+		case sig := <-sent:
+			if sig != expected {
+				t.Errorf("expected %v, got %v", expected, sig)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%v never sent", expected)
+		}
+	}
+}
+
+func TestCommandLimits(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("resource limits not supported on this platform")
+	}
+	var b bytes.Buffer
+	c := newcmdPanicOnError(0, exec.Command("sh", "-c", "ulimit -n; nice"))
+	err := c.SetLimits(Limits{OpenFiles: 64, Nice: 5})
+	if err != nil {
+		t.Fatalf("error setting limits: %v", err)
+	}
+	c.Stdout().SetListener(&b)
+	err = c.Run()
+	if err != nil {
+		t.Fatalf("error running command: %v", err)
+	}
+	// nice reports the absolute level, ours may not be 0
+	if !regexp.MustCompile(`^64\n\d+\n$`).MatchString(b.String()) {
+		t.Errorf("unexpected limits in child: %q", b.String())
+	}
+	if argv := c.Argv(); len(argv) != 3 || argv[0] != "sh" {
+		t.Errorf("exec helper leaked into argv: %q", argv)
+	}
+	err = c.SetLimits(Limits{})
+	if err == nil {
+		t.Errorf("expected error changing limits after start")
+	}
+}
+
+func TestCommandSandbox(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("sandbox not supported on this platform")
+	}
+	hidden, err := ioutil.TempDir("", "lush-sandbox-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(hidden)
+	var stdout, stderr bytes.Buffer
+	// pid 1 is the exec helper, in a process tree of its own
+	script := "head -c 16 /proc/1/cmdline; echo; test -w /usr || echo readonly; test -e " + hidden + " || echo hidden"
+	c := newcmdPanicOnError(0, exec.Command("sh", "-c", script))
+	c.sandbox = &Sandbox{Dirs: []string{"/bin", "/lib", "/lib64", "/usr"}}
+	c.Stdout().SetListener(&stdout)
+	c.Stderr().SetListener(&stderr)
+	err = c.Start()
+	if err != nil {
+		t.Skipf("can't create namespaces here: %v", err)
+	}
+	err = c.Wait()
+	if err != nil {
+		t.Fatalf("error running sandboxed command: %v (stderr: %q)", err,
+			stderr.String())
+	}
+	if stdout.String() != "lush-exec-helper\nreadonly\nhidden\n" {
+		t.Errorf("unexpected output from sandboxed command: %q", stdout.String())
+	}
+}
+
+func TestCommandAccount(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("must be root to run commands as another user")
+	}
+	a, err := LookupAccount("nobody")
+	if err != nil {
+		t.Skipf("no account to test with: %v", err)
+	}
+	s := NewSession()
+	s.SetAccount(a)
+	var b bytes.Buffer
+	c := s.NewCommand("sh", "-c", `id -u; echo "$USER"; echo "$HOME"`)
+	// the test's own wd might not be accessible for nobody
+	c.(*cmd).SetStartWd("/")
+	c.Stdout().SetListener(&b)
+	err = c.Run()
+	if err != nil {
+		t.Fatalf("error running command as %s: %v", a.Name, err)
+	}
+	expected := fmt.Sprintf("%d\n%s\n%s\n", a.Uid, a.Name, a.Home)
+	if b.String() != expected {
+		t.Errorf("expected %q, got %q", expected, b.String())
+	}
+	if c.Account() != s.Account() {
+		t.Errorf("command didn't inherit the session's account")
+	}
+}
@@ -0,0 +1,20 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+// +build !linux,!darwin
+
+package liblush
+
+import (
+	"errors"
+	"runtime"
+)
+
+func (c *cmd) wrapExecHelper() error {
+	return errors.New("resource limits unsupported on " + runtime.GOOS)
+}
+
+func (c *cmd) releaseExecHelper() error {
+	return nil
+}
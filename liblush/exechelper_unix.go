@@ -0,0 +1,165 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+// +build linux darwin
+
+package liblush
+
+// Go offers no way to run code in a child process between fork and exec, and
+// setting resource limits on a child after it has started is racy: it could
+// do anything before the limits kick in. So commands that need limits are
+// started through this very binary instead, which applies the limits to
+// itself and then execs the real command. The hook is an init() function, so
+// it works for every program that imports liblush, tests included.
+//
+// Sandboxed commands go through the same helper, which then also sets up the
+// sandbox's file system before starting the command (see sandbox_linux.go).
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"syscall"
+)
+
+// argv[0] of the exec helper process
+const execHelperName = "lush-exec-helper"
+
+type execHelperConfig struct {
+	// Executable to run once everything is set up
+	Path   string
+	Limits Limits
+	// Block on fd 3 until the parent closes it. The parent moves us into
+	// our cgroup meanwhile, see releaseExecHelper.
+	AwaitParent bool
+	Sandbox     *Sandbox
+}
+
+func init() {
+	if len(os.Args) < 2 || os.Args[0] != execHelperName {
+		return
+	}
+	err := runExecHelper(os.Args[1], os.Args[2:])
+	// only returns on error
+	fmt.Fprintf(os.Stderr, "lush: %v\n", err)
+	os.Exit(127)
+}
+
+// set up the environment for a command and replace this process by it
+func runExecHelper(configJSON string, argv []string) error {
+	var cfg execHelperConfig
+	err := json.Unmarshal([]byte(configJSON), &cfg)
+	if err != nil {
+		return fmt.Errorf("corrupt exec helper config: %v", err)
+	}
+	if cfg.AwaitParent {
+		// joining the cgroup ourselves only works if we're allowed to
+		// write to our current cgroup, which is not the case when running
+		// as another user than lush.
+		f := os.NewFile(3, "parent")
+		_, err = ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("waiting for parent: %v", err)
+		}
+	}
+	rlimits := map[int]uint64{
+		syscall.RLIMIT_AS:     cfg.Limits.AddressSpace,
+		syscall.RLIMIT_CPU:    cfg.Limits.CPUTime,
+		syscall.RLIMIT_NOFILE: cfg.Limits.OpenFiles,
+	}
+	for resource, max := range rlimits {
+		if max == 0 {
+			continue
+		}
+		err = syscall.Setrlimit(resource, &syscall.Rlimit{Cur: max, Max: max})
+		if err != nil {
+			return fmt.Errorf("failed to set resource limit %d to %d: %v",
+				resource, max, err)
+		}
+	}
+	if cfg.Limits.Nice != 0 {
+		err = syscall.Setpriority(syscall.PRIO_PROCESS, 0, cfg.Limits.Nice)
+		if err != nil {
+			return fmt.Errorf("failed to set nice level: %v", err)
+		}
+	}
+	if cfg.Sandbox != nil {
+		err = enterSandbox(cfg.Sandbox)
+		if err != nil {
+			return fmt.Errorf("failed to set up sandbox: %v", err)
+		}
+		// as PID 1 of the sandbox we can't just exec: init ignores
+		// signals it doesn't handle, which would make it unstoppable.
+		return superviseChild(cfg.Path, argv)
+	}
+	return syscall.Exec(cfg.Path, argv, os.Environ())
+}
+
+// make the command start through the exec helper, which applies its resource
+// limits and sandbox before executing it. expects execCmd.Path to be resolved.
+func (c *cmd) wrapExecHelper() error {
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("couldn't find own executable: %v", err)
+	}
+	cfg := execHelperConfig{
+		Path:    c.execCmd.Path,
+		Limits:  c.limits,
+		Sandbox: c.sandbox,
+	}
+	if c.sandbox != nil {
+		c.execCmd.SysProcAttr, err = sandboxSysProcAttr(c.sandbox, c.account)
+		if err != nil {
+			return err
+		}
+	}
+	if c.limits.Memory != 0 || c.limits.CPUs != 0 {
+		name := fmt.Sprintf("lush-%d-%d", os.Getpid(), c.id)
+		c.cgroup, err = newCgroup(name, c.limits)
+		if err != nil {
+			return fmt.Errorf("failed to create cgroup: %v", err)
+		}
+		r, w, err := os.Pipe()
+		if err != nil {
+			c.removeCgroup()
+			return err
+		}
+		c.execCmd.ExtraFiles = []*os.File{r}
+		c.helpersync = []*os.File{r, w}
+		cfg.AwaitParent = true
+	}
+	cfgjson, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	c.execCmd.Path = self
+	c.execCmd.Args = append([]string{execHelperName, string(cfgjson)}, c.argv...)
+	return nil
+}
+
+// called after starting the exec helper, whether that succeeded or not. puts
+// the helper in its cgroup and lets it continue.
+func (c *cmd) releaseExecHelper() error {
+	if c.helpersync == nil {
+		return nil
+	}
+	r, w := c.helpersync[0], c.helpersync[1]
+	c.helpersync = nil
+	defer w.Close()
+	r.Close()
+	if c.execCmd.Process == nil {
+		// didn't start
+		return nil
+	}
+	err := joinCgroup(c.cgroup, c.execCmd.Process.Pid)
+	if err != nil {
+		// it continues once w is closed: don't let it run uncapped
+		c.execCmd.Process.Kill()
+		c.execCmd.Wait()
+		return fmt.Errorf("failed to join cgroup: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package liblush
+
+// Expansion of argv when a command starts, roughly like an unquoted word in
+// sh, in this order:
+//
+//     braces      a{b,c}d -> abd acd, and {1..3} -> 1 2 3
+//     tilde       ~/foo and ~user/foo
+//     variables   $NAME and ${NAME}, from the session environment. unset is
+//                 empty. no word splitting of the value.
+//     globs       *, ? and [...], relative to the starting dir. no match
+//                 leaves the word as it is.
+//
+// Anything that doesn't parse is left alone rather than an error. Only done
+// for commands that ask for it, see Cmd.SetExpand, and arguments can opt out
+// entirely, see Cmd.SetLiteralArgs.
+
+import (
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type expander struct {
+	env map[string]string
+	// starting dir, for globs
+	dir string
+}
+
+// index of the } closing the { at word[open], and the positions of the
+// commas at the top level in between. -1 if it's not closed.
+func matchBrace(word string, open int) (int, []int) {
+	depth := 0
+	var commas []int
+	for i := open; i < len(word); i++ {
+		switch word[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i, commas
+			}
+		case ',':
+			if depth == 1 {
+				commas = append(commas, i)
+			}
+		}
+	}
+	return -1, nil
+}
+
+var braceRangeRegexp = regexp.MustCompile(`^(-?[0-9]+)\.\.(-?[0-9]+)$`)
+
+// alternatives inside a pair of braces without commas, if it's a range
+func braceRange(body string) []string {
+	m := braceRangeRegexp.FindStringSubmatch(body)
+	if m == nil {
+		return nil
+	}
+	from, err1 := strconv.Atoi(m[1])
+	to, err2 := strconv.Atoi(m[2])
+	if err1 != nil || err2 != nil {
+		return nil
+	}
+	step := 1
+	if to < from {
+		step = -1
+	}
+	var alts []string
+	for i := from; ; i += step {
+		alts = append(alts, strconv.Itoa(i))
+		if i == to {
+			return alts
+		}
+	}
+}
+
+func expandBraces(word string) []string {
+	for open := strings.IndexByte(word, '{'); open != -1; {
+		close, commas := matchBrace(word, open)
+		if close == -1 {
+			break
+		}
+		var alts []string
+		if commas == nil {
+			alts = braceRange(word[open+1 : close])
+		} else {
+			start := open + 1
+			for _, comma := range append(commas, close) {
+				alts = append(alts, word[start:comma])
+				start = comma + 1
+			}
+		}
+		if alts == nil {
+			// {foo} is just that, but there could be braces inside
+			next := strings.IndexByte(word[open+1:], '{')
+			if next == -1 {
+				break
+			}
+			open += 1 + next
+			continue
+		}
+		var words []string
+		prefix, suffix := word[:open], word[close+1:]
+		for _, alt := range alts {
+			// the alternatives and the rest can contain braces, too
+			words = append(words, expandBraces(prefix+alt+suffix)...)
+		}
+		return words
+	}
+	return []string{word}
+}
+
+func (e *expander) tilde(word string) string {
+	if !strings.HasPrefix(word, "~") {
+		return word
+	}
+	name, rest := word[1:], ""
+	if i := strings.IndexByte(name, '/'); i != -1 {
+		name, rest = name[:i], name[i:]
+	}
+	var home string
+	if name == "" {
+		home = e.env["HOME"]
+	} else if u, err := user.Lookup(name); err == nil {
+		home = u.HomeDir
+	}
+	if home == "" {
+		return word
+	}
+	return home + rest
+}
+
+var varRegexp = regexp.MustCompile(`\$([A-Za-z_][A-Za-z0-9_]*|\{[A-Za-z_][A-Za-z0-9_]*\})`)
+
+func (e *expander) variables(word string) string {
+	return varRegexp.ReplaceAllStringFunc(word, func(v string) string {
+		return e.env[strings.Trim(v, "${}")]
+	})
+}
+
+// hidden files only match a pattern component that starts with a dot
+func hiddenMismatch(pattern, match string) bool {
+	pparts := strings.Split(pattern, string(filepath.Separator))
+	mparts := strings.Split(match, string(filepath.Separator))
+	if len(pparts) != len(mparts) {
+		return false
+	}
+	for i, p := range pparts {
+		if strings.HasPrefix(mparts[i], ".") && !strings.HasPrefix(p, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *expander) glob(word string) []string {
+	if !strings.ContainsAny(word, "*?[") {
+		return []string{word}
+	}
+	pattern := word
+	rel := !filepath.IsAbs(word)
+	if rel {
+		pattern = filepath.Join(e.dir, word)
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil || matches == nil {
+		return []string{word}
+	}
+	var words []string
+	for _, m := range matches {
+		if rel {
+			m, err = filepath.Rel(e.dir, m)
+			if err != nil {
+				continue
+			}
+		}
+		if !hiddenMismatch(filepath.Clean(word), m) {
+			words = append(words, m)
+		}
+	}
+	if words == nil {
+		return []string{word}
+	}
+	return words
+}
+
+// all words this one expands to
+func (e *expander) word(word string) []string {
+	var words []string
+	for _, w := range expandBraces(word) {
+		w = e.variables(e.tilde(w))
+		words = append(words, e.glob(w)...)
+	}
+	return words
+}
+
+// expand every argument not marked literal
+func (e *expander) argv(argv []string, literal []bool) []string {
+	var expanded []string
+	for i, arg := range argv {
+		if i < len(literal) && literal[i] {
+			expanded = append(expanded, arg)
+		} else {
+			expanded = append(expanded, e.word(arg)...)
+		}
+	}
+	return expanded
+}
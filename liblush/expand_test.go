@@ -0,0 +1,94 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package liblush
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandBraces(t *testing.T) {
+	for word, expected := range map[string]string{
+		"plain":        "[plain]",
+		"a{b,c}d":      "[abd acd]",
+		"{a,b}{1,2}":   "[a1 a2 b1 b2]",
+		"x{a,b{c,d}}":  "[xa xbc xbd]",
+		"{,.go}":       "[ .go]",
+		"f{3..1}":      "[f3 f2 f1]",
+		"{foo}":        "[{foo}]",
+		"{foo}{a,b}":   "[{foo}a {foo}b]",
+		"unclosed{a,b": "[unclosed{a,b]",
+	} {
+		if got := fmt.Sprint(expandBraces(word)); got != expected {
+			t.Errorf("%s: expected %s, got %s", word, expected, got)
+		}
+	}
+}
+
+func TestExpandWords(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lush-expand")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.go", "b.go", "c.txt", ".hidden.go", "sub/d.go"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+		ioutil.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+	e := expander{
+		env: map[string]string{"HOME": "/home/lush", "FOO": "foo bar"},
+		dir: dir,
+	}
+	argv := []string{"echo", "~/x", "$FOO", "${FOO}s", "$NOPE.", "$1", "*.go",
+		".*.go", "*/*.go", "*.none", "{a,c}.*", dir + "/*.txt", "$HOME", "*.go"}
+	literal := make([]bool, len(argv))
+	literal[len(literal)-1] = true
+	expected := []string{"echo", "/home/lush/x", "foo bar", "foo bars", ".",
+		"$1", "a.go", "b.go", ".hidden.go", "sub/d.go", "*.none", "a.go",
+		"c.txt", dir + "/c.txt", "/home/lush", "*.go"}
+	got := e.argv(argv, literal)
+	if strings.Join(got, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestCommandExpandedArgv(t *testing.T) {
+	s := NewSession()
+	s.Setenv("LUSHTEST", "value")
+	s.SetAlias("show", []string{"echo", "$1", "$LUSHTEST"})
+	c := s.NewCommand("show", "$LUSHTEST")
+	c.SetLiteralArgs([]bool{false, true})
+	c.SetExpand(true)
+	// only aliases unless asked for
+	plain := s.NewCommand("show", "$LUSHTEST")
+	err := plain.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(plain.ExpandedArgv()); got != "[echo $LUSHTEST $LUSHTEST]" {
+		t.Errorf("expanded without SetExpand: %s", got)
+	}
+	err = c.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "[echo $LUSHTEST value]"
+	if got := fmt.Sprint(c.ExpandedArgv()); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+	if got := fmt.Sprint(c.Argv()); got != "[show $LUSHTEST]" {
+		t.Errorf("argv changed by expansion: %s", got)
+	}
+	if c.SetLiteralArgs(nil) == nil {
+		t.Error("expected error changing literal flags after start")
+	}
+	if c.SetExpand(false) == nil {
+		t.Error("expected error changing expansion after start")
+	}
+}
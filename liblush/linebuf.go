@@ -0,0 +1,185 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package liblush
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"unicode/utf8"
+)
+
+// scrollback of whole lines, see LineBuffer
+type linebuf struct {
+	l sync.Mutex
+	// complete lines, oldest first, including the newline
+	lines [][]byte
+	// incomplete last line
+	partial []byte
+	// bytes in lines and partial
+	size     int
+	maxlines int
+	maxbytes int
+}
+
+// number of lines including the incomplete one. caller must hold the lock.
+func (b *linebuf) numLines() int {
+	n := len(b.lines)
+	if len(b.partial) > 0 {
+		n++
+	}
+	return n
+}
+
+// drop old lines until everything fits. the only line left is cut rather than
+// dropped, on a character boundary. caller must hold the lock.
+func (b *linebuf) trim() {
+	for len(b.lines) > 0 && (b.numLines() > b.maxlines || b.size > b.maxbytes) {
+		if b.size > b.maxbytes && b.numLines() == 1 {
+			line := cutLine(b.lines[0], b.size-b.maxbytes)
+			if len(line) == 0 {
+				// no room at all
+				b.lines = nil
+			} else {
+				b.lines[0] = line
+			}
+			b.size = len(line)
+			return
+		}
+		b.size -= len(b.lines[0])
+		b.lines[0] = nil
+		b.lines = b.lines[1:]
+	}
+	if b.size > b.maxbytes {
+		// only the incomplete line is left
+		b.partial = cutLine(b.partial, b.size-b.maxbytes)
+		b.size = len(b.partial)
+	}
+}
+
+// remove at least n bytes from the start of this line, without splitting a
+// character
+func cutLine(line []byte, n int) []byte {
+	for n < len(line) && !utf8.RuneStart(line[n]) {
+		n++
+	}
+	if n > len(line) {
+		n = len(line)
+	}
+	return append([]byte(nil), line[n:]...)
+}
+
+// entire contents. caller must hold the lock.
+func (b *linebuf) contents() []byte {
+	buf := make([]byte, 0, b.size)
+	for _, line := range b.lines {
+		buf = append(buf, line...)
+	}
+	return append(buf, b.partial...)
+}
+
+func (b *linebuf) Size() int {
+	b.l.Lock()
+	defer b.l.Unlock()
+	return b.maxbytes
+}
+
+func (b *linebuf) Resize(i int) {
+	b.l.Lock()
+	defer b.l.Unlock()
+	b.maxbytes = i
+	b.trim()
+}
+
+func (b *linebuf) Last(p []byte) int {
+	b.l.Lock()
+	defer b.l.Unlock()
+	buf := b.contents()
+	if len(p) < len(buf) {
+		buf = buf[len(buf)-len(p):]
+	}
+	return copy(p, buf)
+}
+
+func (b *linebuf) Write(data []byte) (int, error) {
+	b.l.Lock()
+	defer b.l.Unlock()
+	n := len(data)
+	b.size += n
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i == -1 {
+			b.partial = append(b.partial, data...)
+			break
+		}
+		line := append(b.partial, data[:i+1]...)
+		b.partial = nil
+		b.lines = append(b.lines, line)
+		data = data[i+1:]
+		if len(b.lines) > 2*b.maxlines {
+			// don't wait until the end with a flood of short lines
+			b.trim()
+		}
+	}
+	b.trim()
+	return n, nil
+}
+
+func (b *linebuf) WriteTo(w io.Writer) (int64, error) {
+	b.l.Lock()
+	defer b.l.Unlock()
+	n, err := w.Write(b.contents())
+	return int64(n), err
+}
+
+func (b *linebuf) MaxLines() int {
+	b.l.Lock()
+	defer b.l.Unlock()
+	return b.maxlines
+}
+
+func (b *linebuf) SetMaxLines(n int) {
+	b.l.Lock()
+	defer b.l.Unlock()
+	b.maxlines = n
+	b.trim()
+}
+
+func (b *linebuf) NumLines() int {
+	b.l.Lock()
+	defer b.l.Unlock()
+	return b.numLines()
+}
+
+func (b *linebuf) Lines(start, end int) []string {
+	b.l.Lock()
+	defer b.l.Unlock()
+	n := b.numLines()
+	if start < 0 {
+		start = 0
+	}
+	if end > n {
+		end = n
+	}
+	lines := []string{}
+	for i := start; i < end; i++ {
+		var line []byte
+		if i < len(b.lines) {
+			line = b.lines[i]
+			line = line[:len(line)-1]
+		} else {
+			line = b.partial
+		}
+		lines = append(lines, string(line))
+	}
+	return lines
+}
+
+func newLinebuf(maxlines, maxbytes int) LineBuffer {
+	return &linebuf{
+		maxlines: maxlines,
+		maxbytes: maxbytes,
+	}
+}
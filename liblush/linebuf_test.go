@@ -0,0 +1,109 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package liblush
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func linebufContents(b Ringbuffer) string {
+	var buf bytes.Buffer
+	b.WriteTo(&buf)
+	return buf.String()
+}
+
+func TestLinebuf(t *testing.T) {
+	b := newLinebuf(3, 100)
+	n, err := b.Write([]byte("one\ntwo\nthr"))
+	if err != nil || n != 11 {
+		t.Fatalf("Unexpected write result: %d, %v", n, err)
+	}
+	if b.NumLines() != 3 {
+		t.Errorf("Expected 3 lines, got %d", b.NumLines())
+	}
+	b.Write([]byte("ee\nfour\n"))
+	if s := linebufContents(b); s != "two\nthree\nfour\n" {
+		t.Errorf("Unexpected contents: %q", s)
+	}
+	if s := fmt.Sprint(b.Lines(1, 10)); s != "[three four]" {
+		t.Errorf("Unexpected lines: %s", s)
+	}
+	if s := fmt.Sprint(b.Lines(-1, 1)); s != "[two]" {
+		t.Errorf("Unexpected lines: %s", s)
+	}
+	last := make([]byte, 7)
+	last = last[:b.Last(last)]
+	if string(last) != "e\nfour\n" {
+		t.Errorf("Unexpected last bytes: %q", last)
+	}
+	// byte limit drops whole lines
+	b.Resize(12)
+	if s := linebufContents(b); s != "three\nfour\n" {
+		t.Errorf("Unexpected contents after resize: %q", s)
+	}
+	b.SetMaxLines(1)
+	if s := linebufContents(b); s != "four\n" || b.MaxLines() != 1 {
+		t.Errorf("Unexpected contents after SetMaxLines: %q", s)
+	}
+	// incomplete line counts too
+	b.Write([]byte("fi"))
+	if s := fmt.Sprint(b.Lines(0, 10)); s != "[fi]" {
+		t.Errorf("Unexpected lines: %s", s)
+	}
+}
+
+func TestLinebufLongLine(t *testing.T) {
+	b := newLinebuf(10, 5)
+	b.Write([]byte("abcdefgh\n"))
+	if s := linebufContents(b); s != "efgh\n" {
+		t.Errorf("Expected the last 5 bytes, got %q", s)
+	}
+	b.Write([]byte("aéé"))
+	if s := linebufContents(b); s != "aéé" {
+		t.Errorf("Unexpected contents: %q", s)
+	}
+	// é is two bytes, can't keep half of it
+	b.Write([]byte("é"))
+	if s := linebufContents(b); s != "éé" {
+		t.Errorf("Expected whole characters, got %q", s)
+	}
+	b.Resize(0)
+	if s := linebufContents(b); s != "" || b.NumLines() != 0 {
+		t.Errorf("Expected nothing in an empty buffer, got %q", s)
+	}
+	b.Resize(5)
+	b.Write([]byte("abcdefgh\n"))
+	b.Resize(0)
+	if b.NumLines() != 0 {
+		t.Errorf("Expected no lines, got %d", b.NumLines())
+	}
+}
+
+func TestRichpipeScrollbackLines(t *testing.T) {
+	p := newRichPipe(Devnull, 8)
+	// the é gets cut in half
+	fmt.Fprint(p, "xéab\ncd\nef")
+	p.SetScrollbackLines(2)
+	lb, ok := p.Scrollback().(LineBuffer)
+	if !ok || p.ScrollbackLines() != 2 || lb.Size() != 8 {
+		t.Fatalf("Expected a line scrollback of 2 lines and 8 bytes, got %#v", p.Scrollback())
+	}
+	if s := fmt.Sprint(lb.Lines(0, 2)); s != "[cd ef]" {
+		t.Errorf("Unexpected lines: %s", s)
+	}
+	fmt.Fprint(p, "\ngh\n")
+	if s := linebufContents(p.Scrollback()); s != "ef\ngh\n" {
+		t.Errorf("Unexpected scrollback: %q", s)
+	}
+	p.SetScrollbackLines(0)
+	if _, ok := p.Scrollback().(LineBuffer); ok || p.ScrollbackLines() != 0 {
+		t.Error("Expected a byte scrollback again")
+	}
+	if s := linebufContents(p.Scrollback()); s != "ef\ngh\n" {
+		t.Errorf("Unexpected scrollback after switching back: %q", s)
+	}
+}
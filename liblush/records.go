@@ -0,0 +1,276 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package liblush
+
+// Builtins operating on streams of JSON records (see OutStream.RecordMode).
+// They read any sequence of JSON values from stdin, JSON lines or otherwise.
+// Fields are looked up by name, nested fields with dots: "user.name". Their
+// names start with rec- so they don't shadow executables like table or where.
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+func init() {
+	RegisterBuiltin("rec-select", builtinSelect)
+	RegisterBuiltin("rec-where", builtinWhere)
+	RegisterBuiltin("rec-sort-by", builtinSortBy)
+	RegisterBuiltin("rec-table", builtinTable)
+}
+
+// call f for every record in r until it returns an error
+func eachRecord(r io.Reader, f func(interface{}) error) error {
+	dec := json.NewDecoder(r)
+	// keep numbers as they are, 64 bit ints don't survive float64
+	dec.UseNumber()
+	for {
+		var rec interface{}
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid record: %v", err)
+		}
+		err = f(rec)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func readRecords(r io.Reader) ([]interface{}, error) {
+	var recs []interface{}
+	err := eachRecord(r, func(rec interface{}) error {
+		recs = append(recs, rec)
+		return nil
+	})
+	return recs, err
+}
+
+func writeRecord(w io.Writer, rec interface{}) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// value of a (dotted) field, false if there is no such field
+func lookupField(rec interface{}, field string) (interface{}, bool) {
+	for _, name := range strings.Split(field, ".") {
+		obj, ok := rec.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		rec, ok = obj[name]
+		if !ok {
+			return nil, false
+		}
+	}
+	return rec, true
+}
+
+// strings as they are, anything else as JSON
+func formatValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// -1, 0 or 1. numbers compare numerically, strings lexicographically, and
+// anything else by its JSON representation. null sorts first.
+func compareValues(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	na, aok := a.(json.Number)
+	nb, bok := b.(json.Number)
+	if aok && bok {
+		fa, _ := na.Float64()
+		fb, _ := nb.Float64()
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(formatValue(a), formatValue(b))
+}
+
+// rec-select field... outputs only these fields of every record, in that
+// order
+func builtinSelect(ctx *BuiltinContext) error {
+	if len(ctx.Argv) == 1 {
+		return errors.New("usage: rec-select field...")
+	}
+	ctx.Cmd.Stdout().SetRecordMode(true)
+	fields := ctx.Argv[1:]
+	return eachRecord(ctx.Stdin, func(rec interface{}) error {
+		// by hand, to keep the order of the fields
+		var buf bytes.Buffer
+		buf.WriteByte('{')
+		for i, field := range fields {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			v, _ := lookupField(rec, field)
+			key, _ := json.Marshal(field)
+			val, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			buf.Write(key)
+			buf.WriteByte(':')
+			buf.Write(val)
+		}
+		buf.WriteString("}\n")
+		_, err := ctx.Stdout.Write(buf.Bytes())
+		return err
+	})
+}
+
+// rec-where field op value, where op is one of == != < <= > >= =~ (the latter
+// matches a regular expression). value is parsed as JSON, or taken as a
+// string if that fails.
+func builtinWhere(ctx *BuiltinContext) error {
+	if len(ctx.Argv) != 4 {
+		return errors.New("usage: rec-where field op value")
+	}
+	ctx.Cmd.Stdout().SetRecordMode(true)
+	field, op, valstr := ctx.Argv[1], ctx.Argv[2], ctx.Argv[3]
+	var value interface{}
+	dec := json.NewDecoder(strings.NewReader(valstr))
+	dec.UseNumber()
+	if dec.Decode(&value) != nil || dec.More() {
+		value = valstr
+	}
+	var match func(interface{}) bool
+	switch op {
+	case "==":
+		match = func(v interface{}) bool { return compareValues(v, value) == 0 }
+	case "!=":
+		match = func(v interface{}) bool { return compareValues(v, value) != 0 }
+	case "<":
+		match = func(v interface{}) bool { return compareValues(v, value) < 0 }
+	case "<=":
+		match = func(v interface{}) bool { return compareValues(v, value) <= 0 }
+	case ">":
+		match = func(v interface{}) bool { return compareValues(v, value) > 0 }
+	case ">=":
+		match = func(v interface{}) bool { return compareValues(v, value) >= 0 }
+	case "=~":
+		re, err := regexp.Compile(valstr)
+		if err != nil {
+			return fmt.Errorf("rec-where: %v", err)
+		}
+		match = func(v interface{}) bool { return re.MatchString(formatValue(v)) }
+	default:
+		return fmt.Errorf("rec-where: unknown operator: %s", op)
+	}
+	return eachRecord(ctx.Stdin, func(rec interface{}) error {
+		v, ok := lookupField(rec, field)
+		if !ok || !match(v) {
+			return nil
+		}
+		return writeRecord(ctx.Stdout, rec)
+	})
+}
+
+// rec-sort-by [-r] field... sorts records by these fields, stable
+func builtinSortBy(ctx *BuiltinContext) error {
+	fields := ctx.Argv[1:]
+	reverse := len(fields) > 0 && fields[0] == "-r"
+	if reverse {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return errors.New("usage: rec-sort-by [-r] field...")
+	}
+	ctx.Cmd.Stdout().SetRecordMode(true)
+	recs, err := readRecords(ctx.Stdin)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(recs, func(i, j int) bool {
+		for _, field := range fields {
+			a, _ := lookupField(recs[i], field)
+			b, _ := lookupField(recs[j], field)
+			if c := compareValues(a, b); c != 0 {
+				return (c < 0) != reverse
+			}
+		}
+		return false
+	})
+	for _, rec := range recs {
+		err = writeRecord(ctx.Stdout, rec)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rec-table [field...] renders records as an aligned text table. without
+// fields the columns are all fields of all records, sorted by name.
+func builtinTable(ctx *BuiltinContext) error {
+	recs, err := readRecords(ctx.Stdin)
+	if err != nil {
+		return err
+	}
+	fields := ctx.Argv[1:]
+	if len(fields) == 0 {
+		seen := map[string]bool{}
+		for _, rec := range recs {
+			if obj, ok := rec.(map[string]interface{}); ok {
+				for k := range obj {
+					if !seen[k] {
+						seen[k] = true
+						fields = append(fields, k)
+					}
+				}
+			}
+		}
+		sort.Strings(fields)
+	}
+	w := tabwriter.NewWriter(ctx.Stdout, 0, 8, 2, ' ', 0)
+	if len(fields) == 0 {
+		// not objects: one per line
+		for _, rec := range recs {
+			fmt.Fprintln(w, formatValue(rec))
+		}
+		return w.Flush()
+	}
+	fmt.Fprintln(w, strings.Join(fields, "\t"))
+	for _, rec := range recs {
+		cells := make([]string, len(fields))
+		for i, field := range fields {
+			if v, ok := lookupField(rec, field); ok {
+				// tabs and newlines would wreck the layout
+				cells[i] = strings.NewReplacer("\t", " ", "\n", " ").Replace(formatValue(v))
+			}
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	return w.Flush()
+}
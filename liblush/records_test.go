@@ -0,0 +1,103 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package liblush
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+const testRecords = `{"name": "b", "size": 10, "user": {"id": 2}}
+{"name": "a", "size": 9, "user": {"id": 1}}
+{"name": "c", "size": 100}
+`
+
+// run a builtin on input, return its stdout and whether it declared record
+// output
+func runRecords(t *testing.T, input string, argv ...string) (string, bool) {
+	var b bytes.Buffer
+	s := NewSession()
+	c := s.NewCommand(argv[0], argv[1:]...)
+	c.Stdout().SetListener(&b)
+	go func() {
+		io.WriteString(c.Stdin(), input)
+		c.Stdin().Close()
+	}()
+	err := c.Run()
+	if err != nil {
+		t.Fatalf("%v failed: %v", argv, err)
+	}
+	return b.String(), c.Stdout().RecordMode()
+}
+
+// the name fields of all records, concatenated
+func recordNames(t *testing.T, out string) string {
+	var names string
+	err := eachRecord(strings.NewReader(out), func(rec interface{}) error {
+		name, _ := lookupField(rec, "name")
+		names += formatValue(name)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("invalid output %q: %v", out, err)
+	}
+	return names
+}
+
+func TestBuiltinSelect(t *testing.T) {
+	out, records := runRecords(t, testRecords, "rec-select", "size", "user.id")
+	const expected = `{"size":10,"user.id":2}
+{"size":9,"user.id":1}
+{"size":100,"user.id":null}
+`
+	if out != expected {
+		t.Errorf("expected %q, got %q", expected, out)
+	}
+	if !records {
+		t.Error("rec-select output not in record mode")
+	}
+}
+
+func TestBuiltinWhere(t *testing.T) {
+	for _, tc := range []struct {
+		argv     []string
+		expected string
+	}{
+		{[]string{"rec-where", "size", ">", "9"}, "bc"},
+		{[]string{"rec-where", "size", "<=", "10"}, "ba"},
+		{[]string{"rec-where", "name", "==", "a"}, "a"},
+		{[]string{"rec-where", "name", "!=", `"a"`}, "bc"},
+		{[]string{"rec-where", "user.id", "==", "1"}, "a"},
+		{[]string{"rec-where", "name", "=~", "^[ab]$"}, "ba"},
+	} {
+		out, _ := runRecords(t, testRecords, tc.argv...)
+		if names := recordNames(t, out); names != tc.expected {
+			t.Errorf("%v: expected %q, got %q", tc.argv, tc.expected, names)
+		}
+	}
+}
+
+func TestBuiltinSortBy(t *testing.T) {
+	out, records := runRecords(t, testRecords, "rec-sort-by", "-r", "size")
+	if names := recordNames(t, out); names != "cba" {
+		t.Errorf("expected sorted names cba, got %q", names)
+	}
+	if !records {
+		t.Error("rec-sort-by output not in record mode")
+	}
+}
+
+func TestBuiltinTable(t *testing.T) {
+	out, records := runRecords(t, testRecords, "rec-table", "name", "size")
+	const expected = "name  size\nb     10\na     9\nc     100\n"
+	if out != expected {
+		t.Errorf("expected %q, got %q", expected, out)
+	}
+	if records {
+		t.Error("rec-table output should be plain text")
+	}
+}
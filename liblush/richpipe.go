@@ -5,8 +5,11 @@
 package liblush
 
 import (
+	"bytes"
+	"encoding/json"
 	"io"
 	"sync"
+	"unicode/utf8"
 )
 
 // this girl just couples a scrollback buffer to a flexible multiwriter thats
@@ -17,9 +20,19 @@ type richpipe struct {
 	peeker   FlexibleMultiWriter
 	// Most recently written bytes
 	fifo Ringbuffer
-	l    sync.Mutex
+	// just for fifo itself: Scrollback shouldn't wait for a slow listener
+	fifol sync.Mutex
+	l     sync.Mutex
+	// record mode: see OutStream.RecordMode
+	records      bool
+	recordpeeker FlexibleMultiWriter
+	// incomplete last line
+	recordbuf []byte
 }
 
+// longer lines are cut up in separate records rather than buffered forever
+const maxRecordSize = 1 << 20
+
 func (p *richpipe) Write(data []byte) (int, error) {
 	p.l.Lock()
 	defer p.l.Unlock()
@@ -34,9 +47,59 @@ func (p *richpipe) Write(data []byte) (int, error) {
 	}
 	p.peeker.Write(data)
 	p.fifo.Write(data)
+	if p.records {
+		p.frameRecords(data)
+	}
 	return n, err
 }
 
+// caller must hold the lock
+func (p *richpipe) frameRecords(data []byte) {
+	p.recordbuf = append(p.recordbuf, data...)
+	for {
+		i := bytes.IndexByte(p.recordbuf, '\n')
+		if i == -1 {
+			break
+		}
+		p.emitRecord(p.recordbuf[:i])
+		p.recordbuf = p.recordbuf[i+1:]
+	}
+	if len(p.recordbuf) > maxRecordSize {
+		p.emitRecord(p.recordbuf)
+		p.recordbuf = nil
+	}
+	// don't hold on to the entire array for just the tail
+	p.recordbuf = append([]byte(nil), p.recordbuf...)
+}
+
+func (p *richpipe) emitRecord(line []byte) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return
+	}
+	if !json.Valid(line) {
+		line, _ = json.Marshal(string(line))
+	}
+	p.recordpeeker.Write(line)
+}
+
+func (p *richpipe) RecordMode() bool {
+	p.l.Lock()
+	defer p.l.Unlock()
+	return p.records
+}
+
+func (p *richpipe) SetRecordMode(records bool) {
+	p.l.Lock()
+	defer p.l.Unlock()
+	p.records = records
+	p.recordbuf = nil
+}
+
+func (p *richpipe) RecordPeeker() *FlexibleMultiWriter {
+	return &p.recordpeeker
+}
+
 func (p *richpipe) SetListener(w io.Writer) {
 	p.listener = w
 }
@@ -61,9 +124,14 @@ func (p *richpipe) Close() error {
 	p.l.Lock()
 	defer p.l.Unlock()
 	var err error
+	if p.records && len(p.recordbuf) > 0 {
+		// last line without a newline
+		p.emitRecord(p.recordbuf)
+		p.recordbuf = nil
+	}
 	err = tryClose(p.listener)
 	// OH MY GOD GO WHAT IS WRONG WITH YOU, SERIOUSLY
-	for _, x := range p.Peeker().Writers() {
+	for _, x := range append(p.Peeker().Writers(), p.recordpeeker.Writers()...) {
 		err2 := tryClose(x)
 		if err2 != nil && err == nil {
 			err = err2
@@ -73,9 +141,53 @@ func (p *richpipe) Close() error {
 }
 
 func (p *richpipe) Scrollback() Ringbuffer {
+	p.fifol.Lock()
+	defer p.fifol.Unlock()
 	return p.fifo
 }
 
+func (p *richpipe) ScrollbackLines() int {
+	if lb, ok := p.Scrollback().(LineBuffer); ok {
+		return lb.MaxLines()
+	}
+	return 0
+}
+
+func (p *richpipe) SetScrollbackLines(n int) {
+	if n < 0 {
+		n = 0
+	}
+	// no writes while copying the scrollback
+	p.l.Lock()
+	defer p.l.Unlock()
+	old := p.Scrollback()
+	lb, ok := old.(LineBuffer)
+	if ok && n > 0 {
+		lb.SetMaxLines(n)
+		return
+	}
+	if !ok && n == 0 {
+		return
+	}
+	var buf bytes.Buffer
+	old.WriteTo(&buf)
+	data := buf.Bytes()
+	var fifo Ringbuffer
+	if n > 0 {
+		fifo = newLinebuf(n, old.Size())
+		// the oldest character may have been cut in half
+		for len(data) > 0 && !utf8.RuneStart(data[0]) {
+			data = data[1:]
+		}
+	} else {
+		fifo = newRingbuf(old.Size())
+	}
+	fifo.Write(data)
+	p.fifol.Lock()
+	p.fifo = fifo
+	p.fifol.Unlock()
+}
+
 func newRichPipe(listener io.Writer, fifosize int) *richpipe {
 	return &richpipe{
 		listener: listener,
@@ -95,3 +95,27 @@ func TestRichpipeListenerError(t *testing.T) {
 		t.Errorf("Unexpected contents in scrollback buffer: %q", string(buf))
 	}
 }
+
+// every write is one record
+type recordCollector []string
+
+func (rc *recordCollector) Write(data []byte) (int, error) {
+	*rc = append(*rc, string(data))
+	return len(data), nil
+}
+
+func TestRichpipeRecords(t *testing.T) {
+	p := newRichPipe(Devnull, 100)
+	var recs recordCollector
+	p.SetRecordMode(true)
+	p.RecordPeeker().AddWriter(&recs)
+	// records split over writes, blank lines, and a last line without newline
+	for _, s := range []string{`{"a":`, "1}\n\n[2]\n", "not json\n", ` "x" `} {
+		fmt.Fprint(p, s)
+	}
+	p.Close()
+	expected := []string{`{"a":1}`, `[2]`, `"not json"`, `"x"`}
+	if fmt.Sprint(recs) != fmt.Sprint(expected) {
+		t.Errorf("expected records %q, got %q", expected, recs)
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+// +build linux
+
+package liblush
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+)
+
+// device nodes made available inside the sandbox (if the host has them)
+var sandboxDevices = []string{"null", "zero", "full", "random", "urandom", "tty"}
+
+// attributes that start the exec helper in fresh namespaces. everything else
+// is done by the helper itself, see enterSandbox.
+func sandboxSysProcAttr(sb *Sandbox, a *Account) (*syscall.SysProcAttr, error) {
+	flags := syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID |
+		syscall.CLONE_NEWUTS | syscall.CLONE_NEWIPC
+	if !sb.Network {
+		flags |= syscall.CLONE_NEWNET
+	}
+	// root inside the sandbox is whoever the command runs as outside of it
+	uid, gid := os.Getuid(), os.Getgid()
+	if a != nil {
+		uid, gid = int(a.Uid), int(a.Gid)
+	}
+	attr := &syscall.SysProcAttr{
+		Cloneflags: uintptr(flags),
+		UidMappings: []syscall.SysProcIDMap{
+			{ContainerID: 0, HostID: uid, Size: 1},
+		},
+		GidMappings: []syscall.SysProcIDMap{
+			{ContainerID: 0, HostID: gid, Size: 1},
+		},
+	}
+	if a != nil {
+		// the mapping alone doesn't change who we are: without this the child
+		// keeps our own (root) credentials on the host. become root in the
+		// namespace, ie the account, and drop our supplementary groups.
+		// setgroups is allowed because we're privileged.
+		attr.Credential = &syscall.Credential{Uid: 0, Gid: 0}
+		attr.GidMappingsEnableSetgroups = true
+	}
+	return attr, nil
+}
+
+// flags a remount must keep to be allowed in a user namespace. for these the
+// statfs flags have the same value as the mount flags.
+const lockedMountFlags = syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC |
+	syscall.MS_NOATIME | syscall.MS_NODIRATIME
+
+// statfs flag for relatime, which unlike the others differs from MS_RELATIME
+const st_RELATIME = 0x1000
+
+func remountReadonly(target string) error {
+	var st syscall.Statfs_t
+	err := syscall.Statfs(target, &st)
+	if err != nil {
+		return err
+	}
+	flags := uintptr(st.Flags) & lockedMountFlags
+	if uintptr(st.Flags)&st_RELATIME != 0 {
+		flags |= syscall.MS_RELATIME
+	}
+	flags |= syscall.MS_REMOUNT | syscall.MS_BIND | syscall.MS_RDONLY
+	return syscall.Mount("", target, "", flags, "")
+}
+
+// build the sandbox's root file system and move into it. must be called from
+// the exec helper, in the namespaces set up by sandboxSysProcAttr.
+func enterSandbox(sb *Sandbox) error {
+	wd, _ := os.Getwd()
+	// keep all following mounts to ourselves
+	err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, "")
+	if err != nil {
+		return fmt.Errorf("making mounts private: %v", err)
+	}
+	// the new root is built in a fresh /tmp, which hides the old one. open
+	// all directories to bind beforehand so they can live in /tmp, too.
+	var dirs []string
+	var srcs []*os.File
+	for _, dir := range sb.Dirs {
+		f, err := os.Open(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		dirs = append(dirs, filepath.Clean(dir))
+		srcs = append(srcs, f)
+	}
+	err = syscall.Mount("tmpfs", "/tmp", "tmpfs", 0, "mode=0755")
+	if err != nil {
+		return fmt.Errorf("mounting tmpfs: %v", err)
+	}
+	root := "/tmp/root"
+	err = os.Mkdir(root, 0755)
+	if err != nil {
+		return err
+	}
+	// pivot_root wants a mount point
+	err = syscall.Mount(root, root, "", syscall.MS_BIND, "")
+	if err != nil {
+		return fmt.Errorf("binding new root: %v", err)
+	}
+	for i, dir := range dirs {
+		target := filepath.Join(root, dir)
+		err = os.MkdirAll(target, 0755)
+		if err != nil {
+			return err
+		}
+		src := fmt.Sprintf("/proc/self/fd/%d", srcs[i].Fd())
+		err = syscall.Mount(src, target, "", syscall.MS_BIND|syscall.MS_REC, "")
+		if err != nil {
+			return fmt.Errorf("binding %s: %v", dir, err)
+		}
+		err = remountReadonly(target)
+		if err != nil {
+			return fmt.Errorf("making %s read-only: %v", dir, err)
+		}
+	}
+	err = os.Mkdir(root+"/proc", 0755)
+	if err == nil {
+		err = syscall.Mount("proc", root+"/proc", "proc",
+			syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, "")
+	}
+	if err != nil {
+		return fmt.Errorf("mounting /proc: %v", err)
+	}
+	err = os.Mkdir(root+"/dev", 0755)
+	if err == nil {
+		err = syscall.Mount("tmpfs", root+"/dev", "tmpfs", syscall.MS_NOSUID, "mode=0755")
+	}
+	if err != nil {
+		return fmt.Errorf("mounting /dev: %v", err)
+	}
+	for _, name := range sandboxDevices {
+		if _, err := os.Stat("/dev/" + name); err != nil {
+			continue
+		}
+		target := root + "/dev/" + name
+		f, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		f.Close()
+		err = syscall.Mount("/dev/"+name, target, "", syscall.MS_BIND, "")
+		if err != nil {
+			return fmt.Errorf("binding /dev/%s: %v", name, err)
+		}
+	}
+	err = os.Mkdir(root+"/tmp", 0755)
+	if err == nil {
+		err = syscall.Mount("tmpfs", root+"/tmp", "tmpfs", syscall.MS_NOSUID, "mode=1777")
+	}
+	if err != nil {
+		return fmt.Errorf("mounting /tmp: %v", err)
+	}
+	err = os.Chdir(root)
+	if err == nil {
+		err = os.Mkdir(".oldroot", 0700)
+	}
+	if err == nil {
+		err = syscall.PivotRoot(".", ".oldroot")
+	}
+	if err == nil {
+		err = os.Chdir("/")
+	}
+	if err == nil {
+		err = syscall.Unmount("/.oldroot", syscall.MNT_DETACH)
+	}
+	if err != nil {
+		return fmt.Errorf("switching root: %v", err)
+	}
+	os.Remove("/.oldroot")
+	err = remountReadonly("/")
+	if err != nil {
+		return fmt.Errorf("making root read-only: %v", err)
+	}
+	err = syscall.Sethostname([]byte("lush-sandbox"))
+	if err != nil {
+		return fmt.Errorf("setting hostname: %v", err)
+	}
+	if os.Chdir(wd) != nil {
+		// starting dir not in the sandbox
+		os.Chdir("/")
+	}
+	return nil
+}
+
+// run a command as the child of this process, forward it all signals and
+// exit with its status. does not return unless the command can't be started.
+func superviseChild(path string, argv []string) error {
+	child := &exec.Cmd{
+		Path:   path,
+		Args:   argv,
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+	sigs := make(chan os.Signal, 16)
+	signal.Notify(sigs)
+	err := child.Start()
+	if err != nil {
+		return err
+	}
+	go func() {
+		for sig := range sigs {
+			if sig == syscall.SIGCHLD || sig == syscall.SIGURG {
+				// for us, not for the child
+				continue
+			}
+			child.Process.Signal(sig)
+		}
+	}()
+	err = child.Wait()
+	if exiterr, ok := err.(*exec.ExitError); ok {
+		status := exiterr.Sys().(syscall.WaitStatus)
+		if status.Signaled() {
+			// like a shell does it
+			os.Exit(128 + int(status.Signal()))
+		}
+		os.Exit(status.ExitStatus())
+	}
+	if err != nil {
+		return err
+	}
+	os.Exit(0)
+	panic("unreachable")
+}
@@ -0,0 +1,55 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+// +build linux
+
+package liblush
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// a sandboxed command runs as the account on the host, too: not just as root
+// in its namespace
+func TestCommandSandboxAccount(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("must be root to run commands as another user")
+	}
+	a, err := LookupAccount("nobody")
+	if err != nil {
+		t.Skipf("no account to test with: %v", err)
+	}
+	s := NewSession()
+	s.SetAccount(a)
+	s.SetSandbox(&Sandbox{Dirs: []string{"/bin", "/lib", "/lib64", "/usr"}})
+	c := s.NewCommand("sh", "-c", "touch /tmp/owned && sleep 10")
+	c.(*cmd).SetStartWd("/")
+	err = c.Start()
+	if err != nil {
+		// eg the test binary (our exec helper) is in a dir only we can read
+		t.Skipf("can't start a sandboxed command as %s here: %v", a.Name, err)
+	}
+	defer c.Wait()
+	defer c.Signal(os.Kill)
+	// the sandbox's /tmp, as seen from the host
+	fname := fmt.Sprintf("/proc/%d/root/tmp/owned", c.(*cmd).execCmd.Process.Pid)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		fi, err := os.Stat(fname)
+		if err == nil {
+			if uid := fi.Sys().(*syscall.Stat_t).Uid; uid != a.Uid {
+				t.Errorf("file created in sandbox owned by %d, not %d", uid, a.Uid)
+			}
+			return
+		}
+		if time.Now().After(deadline) || c.Status().Exited() != nil {
+			t.Fatalf("sandboxed command didn't create its file: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,27 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+// +build !linux
+
+package liblush
+
+import (
+	"errors"
+	"runtime"
+	"syscall"
+)
+
+var errSandboxUnsupported = errors.New("sandbox unsupported on " + runtime.GOOS)
+
+func sandboxSysProcAttr(sb *Sandbox, a *Account) (*syscall.SysProcAttr, error) {
+	return nil, errSandboxUnsupported
+}
+
+func enterSandbox(sb *Sandbox) error {
+	return errSandboxUnsupported
+}
+
+func superviseChild(path string, argv []string) error {
+	return errSandboxUnsupported
+}
@@ -5,6 +5,7 @@
 package liblush
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -16,8 +17,17 @@ import (
 type session struct {
 	lastid      int64
 	cmds        map[CmdId]*cmd
+	cmdslock    sync.RWMutex
 	environ     map[string]string
 	environlock sync.RWMutex
+	limits      Limits
+	sandbox     *Sandbox
+	account     *Account
+	aliases     map[string][]string
+	aliaslock   sync.RWMutex
+
+	chdirlisteners []func(string)
+	chdirlock      sync.Mutex
 }
 
 func (s *session) newid() CmdId {
@@ -35,12 +45,37 @@ func (s *session) NewCommand(name string, arg ...string) Cmd {
 	}
 	s.environlock.RUnlock()
 	c := newcmdPanicOnError(s.newid(), execcmd)
+	c.limits = s.limits
+	c.sandbox = s.sandbox
+	c.account = s.account
+	c.session = s
+	s.cmdslock.Lock()
 	s.cmds[c.id] = c
+	s.cmdslock.Unlock()
 	return c
 }
 
+func (s *session) CloneCommand(id CmdId) (Cmd, error) {
+	s.cmdslock.RLock()
+	orig := s.cmds[id]
+	s.cmdslock.RUnlock()
+	if orig == nil {
+		return nil, fmt.Errorf("no such command: %d", id)
+	}
+	c, err := orig.clone(s.newid())
+	if err != nil {
+		return nil, err
+	}
+	s.cmdslock.Lock()
+	s.cmds[c.id] = c
+	s.cmdslock.Unlock()
+	return c, nil
+}
+
 func (s *session) GetCommand(id CmdId) Cmd {
+	s.cmdslock.RLock()
 	c := s.cmds[id]
+	s.cmdslock.RUnlock()
 	if c == nil {
 		return nil
 	}
@@ -48,6 +83,8 @@ func (s *session) GetCommand(id CmdId) Cmd {
 }
 
 func (s *session) GetCommandIds() []CmdId {
+	s.cmdslock.RLock()
+	defer s.cmdslock.RUnlock()
 	ids := make([]CmdId, len(s.cmds))
 	i := 0
 	for id := range s.cmds {
@@ -58,6 +95,8 @@ func (s *session) GetCommandIds() []CmdId {
 }
 
 func (s *session) ReleaseCommand(id CmdId) error {
+	s.cmdslock.Lock()
+	defer s.cmdslock.Unlock()
 	c := s.cmds[id]
 	if c == nil {
 		return fmt.Errorf("no such command: %d", id)
@@ -67,6 +106,10 @@ func (s *session) ReleaseCommand(id CmdId) error {
 		return err
 	}
 	delete(s.cmds, id)
+	// don't leave dangling chains to a command that is gone
+	for _, other := range s.cmds {
+		other.dropSuccessor(c)
+	}
 	// are there some cyclic or pending references or can we trust the GC on
 	// this one? I don't really feel like figuring that out right now so Ill
 	// just mark it TODO.
@@ -75,7 +118,23 @@ func (s *session) ReleaseCommand(id CmdId) error {
 
 func (s *session) Chdir(dir string) error {
 	// not session-local at all
-	return os.Chdir(dir)
+	err := os.Chdir(dir)
+	if err != nil {
+		return err
+	}
+	s.chdirlock.Lock()
+	listeners := append([]func(string){}, s.chdirlisteners...)
+	s.chdirlock.Unlock()
+	for _, f := range listeners {
+		f(dir)
+	}
+	return nil
+}
+
+func (s *session) NotifyChdir(f func(dir string)) {
+	s.chdirlock.Lock()
+	defer s.chdirlock.Unlock()
+	s.chdirlisteners = append(s.chdirlisteners, f)
 }
 
 func (s *session) Setenv(key, value string) {
@@ -106,6 +165,91 @@ func (s *session) Environ() map[string]string {
 	return envcopy
 }
 
+func (s *session) DefaultLimits() Limits {
+	return s.limits
+}
+
+func (s *session) SetDefaultLimits(l Limits) {
+	s.limits = l
+}
+
+func (s *session) Sandbox() *Sandbox {
+	return s.sandbox
+}
+
+func (s *session) SetSandbox(sb *Sandbox) {
+	if sb != nil {
+		// commands keep a reference: don't let the caller change it later
+		sb = &Sandbox{
+			Dirs:    append([]string{}, sb.Dirs...),
+			Network: sb.Network,
+		}
+	}
+	s.sandbox = sb
+}
+
+func (s *session) Account() *Account {
+	return s.account
+}
+
+func (s *session) SetAccount(a *Account) {
+	if a != nil {
+		acopy := *a
+		acopy.Groups = append([]uint32{}, a.Groups...)
+		a = &acopy
+		s.Setenv("HOME", a.Home)
+		s.Setenv("USER", a.Name)
+		s.Setenv("LOGNAME", a.Name)
+		s.Setenv("SHELL", a.Shell)
+	}
+	s.account = a
+}
+
+func (s *session) SetAlias(name string, template []string) error {
+	err := validAliasName(name)
+	if err != nil {
+		return err
+	}
+	if len(template) == 0 {
+		return errors.New("empty alias: " + name)
+	}
+	s.aliaslock.Lock()
+	defer s.aliaslock.Unlock()
+	s.aliases[name] = append([]string{}, template...)
+	return nil
+}
+
+func (s *session) UnsetAlias(name string) {
+	s.aliaslock.Lock()
+	defer s.aliaslock.Unlock()
+	delete(s.aliases, name)
+}
+
+func (s *session) Aliases() map[string][]string {
+	s.aliaslock.RLock()
+	defer s.aliaslock.RUnlock()
+	aliases := map[string][]string{}
+	for k, v := range s.aliases {
+		aliases[k] = append([]string{}, v...)
+	}
+	return aliases
+}
+
+// aliases first, then everything in expand.go if full is set
+func (s *session) expand(argv []string, literal []bool, full bool, dir string) ([]string, error) {
+	s.aliaslock.RLock()
+	argv, literal, err := expandAliases(s.aliases, argv, literal)
+	s.aliaslock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	if !full {
+		return argv, nil
+	}
+	e := expander{env: s.Environ(), dir: dir}
+	return e.argv(argv, literal), nil
+}
+
 func NewSession() Session {
 	env := map[string]string{}
 	for _, x := range os.Environ() {
@@ -115,5 +259,6 @@ func NewSession() Session {
 	return &session{
 		cmds:    map[CmdId]*cmd{},
 		environ: env,
+		aliases: map[string][]string{},
 	}
 }
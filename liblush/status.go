@@ -6,6 +6,7 @@ package liblush
 
 import (
 	"log"
+	"sync"
 	"time"
 )
 
@@ -14,75 +15,123 @@ import (
 // to have a nil or non-nil error, in combination with nil or non-nil started,
 // nil or non-nil exited, ...? this should be defined.
 type cmdstatus struct {
+	// guards the fields below
+	lock      sync.Mutex
 	started   *time.Time
 	exited    *time.Time
 	err       error
+	timedOut  bool
 	listeners []func(CmdStatus) error
+	// one notification round at a time, or listeners see updates out of
+	// order and the list of listeners gets mangled
+	notifylock sync.Mutex
 }
 
 func (s *cmdstatus) startNow() {
+	s.lock.Lock()
 	if s.started != nil {
+		s.lock.Unlock()
 		panic("re-starting status not allowed")
 	}
 	t := time.Now()
 	s.started = &t
+	s.lock.Unlock()
 	s.changed()
 }
 
 func (s *cmdstatus) exitNow() {
+	s.lock.Lock()
 	if s.exited != nil {
+		s.lock.Unlock()
 		panic("status can only be exited once")
 	}
 	t := time.Now()
 	s.exited = &t
+	s.lock.Unlock()
 	s.changed()
-	// Status won't change anymore
-	s.listeners = nil
 }
 
 func (s *cmdstatus) Started() *time.Time {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 	return s.started
 }
 
 func (s *cmdstatus) Exited() *time.Time {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 	return s.exited
 }
 
 func (s *cmdstatus) Success() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 	return s.err == nil
 }
 
 func (s *cmdstatus) Err() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 	return s.err
 }
 
+func (s *cmdstatus) TimedOut() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.timedOut
+}
+
+// doesn't notify the listeners: the caller does, see cmd.expire
+func (s *cmdstatus) setTimedOut() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.timedOut = true
+}
+
 func (s *cmdstatus) setErr(e error) {
+	s.lock.Lock()
 	if s.err != nil {
+		s.lock.Unlock()
 		panic("cannot reset error state of command")
 	}
+	s.err = e
+	s.lock.Unlock()
 	if e != nil {
-		s.err = e
 		s.changed()
 	}
 }
 
 func (s *cmdstatus) NotifyChange(f func(CmdStatus) error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 	s.listeners = append(s.listeners, f)
 }
 
-// call this whenever the status has changed to notify the listeners
+// call this whenever the status has changed to notify the listeners. not with
+// the lock held: listeners read the status.
 func (s *cmdstatus) changed() {
-	for i := 0; i < len(s.listeners); i++ {
-		err := s.listeners[i](s)
+	s.notifylock.Lock()
+	defer s.notifylock.Unlock()
+	s.lock.Lock()
+	listeners := append([]func(CmdStatus) error{}, s.listeners...)
+	s.lock.Unlock()
+	var keep []func(CmdStatus) error
+	for _, f := range listeners {
+		err := f(s)
 		if err != nil {
 			log.Printf(
 				"Status update notification listener returned error: %v", err)
-			s.listeners = append(s.listeners[:i], s.listeners[i+1:]...)
-			i--
+			continue
 		}
+		keep = append(keep, f)
 	}
-	if s.Exited() != nil {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.exited != nil {
 		// no more state changes are expected
 		s.listeners = nil
+		return
 	}
+	// and those added in the meantime
+	s.listeners = append(keep, s.listeners[len(listeners):]...)
 }
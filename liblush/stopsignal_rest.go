@@ -0,0 +1,23 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+// +build !windows
+
+package liblush
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// Signal sent to a command to politely ask it to stop
+var StopSignal = os.Interrupt
+
+// Stop sequence of new commands: ask nicely, then less nicely, then not at all
+var DefaultStopSequence = []StopStep{
+	{StopSignal, 5 * time.Second},
+	{syscall.SIGTERM, 5 * time.Second},
+	{os.Kill, 0},
+}
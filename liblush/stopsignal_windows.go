@@ -0,0 +1,18 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package liblush
+
+import (
+	"os"
+)
+
+// Signal sent to a command to politely ask it to stop
+var StopSignal = os.Kill
+
+// Stop sequence of new commands. Windows doesn't do signals, so there is
+// nothing to escalate.
+var DefaultStopSequence = []StopStep{
+	{StopSignal, 0},
+}
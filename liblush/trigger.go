@@ -0,0 +1,221 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package liblush
+
+// Triggers: regular expressions over the output of a command, line by line.
+// Every command has a peeker on both streams feeding them complete lines.
+
+import (
+	"bytes"
+	"log"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// longer lines are matched in pieces of this size
+const maxTriggerLine = 64 * 1024
+
+// only the most recent matches are kept
+const maxTriggerMatches = 100
+
+// Regular expression matched against every line of output of a command
+type Trigger struct {
+	// "stdout", "stderr" or empty for both
+	Stream  string
+	Pattern *regexp.Regexp
+	// Stop the command on a match
+	Stop bool
+	// Start this command on a match, 0 for none. Commands can only be started
+	// once, so only the first match does this.
+	Start CmdId
+}
+
+type TriggerMatch struct {
+	// Index in Triggers()
+	Trigger int
+	Stream  string
+	// Without the newline
+	Line string
+	// Of the start of the line, in bytes since the start of the stream
+	Offset int64
+	Time   time.Time
+}
+
+type triggers struct {
+	lock      sync.Mutex
+	list      []Trigger
+	matches   []TriggerMatch
+	listeners []func(TriggerMatch)
+	// a trigger already stopped the command
+	stopped bool
+	// matches waiting for their listeners and actions, see notifyTriggers
+	pending   []firedTrigger
+	notifying bool
+	busy      sync.WaitGroup
+	// no more output, nothing left to stop
+	finished bool
+}
+
+type firedTrigger struct {
+	t Trigger
+	m TriggerMatch
+}
+
+// richpipe peeker splitting the output of a command in lines for its triggers
+type triggerPeeker struct {
+	c      *cmd
+	stream string
+	// incomplete last line, and its offset
+	buf    []byte
+	offset int64
+}
+
+func (p *triggerPeeker) Write(data []byte) (int, error) {
+	n := len(data)
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i == -1 {
+			p.buf = append(p.buf, data...)
+			if len(p.buf) >= maxTriggerLine {
+				p.flush()
+			}
+			break
+		}
+		p.buf = append(p.buf, data[:i]...)
+		p.flush()
+		// the newline
+		p.offset++
+		data = data[i+1:]
+	}
+	return n, nil
+}
+
+// match the buffered line and start a new one
+func (p *triggerPeeker) flush() {
+	p.c.matchLine(p.stream, p.buf, p.offset)
+	p.offset += int64(len(p.buf))
+	p.buf = p.buf[:0]
+}
+
+// the last line, if it didn't end in a newline
+func (p *triggerPeeker) Close() error {
+	if len(p.buf) > 0 {
+		p.flush()
+	}
+	return nil
+}
+
+// called with the output stream locked: only record the matches, the rest is
+// up to notifyTriggers
+func (c *cmd) matchLine(stream string, line []byte, offset int64) {
+	c.triggers.lock.Lock()
+	defer c.triggers.lock.Unlock()
+	var fired []TriggerMatch
+	for i, t := range c.triggers.list {
+		if (t.Stream == "" || t.Stream == stream) && t.Pattern.Match(line) {
+			m := TriggerMatch{
+				Trigger: i,
+				Stream:  stream,
+				Line:    string(line),
+				Offset:  offset,
+				Time:    time.Now(),
+			}
+			fired = append(fired, m)
+			c.triggers.pending = append(c.triggers.pending, firedTrigger{t, m})
+		}
+	}
+	if len(fired) == 0 {
+		return
+	}
+	c.triggers.matches = append(c.triggers.matches, fired...)
+	if n := len(c.triggers.matches); n > maxTriggerMatches {
+		c.triggers.matches = append([]TriggerMatch{}, c.triggers.matches[n-maxTriggerMatches:]...)
+	}
+	if !c.triggers.notifying {
+		c.triggers.notifying = true
+		c.triggers.busy.Add(1)
+		go c.notifyTriggers()
+	}
+}
+
+// call the listeners and take the actions of pending matches, in order, until
+// there are none left
+func (c *cmd) notifyTriggers() {
+	for {
+		c.triggers.lock.Lock()
+		pending := c.triggers.pending
+		c.triggers.pending = nil
+		if len(pending) == 0 {
+			c.triggers.notifying = false
+			c.triggers.lock.Unlock()
+			c.triggers.busy.Done()
+			return
+		}
+		listeners := c.triggers.listeners
+		c.triggers.lock.Unlock()
+		for _, ft := range pending {
+			for _, f := range listeners {
+				f(ft.m)
+			}
+			c.triggerActions(ft.t)
+		}
+	}
+}
+
+func (c *cmd) triggerActions(t Trigger) {
+	if t.Start != 0 && c.session != nil {
+		next := c.session.GetCommand(t.Start)
+		if next != nil && !wasStarted(next.(*cmd)) {
+			// its status reflects any failure
+			next.Start()
+		}
+	}
+	if t.Stop {
+		c.triggers.lock.Lock()
+		stop := !c.triggers.stopped && !c.triggers.finished
+		c.triggers.stopped = true
+		c.triggers.lock.Unlock()
+		if !stop {
+			return
+		}
+		// it may well have exited by itself by now
+		if err := c.Stop(nil); err != nil && c.status.Exited() == nil {
+			log.Printf("Trigger failed to stop command %d: %v", c.id, err)
+		}
+	}
+}
+
+// wait for the listeners of all matches. call once the output is closed.
+func (c *cmd) drainTriggers() {
+	c.triggers.lock.Lock()
+	c.triggers.finished = true
+	c.triggers.lock.Unlock()
+	c.triggers.busy.Wait()
+}
+
+func (c *cmd) Triggers() []Trigger {
+	c.triggers.lock.Lock()
+	defer c.triggers.lock.Unlock()
+	return append([]Trigger{}, c.triggers.list...)
+}
+
+func (c *cmd) SetTriggers(ts []Trigger) {
+	c.triggers.lock.Lock()
+	defer c.triggers.lock.Unlock()
+	c.triggers.list = append([]Trigger{}, ts...)
+}
+
+func (c *cmd) TriggerMatches() []TriggerMatch {
+	c.triggers.lock.Lock()
+	defer c.triggers.lock.Unlock()
+	return append([]TriggerMatch{}, c.triggers.matches...)
+}
+
+func (c *cmd) NotifyTrigger(f func(TriggerMatch)) {
+	c.triggers.lock.Lock()
+	defer c.triggers.lock.Unlock()
+	c.triggers.listeners = append(c.triggers.listeners, f)
+}
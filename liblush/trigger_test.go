@@ -0,0 +1,88 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package liblush
+
+import (
+	"os"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestTriggerPeeker(t *testing.T) {
+	c := echoCmd()
+	c.SetTriggers([]Trigger{
+		{Pattern: regexp.MustCompile("ERROR")},
+		{Stream: "stderr", Pattern: regexp.MustCompile(".")},
+	})
+	p := &triggerPeeker{c: c, stream: "stdout"}
+	for _, data := range []string{"ok\nan ERR", "OR here\n", "\nERROR"} {
+		p.Write([]byte(data))
+	}
+	if len(c.TriggerMatches()) != 1 {
+		t.Errorf("Expected a match before the last line ends, got %v", c.TriggerMatches())
+	}
+	p.Close()
+	ms := c.TriggerMatches()
+	if len(ms) != 2 {
+		t.Fatalf("Expected 2 matches, got %v", ms)
+	}
+	if ms[0].Trigger != 0 || ms[0].Stream != "stdout" || ms[0].Line != "an ERROR here" || ms[0].Offset != 3 {
+		t.Errorf("Unexpected first match: %#v", ms[0])
+	}
+	if ms[1].Line != "ERROR" || ms[1].Offset != 18 {
+		t.Errorf("Unexpected second match: %#v", ms[1])
+	}
+}
+
+func TestTriggerActions(t *testing.T) {
+	echo := os.Getenv("ECHOBIN")
+	if echo == "" {
+		echo = "echo"
+	}
+	s := NewSession()
+	c := s.NewCommand(echo, "Listening on :8080")
+	next := s.NewCommand(echo, "next")
+	c.SetTriggers([]Trigger{{
+		Pattern: regexp.MustCompile(`^Listening on (\S+)`),
+		Start:   next.Id(),
+	}})
+	fired := make(chan TriggerMatch, 1)
+	c.NotifyTrigger(func(m TriggerMatch) {
+		fired <- m
+	})
+	nextExited := make(chan struct{})
+	next.Status().NotifyChange(func(st CmdStatus) error {
+		if st.Exited() != nil {
+			close(nextExited)
+		}
+		return nil
+	})
+	err := c.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case m := <-fired:
+		if m.Line != "Listening on :8080" {
+			t.Errorf("Unexpected match: %#v", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Trigger didn't fire")
+	}
+	select {
+	case <-nextExited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Trigger didn't start the next command")
+	}
+	clone, err := s.CloneCommand(c.Id())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clone.Triggers()) != 1 || len(clone.TriggerMatches()) != 0 {
+		t.Errorf("Expected a clone with the trigger but no matches, got %v, %v",
+			clone.Triggers(), clone.TriggerMatches())
+	}
+}
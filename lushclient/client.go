@@ -0,0 +1,466 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+// Package lushclient speaks the control protocol of a lush server: the
+// websocket on /ctrl, and the HTTP requests around it.
+//
+//     c, err := lushclient.Dial("http://localhost:8081", nil)
+//     ...
+//     md, err := c.New(lushclient.NewOptions{Cmd: "ls"})
+//     err = c.Start(md.Id)
+//     status, err := c.Attach(md.Id, nil, os.Stdout, os.Stderr)
+//
+// A Conn is not safe for concurrent use, except for the methods that only
+// make HTTP requests (List, Metadata, Write, CloseStdin).
+package lushclient
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hraban/lush/liblush"
+)
+
+type Options struct {
+	// defaults to "lush", the user for a server started with -p
+	User     string
+	Password string
+	// for https servers. nil is the default config.
+	TLSConfig *tls.Config
+}
+
+type Conn struct {
+	// as assigned by the server
+	ClientId uint32
+	base     *url.URL
+	opts     Options
+	http     *http.Client
+	ws       *websocket.Conn
+	// events read while waiting for something else
+	pending []Event
+}
+
+func (c *Conn) request(method, path string, body io.Reader) (*http.Request, error) {
+	u, err := c.base.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if c.opts.Password != "" {
+		req.SetBasicAuth(c.opts.User, c.opts.Password)
+	}
+	return req, nil
+}
+
+// perform a request, return the body. error unless 2xx.
+func (c *Conn) do(req *http.Request) ([]byte, error) {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Path,
+			resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+// Connect to the lush server at this URL (http or https). opts may be nil.
+// Returns once the server has assigned a client id.
+func Dial(rawurl string, opts *Options) (*Conn, error) {
+	base, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	c := &Conn{base: base}
+	if opts != nil {
+		c.opts = *opts
+	}
+	if c.opts.User == "" {
+		c.opts.User = "lush"
+	}
+	c.http = &http.Client{Transport: &http.Transport{TLSClientConfig: c.opts.TLSConfig}}
+	// the key proves to the server we are allowed to make HTTP requests,
+	// which browsers don't do for websockets
+	req, err := c.request("GET", "/ctrl", nil)
+	if err != nil {
+		return nil, err
+	}
+	key, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching websocket key: %v", err)
+	}
+	wsurl := *req.URL
+	wsurl.Scheme = "ws"
+	if base.Scheme == "https" {
+		wsurl.Scheme = "wss"
+	}
+	dialer := websocket.Dialer{TLSClientConfig: c.opts.TLSConfig}
+	c.ws, _, err = dialer.Dial(wsurl.String(), req.Header)
+	if err != nil {
+		return nil, fmt.Errorf("websocket: %v", err)
+	}
+	err = c.ws.WriteMessage(websocket.TextMessage, key)
+	if err != nil {
+		c.ws.Close()
+		return nil, err
+	}
+	e, err := c.Next()
+	if err == nil {
+		if cid, ok := e.(*ClientIdEvent); ok {
+			c.ClientId = cid.Id
+			return c, nil
+		}
+		err = fmt.Errorf("unexpected %s event", e.EventName())
+	}
+	c.ws.Close()
+	return nil, fmt.Errorf("websocket handshake failed: %v", err)
+}
+
+func (c *Conn) Close() error {
+	return c.ws.Close()
+}
+
+// Reads and writes on the websocket fail after this time. Zero means never.
+func (c *Conn) SetDeadline(t time.Time) {
+	c.ws.SetReadDeadline(t)
+	c.ws.SetWriteDeadline(t)
+}
+
+// Send a raw event, eg Send("chdir", "/tmp")
+func (c *Conn) Send(event, payload string) error {
+	return c.ws.WriteMessage(websocket.TextMessage, []byte(event+";"+payload))
+}
+
+// Next event from the server
+func (c *Conn) Next() (Event, error) {
+	if len(c.pending) > 0 {
+		e := c.pending[0]
+		c.pending = c.pending[1:]
+		return e, nil
+	}
+	_, msg, err := c.ws.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	return ParseEvent(string(msg))
+}
+
+// Read events until match returns true for one, and return that. All other
+// events remain for Next. An error event ends it too, as an *ErrorEvent.
+func (c *Conn) Await(match func(Event) bool) (Event, error) {
+	var skipped []Event
+	defer func() {
+		c.pending = append(skipped, c.pending...)
+	}()
+	for {
+		e, err := c.Next()
+		if err != nil {
+			return nil, err
+		}
+		if eerr, ok := e.(*ErrorEvent); ok {
+			return nil, eerr
+		}
+		if match(e) {
+			return e, nil
+		}
+		skipped = append(skipped, e)
+	}
+}
+
+func randomTag() string {
+	buf := make([]byte, 12)
+	rand.Read(buf)
+	return base64.URLEncoding.EncodeToString(buf)
+}
+
+type propRequest struct {
+	Object   string      `json:"name"`
+	Prop     string      `json:"prop"`
+	Value    interface{} `json:"value,omitempty"`
+	Userdata string      `json:"userdata"`
+}
+
+// send a getprop or setprop and wait for the answer
+func (c *Conn) prop(event string, r propRequest) (*PropertyEvent, error) {
+	r.Userdata = randomTag()
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	err = c.Send(event, string(data))
+	if err != nil {
+		return nil, err
+	}
+	e, err := c.Await(func(e Event) bool {
+		p, ok := e.(*PropertyEvent)
+		return ok && p.Userdata == r.Userdata
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e.(*PropertyEvent), nil
+}
+
+// Value of a command property (eg "status", "name", "cwd"), decoded into v
+func (c *Conn) GetProp(id liblush.CmdId, prop string, v interface{}) error {
+	p, err := c.prop("getprop", propRequest{Object: fmt.Sprintf("cmd%d", id), Prop: prop})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(p.Value, v)
+}
+
+// Set a command property, returns once the server has done so
+func (c *Conn) SetProp(id liblush.CmdId, prop string, value interface{}) error {
+	_, err := c.prop("setprop", propRequest{Object: fmt.Sprintf("cmd%d", id), Prop: prop, Value: value})
+	return err
+}
+
+// Send an event about a command and wait for the server to have handled it:
+// errors are only sent to us, so a getprop that comes back means it went fine
+func (c *Conn) call(id liblush.CmdId, event, payload string) error {
+	err := c.Send(event, payload)
+	if err != nil {
+		return err
+	}
+	var status Status
+	return c.GetProp(id, "status", &status)
+}
+
+// Options of a new command. See cmdOptions in the server for all of them,
+// these are the common ones.
+type NewOptions struct {
+	Cmd  string   `json:"cmd"`
+	Args []string `json:"args"`
+	Name string   `json:"name,omitempty"`
+	// zero for the default
+	StdoutScrollback int `json:"stdoutScrollback,omitempty"`
+	StderrScrollback int `json:"stderrScrollback,omitempty"`
+	// in seconds, zero for none
+	Timeout float64 `json:"timeout,omitempty"`
+	// the "callback" key is used by New to recognize its command
+	UserData map[string]interface{} `json:"userdata"`
+}
+
+// Create a command (without starting it)
+func (c *Conn) New(opts NewOptions) (*CmdMetadata, error) {
+	tag := randomTag()
+	ud := map[string]interface{}{}
+	for k, v := range opts.UserData {
+		ud[k] = v
+	}
+	ud["callback"] = tag
+	opts.UserData = ud
+	if opts.Args == nil {
+		opts.Args = []string{}
+	}
+	data, err := json.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+	err = c.Send("new", string(data))
+	if err != nil {
+		return nil, err
+	}
+	e, err := c.Await(func(e Event) bool {
+		nc, ok := e.(*NewCmdEvent)
+		if !ok {
+			return false
+		}
+		ud, _ := nc.Cmd.UserData.(map[string]interface{})
+		return ud["callback"] == tag
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &e.(*NewCmdEvent).Cmd, nil
+}
+
+func (c *Conn) Start(id liblush.CmdId) error {
+	return c.call(id, "start", fmt.Sprint(id))
+}
+
+// Walk the stop sequence of a command. Returns when the server started
+// stopping it, not when it exited.
+func (c *Conn) Stop(id liblush.CmdId) error {
+	return c.call(id, "stop", fmt.Sprint(id))
+}
+
+// Send a signal by its name, eg "SIGINT"
+func (c *Conn) Signal(id liblush.CmdId, signal string) error {
+	return c.call(id, "signal", fmt.Sprintf("%d;%s", id, signal))
+}
+
+// Receive StreamEvents for this stream ("stdout" or "stderr") of a command.
+// All connected clients receive them, so do other subscribers of the same
+// stream.
+func (c *Conn) Subscribe(id liblush.CmdId, stream string) error {
+	if stream != "stdout" && stream != "stderr" {
+		return errors.New("unknown stream: " + stream)
+	}
+	return c.call(id, "subscribe", fmt.Sprintf("%d;%s", id, stream))
+}
+
+func (c *Conn) getJson(path string, v interface{}) error {
+	req, err := c.request("GET", path, nil)
+	if err != nil {
+		return err
+	}
+	body, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+// Metadata of all commands
+func (c *Conn) List() ([]CmdMetadata, error) {
+	var mds []CmdMetadata
+	err := c.getJson("/api/cmds", &mds)
+	return mds, err
+}
+
+// Metadata of one command, including its scrollback
+func (c *Conn) Metadata(id liblush.CmdId) (*CmdMetadata, error) {
+	var md CmdMetadata
+	err := c.getJson(fmt.Sprintf("/%d.json", id), &md)
+	return &md, err
+}
+
+// POST /N/send or /N/close
+func (c *Conn) stdin(id liblush.CmdId, action, data string) error {
+	form := url.Values{"stream": {"stdin"}, "data": {data}, "noredirect": {"1"}}
+	req, err := c.request("POST", fmt.Sprintf("/%d/%s", id, action), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_, err = c.do(req)
+	return err
+}
+
+// Write to the stdin of a command
+func (c *Conn) Write(id liblush.CmdId, data []byte) error {
+	return c.stdin(id, "send", string(data))
+}
+
+func (c *Conn) CloseStdin(id liblush.CmdId) error {
+	return c.stdin(id, "close", "")
+}
+
+// copy r to the stdin of a command until EOF, then close its stdin
+func (c *Conn) forwardStdin(id liblush.CmdId, r io.Reader) error {
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if err := c.Write(id, buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return c.CloseStdin(id)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Copy the output of a command to stdout and stderr, and stdin (if not nil)
+// to its stdin, until it exits. If it already exited, write its scrollback.
+// Returns its final status. The stream events of the command are used up, all
+// other events remain for Next.
+func (c *Conn) Attach(id liblush.CmdId, stdin io.Reader, stdout, stderr io.Writer) (Status, error) {
+	// a no-op if somebody (eg the browser) already did
+	for _, stream := range []string{"stdout", "stderr"} {
+		err := c.Subscribe(id, stream)
+		if err != nil {
+			return Status{}, err
+		}
+	}
+	var kept []Event
+	defer func() {
+		c.pending = append(kept, c.pending...)
+	}()
+	// after subscribing, so we can't miss it exiting
+	md, err := c.Metadata(id)
+	if err != nil {
+		return Status{}, err
+	}
+	if md.Status.Exited() {
+		// too late for streaming, this is all there is. that includes the
+		// data of any stream events we got meanwhile.
+		for _, e := range c.pending {
+			if se, ok := e.(*StreamEvent); !ok || se.Id != id {
+				kept = append(kept, e)
+			}
+		}
+		c.pending = nil
+		io.WriteString(stdout, md.Stdout)
+		io.WriteString(stderr, md.Stderr)
+		return md.Status, nil
+	}
+	stdinerr := make(chan error, 1)
+	if stdin != nil {
+		go func() {
+			stdinerr <- c.forwardStdin(id, stdin)
+		}()
+	}
+	var status Status
+	for !status.Exited() {
+		e, err := c.Next()
+		if err != nil {
+			return Status{}, err
+		}
+		switch e := e.(type) {
+		case *ErrorEvent:
+			return Status{}, e
+		case *StreamEvent:
+			if e.Id != id {
+				kept = append(kept, e)
+			} else if e.Stream == "stderr" {
+				stderr.Write(e.Data)
+			} else {
+				stdout.Write(e.Data)
+			}
+		case *PropertyEvent:
+			if pid, ok := e.CmdId(); ok && pid == id && e.Prop == "status" {
+				json.Unmarshal(e.Value, &status)
+			}
+			kept = append(kept, e)
+		default:
+			kept = append(kept, e)
+		}
+	}
+	select {
+	case err = <-stdinerr:
+		if err != nil {
+			err = fmt.Errorf("stdin: %v", err)
+		}
+	default:
+		// still reading, which is fine: it exited
+	}
+	return status, err
+}
@@ -0,0 +1,208 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package lushclient
+
+// Events sent by the server over the control websocket. Every message is
+// "name;payload". The events a client is likely to care about get their own
+// type, everything else is a RawEvent.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hraban/lush/liblush"
+)
+
+type Event interface {
+	// as it is on the wire, eg "stream"
+	EventName() string
+}
+
+// any event without a specific type
+type RawEvent struct {
+	Name    string
+	Payload string
+}
+
+func (e *RawEvent) EventName() string { return e.Name }
+
+// first event on every connection: the id of this client
+type ClientIdEvent struct {
+	Id uint32
+}
+
+func (e *ClientIdEvent) EventName() string { return "clientid" }
+
+// ids of all connected clients, sent whenever a client connects
+type AllClientsEvent struct {
+	Ids []uint32
+}
+
+func (e *AllClientsEvent) EventName() string { return "allclients" }
+
+// error caused by an event this client sent. only this client receives it.
+type ErrorEvent struct {
+	Msg string
+}
+
+func (e *ErrorEvent) EventName() string { return "error" }
+
+func (e *ErrorEvent) Error() string { return e.Msg }
+
+// a command was created
+type NewCmdEvent struct {
+	Cmd CmdMetadata
+}
+
+func (e *NewCmdEvent) EventName() string { return "newcmd" }
+
+// output of a command on a subscribed stream
+type StreamEvent struct {
+	Id     liblush.CmdId
+	Stream string
+	Data   []byte
+}
+
+func (e *StreamEvent) EventName() string { return "stream" }
+
+// one JSON record on a subscribed stream in record mode
+type RecordEvent struct {
+	Id     liblush.CmdId
+	Stream string
+	Record json.RawMessage
+}
+
+func (e *RecordEvent) EventName() string { return "record" }
+
+// value of a property, in reply to getprop and setprop or because it changed
+type PropertyEvent struct {
+	// eg "cmd3"
+	Object string          `json:"name"`
+	Prop   string          `json:"prop"`
+	Value  json.RawMessage `json:"value"`
+	// as passed to getprop or setprop, nil for spontaneous updates
+	Userdata interface{} `json:"userdata"`
+}
+
+func (e *PropertyEvent) EventName() string { return "property" }
+
+// id of the command this property belongs to, false if it is not a command
+func (e *PropertyEvent) CmdId() (liblush.CmdId, bool) {
+	if !strings.HasPrefix(e.Object, "cmd") {
+		return 0, false
+	}
+	id, err := liblush.ParseCmdId(e.Object[3:])
+	return id, err == nil
+}
+
+type Status struct {
+	// 0: not started, 1: running, 2: success, 3: error
+	Code     int    `json:"code"`
+	Err      string `json:"err"`
+	TimedOut bool   `json:"timedout,omitempty"`
+}
+
+func (s Status) Exited() bool {
+	return s.Code >= 2
+}
+
+func (s Status) Success() bool {
+	return s.Code == 2
+}
+
+// for humans
+func (s Status) String() string {
+	switch s.Code {
+	case 0:
+		return "new"
+	case 1:
+		return "running"
+	case 2:
+		return "done"
+	}
+	if s.TimedOut {
+		return "timed out"
+	}
+	return "failed"
+}
+
+// metadata of a command as sent by the server in newcmd events and over
+// HTTP. not every field the server sends is here.
+type CmdMetadata struct {
+	Id           liblush.CmdId `json:"nid"`
+	Name         string        `json:"name"`
+	Cmd          string        `json:"cmd"`
+	Args         []string      `json:"args"`
+	ExpandedArgv []string      `json:"expandedArgv,omitempty"`
+	Cwd          string        `json:"cwd"`
+	StartWd      string        `json:"startwd"`
+	Status       Status        `json:"status"`
+	UserData     interface{}   `json:"userdata"`
+	Stdout       string        `json:"stdout"`
+	Stderr       string        `json:"stderr"`
+}
+
+// parse "id;stream;rest"
+func parseStreamPayload(payload string) (liblush.CmdId, string, string, error) {
+	parts := strings.SplitN(payload, ";", 3)
+	if len(parts) != 3 {
+		return 0, "", "", errors.New("expected id;stream;data")
+	}
+	id, err := liblush.ParseCmdId(parts[0])
+	return id, parts[1], parts[2], err
+}
+
+// Parse a message from the server
+func ParseEvent(msg string) (Event, error) {
+	parts := strings.SplitN(msg, ";", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("malformed event: %q", msg)
+	}
+	name, payload := parts[0], parts[1]
+	var e Event
+	var err error
+	switch name {
+	case "clientid":
+		var id uint32
+		_, err = fmt.Sscan(payload, &id)
+		e = &ClientIdEvent{id}
+	case "allclients":
+		var ids []uint32
+		err = json.Unmarshal([]byte(payload), &ids)
+		e = &AllClientsEvent{ids}
+	case "error":
+		var msg string
+		err = json.Unmarshal([]byte(payload), &msg)
+		e = &ErrorEvent{msg}
+	case "newcmd":
+		var ev NewCmdEvent
+		err = json.Unmarshal([]byte(payload), &ev.Cmd)
+		e = &ev
+	case "stream":
+		var ev StreamEvent
+		var data string
+		ev.Id, ev.Stream, data, err = parseStreamPayload(payload)
+		ev.Data = []byte(data)
+		e = &ev
+	case "record":
+		var ev RecordEvent
+		var data string
+		ev.Id, ev.Stream, data, err = parseStreamPayload(payload)
+		ev.Record = json.RawMessage(data)
+		e = &ev
+	case "property":
+		var ev PropertyEvent
+		err = json.Unmarshal([]byte(payload), &ev)
+		e = &ev
+	default:
+		e = &RawEvent{name, payload}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("malformed %s event: %v", name, err)
+	}
+	return e, nil
+}
@@ -0,0 +1,46 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package lushclient
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseEvent(t *testing.T) {
+	for _, tc := range []struct {
+		msg      string
+		expected Event
+	}{
+		{"clientid;7", &ClientIdEvent{7}},
+		{"allclients;[1,3]", &AllClientsEvent{[]uint32{1, 3}}},
+		{`error;"no such command: 9"`, &ErrorEvent{"no such command: 9"}},
+		{"stream;3;stdout;a;b\n", &StreamEvent{3, "stdout", []byte("a;b\n")}},
+		{`record;3;stderr;{"a":1}`, &RecordEvent{3, "stderr", []byte(`{"a":1}`)}},
+		{`newcmd;{"nid":4,"cmd":"ls","args":["-l"],"status":{"code":1,"err":""}}`,
+			&NewCmdEvent{CmdMetadata{Id: 4, Cmd: "ls", Args: []string{"-l"}, Status: Status{Code: 1}}}},
+		{`property;{"name":"cmd4","prop":"status","value":{"code":2},"userdata":"x"}`,
+			&PropertyEvent{"cmd4", "status", []byte(`{"code":2}`), "x"}},
+		{`chdir;"/tmp"`, &RawEvent{"chdir", `"/tmp"`}},
+	} {
+		e, err := ParseEvent(tc.msg)
+		if err != nil {
+			t.Errorf("%q: %v", tc.msg, err)
+			continue
+		}
+		if !reflect.DeepEqual(e, tc.expected) {
+			t.Errorf("%q: expected %#v, got %#v", tc.msg, tc.expected, e)
+		}
+	}
+	for _, msg := range []string{"nosemicolon", "clientid;x", "stream;3;stdout", "property;{"} {
+		if _, err := ParseEvent(msg); err == nil {
+			t.Errorf("%q: expected error", msg)
+		}
+	}
+	p := &PropertyEvent{Object: "cmd12"}
+	if id, ok := p.CmdId(); !ok || id != 12 {
+		t.Errorf("Expected cmd 12, got %d (%v)", id, ok)
+	}
+}
@@ -7,18 +7,82 @@ package main
 import (
 	"flag"
 	"log"
+	"os"
+	"strings"
+
+	"github.com/hraban/lush/liblush"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "client" {
+		os.Exit(clientMain(os.Args[2:]))
+	}
 	s := newServer()
 	listenaddr := flag.String("l", "localhost:8081", "listen address")
 	passwd := flag.String("p", "", "password")
+	usersfile := flag.String("users", "",
+		"file with name:password[:unixaccount] lines. commands run as the unix account of the master (requires root)")
 	flag.BoolVar(&s.everybodyMaster, "everybodymaster", false,
 		"grant every incoming connection full privileges. when false only the first connection is a master")
+	sandbox := flag.Bool("sandbox", false,
+		"run all commands in a sandbox (Linux only)")
+	sandboxdirs := flag.String("sandboxdirs", "/bin,/sbin,/lib,/lib64,/usr,/etc",
+		"comma separated list of directories visible (read-only) in the sandbox")
+	sandboxnet := flag.Bool("sandboxnet", false,
+		"give sandboxed commands access to the network")
+	historyfile := flag.String("history", defaultHistoryFile(),
+		"file to save the command history in. empty to keep it in memory. with -users the "+historyFileName+" in the home dir of the master's account is used instead")
+	aliasfile := flag.String("aliases", defaultAliasFile(),
+		"file to save aliases in. empty to keep them in memory. with -users the "+aliasFileName+" in the home dir of the master's account is used instead")
+	rcfile := flag.String("rc", defaultRcFile(),
+		"file to configure the session with at startup. with -users the .lushrc in the home dir of the master's account is used instead")
+	hooksfile := flag.String("hooks", "",
+		"JSON file with hooks to run when commands exit")
 	flag.Parse()
+	if *hooksfile != "" {
+		err := s.LoadHooks(*hooksfile)
+		if err != nil {
+			log.Fatalf("Failed to load hooks: %v", err)
+		}
+	}
+	if *sandbox {
+		s.session.SetSandbox(&liblush.Sandbox{
+			Dirs:    strings.Split(*sandboxdirs, ","),
+			Network: *sandboxnet,
+		})
+	}
+	if *passwd != "" && *usersfile != "" {
+		log.Fatal("-p and -users are mutually exclusive")
+	}
 	if *passwd != "" {
 		s.SetPassword(*passwd)
 	}
+	if *usersfile != "" {
+		users, err := parseUsersFile(*usersfile)
+		if err != nil {
+			log.Fatalf("Failed to read users: %v", err)
+		}
+		s.SetUsers(users)
+		s.homeRc = true
+		s.homeAliases = *aliasfile != ""
+		s.homeHistory = *historyfile != ""
+	} else {
+		if *historyfile != "" {
+			err := s.history.Open(*historyfile, nil)
+			if err != nil {
+				log.Fatalf("Failed to load history: %v", err)
+			}
+		}
+		if *aliasfile != "" {
+			err := s.OpenAliases(*aliasfile, nil)
+			if err != nil {
+				log.Fatalf("Failed to load aliases: %v", err)
+			}
+		}
+		if *rcfile != "" {
+			s.LoadRc(*rcfile)
+		}
+	}
 	err := s.Run(*listenaddr)
 	if err != nil {
 		log.Fatalf("Failed to listen on %s: %v", *listenaddr, err)
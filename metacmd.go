@@ -16,26 +16,60 @@ import (
 type metacmd struct{ liblush.Cmd }
 
 type statusJson struct {
-	Code   int    `json:"code"`
-	ErrStr string `json:"err"`
+	Code     int    `json:"code"`
+	ErrStr   string `json:"err"`
+	TimedOut bool   `json:"timedout,omitempty"`
+}
+
+type sandboxJson struct {
+	Dirs    []string `json:"dirs"`
+	Network bool     `json:"network"`
+}
+
+func sandbox2json(sb *liblush.Sandbox) *sandboxJson {
+	if sb == nil {
+		return nil
+	}
+	return &sandboxJson{sb.Dirs, sb.Network}
 }
 
 type cmdmetadata struct {
-	Id               liblush.CmdId `json:"nid"`
-	HtmlId           string        `json:"htmlid"`
-	Name             string        `json:"name"`
-	Cmd              string        `json:"cmd"`
-	Args             []string      `json:"args"`
-	Cwd              string        `json:"cwd"`
-	StartWd          string        `json:"startwd"`
-	Status           statusJson    `json:"status"`
-	StdouttoId       liblush.CmdId `json:"stdoutto,omitempty"`
-	StderrtoId       liblush.CmdId `json:"stderrto,omitempty"`
-	StdoutScrollback int           `json:"stdoutScrollback"`
-	StderrScrollback int           `json:"stderrScrollback"`
-	UserData         interface{}   `json:"userdata"`
-	Stdout           string        `json:"stdout"`
-	Stderr           string        `json:"stderr"`
+	Id               liblush.CmdId  `json:"nid"`
+	HtmlId           string         `json:"htmlid"`
+	Name             string         `json:"name"`
+	Cmd              string         `json:"cmd"`
+	Args             []string       `json:"args"`
+	Literal          []bool         `json:"literal,omitempty"`
+	Expand           bool           `json:"expand,omitempty"`
+	ExpandedArgv     []string       `json:"expandedArgv,omitempty"`
+	Cwd              string         `json:"cwd"`
+	StartWd          string         `json:"startwd"`
+	Status           statusJson     `json:"status"`
+	StdouttoId       liblush.CmdId  `json:"stdoutto,omitempty"`
+	StderrtoId       liblush.CmdId  `json:"stderrto,omitempty"`
+	OnExitId         liblush.CmdId  `json:"onexit,omitempty"`
+	OnSuccessId      liblush.CmdId  `json:"onsuccess,omitempty"`
+	OnFailureId      liblush.CmdId  `json:"onfailure,omitempty"`
+	StdoutScrollback int            `json:"stdoutScrollback"`
+	StderrScrollback int            `json:"stderrScrollback"`
+	StdoutRecords    bool           `json:"stdoutRecords"`
+	StderrRecords    bool           `json:"stderrRecords"`
+	UserData         interface{}    `json:"userdata"`
+	Timeout          float64        `json:"timeout,omitempty"`
+	StopSequence     []stopStepJson `json:"stopSequence"`
+	Limits           limitsJson     `json:"limits"`
+	Sandbox          *sandboxJson   `json:"sandbox,omitempty"`
+	Watch            *watchJson     `json:"watch,omitempty"`
+	Stdout           string         `json:"stdout"`
+	Stderr           string         `json:"stderr"`
+
+	// see triggers.go
+	Triggers       []triggerJson      `json:"triggers"`
+	TriggerMatches []triggerMatchJson `json:"triggermatches"`
+
+	// 0 for a byte scrollback, see liblush.LineBuffer
+	StdoutScrollbackLines int `json:"stdoutScrollbackLines"`
+	StderrScrollbackLines int `json:"stderrScrollbackLines"`
 }
 
 // if this writer is the instream of a command return that
@@ -75,6 +109,7 @@ func cmdstatus2int(s liblush.CmdStatus) (i int) {
 
 func cmdstatus2json(s liblush.CmdStatus) (sjson statusJson) {
 	sjson.Code = cmdstatus2int(s)
+	sjson.TimedOut = s.TimedOut()
 	if err := s.Err(); err != nil {
 		sjson.ErrStr = err.Error()
 	}
@@ -98,20 +133,43 @@ func (mc metacmd) Metadata() (data cmdmetadata, err error) {
 		data.Cmd = argv[0]
 		data.Args = argv[1:]
 	}
+	data.Literal = mc.LiteralArgs()
+	data.Expand = mc.Expand()
+	data.ExpandedArgv = mc.ExpandedArgv()
 	data.Cwd, err = mc.Cwd()
 	if err != nil {
 		data.Cwd = fmt.Sprintf("<%v>", err)
 	}
 	data.StartWd = mc.StartWd()
 	data.UserData = mc.UserData()
+	data.Timeout = mc.Timeout().Seconds()
+	data.StopSequence = stopSequence2json(mc.StopSequence())
+	data.Limits = limitsJson(mc.Limits())
+	data.Sandbox = sandbox2json(mc.Sandbox())
+	data.Watch = watch2json(mc.Watch())
+	data.Triggers = triggers2json(mc.Triggers())
+	data.TriggerMatches = triggerMatches2json(mc.TriggerMatches())
 	data.StdoutScrollback = mc.Stdout().Scrollback().Size()
 	data.StderrScrollback = mc.Stderr().Scrollback().Size()
+	data.StdoutScrollbackLines = mc.Stdout().ScrollbackLines()
+	data.StderrScrollbackLines = mc.Stderr().ScrollbackLines()
+	data.StdoutRecords = mc.Stdout().RecordMode()
+	data.StderrRecords = mc.Stderr().RecordMode()
 	if cmd := pipedcmd(mc.Stdout()); cmd != nil {
 		data.StdouttoId = cmd.Id()
 	}
 	if cmd := pipedcmd(mc.Stderr()); cmd != nil {
 		data.StderrtoId = cmd.Id()
 	}
+	if next := mc.Successor(liblush.OnExit); next != nil {
+		data.OnExitId = next.Id()
+	}
+	if next := mc.Successor(liblush.OnSuccess); next != nil {
+		data.OnSuccessId = next.Id()
+	}
+	if next := mc.Successor(liblush.OnFailure); next != nil {
+		data.OnFailureId = next.Id()
+	}
 	data.Status = cmdstatus2json(mc.Status())
 	data.Stdout, err = stringifyWriterTo(mc.Stdout().Scrollback())
 	if err != nil {
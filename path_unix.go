@@ -6,4 +6,10 @@
 
 package main
 
+import "os"
+
 const PATHSEP = ":"
+
+func isExecutable(fi os.FileInfo) bool {
+	return fi.Mode().IsRegular() && fi.Mode()&0111 != 0
+}
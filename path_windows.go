@@ -4,4 +4,21 @@
 
 package main
 
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
 const PATHSEP = ";"
+
+func isExecutable(fi os.FileInfo) bool {
+	if !fi.Mode().IsRegular() {
+		return false
+	}
+	switch strings.ToLower(filepath.Ext(fi.Name())) {
+	case ".exe", ".com", ".bat", ".cmd":
+		return true
+	}
+	return false
+}
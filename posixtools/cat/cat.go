@@ -0,0 +1,43 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/hraban/lush/posixtools/posix"
+)
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := posix.NewFlagSet("cat", "[-n] [file...]")
+	// -u (unbuffered) is required by POSIX, and we never buffer anyway
+	fs.Bool('u')
+	number := fs.Bool('n')
+	files, err := fs.Parse(args)
+	if err != nil {
+		return fs.Fail(stderr, err)
+	}
+	lineno := 0
+	return posix.EachFile(fs, files, stdin, stderr, func(name string, r io.Reader) error {
+		if !*number {
+			_, err := io.Copy(stdout, r)
+			return err
+		}
+		scanner := posix.NewLineReader(r)
+		for scanner.Scan() {
+			lineno++
+			_, err := fmt.Fprintf(stdout, "%6d\t%s\n", lineno, scanner.Text())
+			if err != nil {
+				return err
+			}
+		}
+		return scanner.Err()
+	})
+}
+
+func main() {
+	posix.Main(run)
+}
@@ -0,0 +1,35 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/hraban/lush/posixtools/posix"
+)
+
+func TestCat(t *testing.T) {
+	f, err := ioutil.TempFile("", "lush-cat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("file\n")
+	f.Close()
+	out, _, status := posix.Capture(run, "stdin\n", f.Name(), "-", f.Name())
+	if status != 0 || out != "file\nstdin\nfile\n" {
+		t.Errorf("unexpected output (%d): %q", status, out)
+	}
+	out, _, _ = posix.Capture(run, "a\nb\n", "-n")
+	if out != "     1\ta\n     2\tb\n" {
+		t.Errorf("unexpected numbered output: %q", out)
+	}
+	_, errout, status := posix.Capture(run, "", "/does/not/exist")
+	if status != 1 || errout == "" {
+		t.Errorf("expected error for missing file, got %d %q", status, errout)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hraban/lush/posixtools/posix"
+)
+
+func copyFile(src, dst string, srcfi os.FileInfo) error {
+	// opening it would truncate the source
+	if dstfi, err := os.Stat(dst); err == nil && os.SameFile(srcfi, dstfi) {
+		return fmt.Errorf("%s and %s are the same file", src, dst)
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, srcfi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// copy a symlink as a symlink
+func copyLink(src, dst string) error {
+	target, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(target, dst)
+}
+
+func copyTree(src, dst string, recursive bool) error {
+	stat := os.Stat
+	if recursive {
+		// following symlinks could go around in circles forever
+		stat = os.Lstat
+	}
+	fi, err := stat(src)
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		return copyLink(src, dst)
+	}
+	if !fi.IsDir() {
+		return copyFile(src, dst, fi)
+	}
+	if !recursive {
+		return fmt.Errorf("%s is a directory (not copied)", src)
+	}
+	if within(src, dst) {
+		return fmt.Errorf("cannot copy directory %s into itself, %s", src, dst)
+	}
+	err = os.Mkdir(dst, fi.Mode().Perm())
+	if err != nil && !os.IsExist(err) {
+		return err
+	}
+	fis, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, child := range fis {
+		err = copyTree(filepath.Join(src, child.Name()), filepath.Join(dst, child.Name()), true)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// absolute path without symlinks, as far as it exists
+func realPath(name string) string {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return filepath.Clean(name)
+	}
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		return real
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Dir(abs))
+	if err != nil {
+		return abs
+	}
+	return filepath.Join(dir, filepath.Base(abs))
+}
+
+// is path dir itself or somewhere below it?
+func within(dir, path string) bool {
+	dir, path = realPath(dir), realPath(path)
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+func isDir(name string) bool {
+	fi, err := os.Stat(name)
+	return err == nil && fi.IsDir()
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := posix.NewFlagSet("cp", "[-R] source... target")
+	recursive, recursive2 := fs.Bool('R'), fs.Bool('r')
+	operands, err := fs.Parse(args)
+	if err != nil {
+		return fs.Fail(stderr, err)
+	}
+	if len(operands) < 2 {
+		return fs.Fail(stderr, errors.New("missing operand"))
+	}
+	srcs, target := operands[:len(operands)-1], operands[len(operands)-1]
+	intoDir := isDir(target)
+	if len(srcs) > 1 && !intoDir {
+		return fs.Fail(stderr, fmt.Errorf("target %s is not a directory", target))
+	}
+	status := 0
+	for _, src := range srcs {
+		dst := target
+		if intoDir {
+			dst = filepath.Join(target, filepath.Base(src))
+		}
+		err := copyTree(src, dst, *recursive || *recursive2)
+		if err != nil {
+			fs.Errorf(stderr, "%v", err)
+			status = 1
+		}
+	}
+	return status
+}
+
+func main() {
+	posix.Main(run)
+}
@@ -0,0 +1,70 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hraban/lush/posixtools/posix"
+)
+
+func TestCp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lush-cp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := func(name string) string { return filepath.Join(dir, name) }
+	os.MkdirAll(p("src/deep"), 0755)
+	ioutil.WriteFile(p("src/deep/file"), []byte("data"), 0644)
+	ioutil.WriteFile(p("file"), []byte("data"), 0644)
+	_, _, status := posix.Capture(run, "", p("file"), p("copy"))
+	if data, _ := ioutil.ReadFile(p("copy")); status != 0 || string(data) != "data" {
+		t.Errorf("copying file failed (%d): %q", status, data)
+	}
+	_, _, status = posix.Capture(run, "", p("src"), p("dst"))
+	if status != 1 {
+		t.Errorf("expected error copying directory without -R, got %d", status)
+	}
+	_, _, status = posix.Capture(run, "", "-R", p("src"), p("dst"))
+	if data, _ := ioutil.ReadFile(p("dst/deep/file")); status != 0 || string(data) != "data" {
+		t.Errorf("recursive copy failed (%d): %q", status, data)
+	}
+	_, _, status = posix.Capture(run, "", p("file"), p("copy"), p("dst"))
+	if _, err := os.Stat(p("dst/copy")); status != 0 || err != nil {
+		t.Errorf("copy into directory failed (%d): %v", status, err)
+	}
+	_, _, status = posix.Capture(run, "", p("file"), p("copy"), p("file"))
+	if status != 2 {
+		t.Errorf("expected usage error copying to non-directory, got %d", status)
+	}
+	_, stderr, status := posix.Capture(run, "", p("file"), p("file"))
+	if data, _ := ioutil.ReadFile(p("file")); status != 1 || string(data) != "data" || !strings.Contains(stderr, "same file") {
+		t.Errorf("copying file onto itself (%d, %q): %q", status, stderr, data)
+	}
+	_, _, status = posix.Capture(run, "", p("file"), dir)
+	if data, _ := ioutil.ReadFile(p("file")); status != 1 || string(data) != "data" {
+		t.Errorf("copying file into its own directory (%d): %q", status, data)
+	}
+	// a loop, copied as it is
+	if os.Symlink("..", p("src/deep/up")) == nil {
+		_, _, status = posix.Capture(run, "", "-R", p("src"), p("loop"))
+		if target, err := os.Readlink(p("loop/deep/up")); status != 0 || target != ".." {
+			t.Errorf("copying symlink (%d): %q %v", status, target, err)
+		}
+		os.Remove(p("src/deep/up"))
+	}
+	_, stderr, status = posix.Capture(run, "", "-R", p("src"), p("src/deep"))
+	if status != 1 || !strings.Contains(stderr, "into itself") {
+		t.Errorf("copying directory into itself (%d): %q", status, stderr)
+	}
+	if _, err := os.Stat(p("src/deep/src")); err == nil {
+		t.Error("copied directory into itself")
+	}
+}
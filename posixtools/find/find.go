@@ -0,0 +1,143 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+// find doesn't take options but an expression, so no FlagSet parsing here.
+// Only a conjunction of the most common primaries is supported: -name,
+// -iname, -type, -maxdepth and -print.
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hraban/lush/posixtools/posix"
+)
+
+type expr struct {
+	names, inames []string
+	// "f" or "d", or empty for anything
+	typ      string
+	maxdepth int
+}
+
+func parseExpr(args []string) (e expr, err error) {
+	e.maxdepth = -1
+	for i := 0; i < len(args); i++ {
+		primary := args[i]
+		if primary == "-print" {
+			continue
+		}
+		if i+1 == len(args) {
+			return e, fmt.Errorf("missing argument to %s", primary)
+		}
+		i++
+		arg := args[i]
+		switch primary {
+		case "-name":
+			e.names = append(e.names, arg)
+		case "-iname":
+			e.inames = append(e.inames, strings.ToLower(arg))
+		case "-type":
+			if arg != "f" && arg != "d" {
+				return e, fmt.Errorf("unsupported type: %s", arg)
+			}
+			e.typ = arg
+		case "-maxdepth":
+			e.maxdepth, err = strconv.Atoi(arg)
+			if err != nil || e.maxdepth < 0 {
+				return e, fmt.Errorf("invalid depth: %s", arg)
+			}
+		default:
+			return e, fmt.Errorf("unknown primary: %s", primary)
+		}
+	}
+	// syntax errors in patterns only show up when matching: check now
+	for _, pattern := range append(e.names, e.inames...) {
+		if _, err = filepath.Match(pattern, ""); err != nil {
+			return e, fmt.Errorf("invalid pattern: %s", pattern)
+		}
+	}
+	return e, nil
+}
+
+func (e expr) match(fi os.FileInfo) bool {
+	switch {
+	case e.typ == "f" && !fi.Mode().IsRegular():
+		return false
+	case e.typ == "d" && !fi.IsDir():
+		return false
+	}
+	for _, pattern := range e.names {
+		if ok, _ := filepath.Match(pattern, fi.Name()); !ok {
+			return false
+		}
+	}
+	for _, pattern := range e.inames {
+		if ok, _ := filepath.Match(pattern, strings.ToLower(fi.Name())); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := posix.NewFlagSet("find", "[path...] [expression]")
+	// paths are everything up to the first primary
+	i := 0
+	for i < len(args) && !strings.HasPrefix(args[i], "-") {
+		i++
+	}
+	paths := args[:i]
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	e, err := parseExpr(args[i:])
+	if err != nil {
+		return fs.Fail(stderr, err)
+	}
+	status := 0
+	for _, root := range paths {
+		// Walk cleans paths, but they are printed starting with the root as
+		// given: find . prints ./a, not a
+		clean := filepath.Clean(root)
+		filepath.Walk(clean, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				fs.Errorf(stderr, "%v", err)
+				status = 1
+				return nil
+			}
+			depth := 0
+			name := root
+			if path != clean {
+				rel, _ := filepath.Rel(clean, path)
+				depth = strings.Count(rel, string(filepath.Separator)) + 1
+				if strings.HasSuffix(root, string(filepath.Separator)) {
+					name = root + rel
+				} else {
+					name = root + string(filepath.Separator) + rel
+				}
+			}
+			if e.maxdepth >= 0 && depth > e.maxdepth {
+				if fi.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if e.match(fi) {
+				fmt.Fprintln(stdout, name)
+			}
+			return nil
+		})
+	}
+	return status
+}
+
+func main() {
+	posix.Main(run)
+}
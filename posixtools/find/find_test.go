@@ -0,0 +1,75 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hraban/lush/posixtools/posix"
+)
+
+func TestFind(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lush-find")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "a", "b"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "x.go"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "a", "y.GO"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "a", "b", "z.go"), nil, 0644)
+	for _, c := range []struct {
+		args     []string
+		expected []string
+	}{
+		{nil, []string{"", "a", "a/b", "a/b/z.go", "a/y.GO", "x.go"}},
+		{[]string{"-type", "d"}, []string{"", "a", "a/b"}},
+		{[]string{"-name", "*.go", "-print"}, []string{"a/b/z.go", "x.go"}},
+		{[]string{"-iname", "*.go", "-maxdepth", "2"}, []string{"a/y.GO", "x.go"}},
+		{[]string{"-maxdepth", "0"}, []string{""}},
+	} {
+		out, _, status := posix.Capture(run, "", append([]string{dir}, c.args...)...)
+		var expected []string
+		for _, name := range c.expected {
+			expected = append(expected, filepath.Join(dir, name))
+		}
+		if status != 0 || out != strings.Join(expected, "\n")+"\n" {
+			t.Errorf("%q: expected %q, got %q (%d)", c.args, expected, out, status)
+		}
+	}
+	// paths start with the root as given
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	for _, c := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"-type", "d"}, ".\n./a\n./a/b\n"},
+		{[]string{".", "-type", "d"}, ".\n./a\n./a/b\n"},
+		{[]string{"./", "-type", "d"}, "./\n./a\n./a/b\n"},
+		{[]string{"a/", "-name", "*.go"}, "a/b/z.go\n"},
+		{[]string{"./a//b"}, "./a//b\n./a//b/z.go\n"},
+	} {
+		out, _, status := posix.Capture(run, "", c.args...)
+		if status != 0 || out != filepath.FromSlash(c.expected) {
+			t.Errorf("%q: expected %q, got %q (%d)", c.args, c.expected, out, status)
+		}
+	}
+	_, _, status := posix.Capture(run, "", dir, "-exec", "rm")
+	if status != 2 {
+		t.Errorf("expected usage error for unsupported primary, got %d", status)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/hraban/lush/posixtools/posix"
+)
+
+// exit status: 0 if anything matched, 1 if nothing did, 2 on error. patterns
+// are Go regular expressions, which are close enough to EREs.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := posix.NewFlagSet("grep", "[-cFilnqv] [-e pattern | pattern] [file...]")
+	count, fixed, nocase := fs.Bool('c'), fs.Bool('F'), fs.Bool('i')
+	filesOnly, lineno, quiet, invert := fs.Bool('l'), fs.Bool('n'), fs.Bool('q'), fs.Bool('v')
+	// accepted for compatibility, we always do extended
+	fs.Bool('E')
+	pattern := fs.String('e', "")
+	operands, err := fs.Parse(args)
+	if err != nil {
+		return fs.Fail(stderr, err)
+	}
+	if *pattern == "" {
+		if len(operands) == 0 {
+			return fs.Fail(stderr, errors.New("no pattern"))
+		}
+		*pattern, operands = operands[0], operands[1:]
+	}
+	if *fixed {
+		*pattern = regexp.QuoteMeta(*pattern)
+	}
+	if *nocase {
+		*pattern = "(?i)" + *pattern
+	}
+	re, err := regexp.Compile(*pattern)
+	if err != nil {
+		fs.Errorf(stderr, "%v", err)
+		return 2
+	}
+	matched := false
+	status := posix.EachFile(fs, operands, stdin, stderr, func(name string, r io.Reader) error {
+		prefix := ""
+		if len(operands) > 1 {
+			prefix = name + ":"
+		}
+		n := 0
+		scanner := posix.NewLineReader(r)
+		for i := 1; scanner.Scan(); i++ {
+			line := scanner.Text()
+			if re.MatchString(line) == *invert {
+				continue
+			}
+			matched = true
+			n++
+			switch {
+			case *quiet:
+				return nil
+			case *filesOnly:
+				fmt.Fprintln(stdout, name)
+				return nil
+			case *count:
+			case *lineno:
+				fmt.Fprintf(stdout, "%s%d:%s\n", prefix, i, line)
+			default:
+				fmt.Fprintf(stdout, "%s%s\n", prefix, line)
+			}
+		}
+		if *count && !*quiet {
+			fmt.Fprintf(stdout, "%s%d\n", prefix, n)
+		}
+		return scanner.Err()
+	})
+	switch {
+	case status != 0 && !(*quiet && matched):
+		return 2
+	case matched:
+		return 0
+	}
+	return 1
+}
+
+func main() {
+	posix.Main(run)
+}
@@ -0,0 +1,45 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hraban/lush/posixtools/posix"
+)
+
+func TestGrep(t *testing.T) {
+	input := "foo\nbar\nFoo bar\na.b\n"
+	for _, c := range []struct {
+		args     []string
+		expected string
+		status   int
+	}{
+		{[]string{"foo"}, "foo\n", 0},
+		{[]string{"-i", "foo"}, "foo\nFoo bar\n", 0},
+		{[]string{"-v", "bar"}, "foo\na.b\n", 0},
+		{[]string{"-c", "bar"}, "2\n", 0},
+		{[]string{"-n", "-e", "^bar"}, "2:bar\n", 0},
+		{[]string{"-F", "."}, "a.b\n", 0},
+		{[]string{"-q", "bar"}, "", 0},
+		{[]string{"nope"}, "", 1},
+		{[]string{"-c", "nope"}, "0\n", 1},
+		{[]string{"("}, "", 2},
+		{nil, "", 2},
+	} {
+		out, _, status := posix.Capture(run, input, c.args...)
+		if status != c.status || out != c.expected {
+			t.Errorf("%q: expected %q (%d), got %q (%d)", c.args, c.expected,
+				c.status, out, status)
+		}
+	}
+	// longer than a bufio.Scanner can take
+	long := strings.Repeat("x", 1<<20)
+	out, _, status := posix.Capture(run, "a\n"+long+"y\n", "y$")
+	if status != 0 || out != long+"y\n" {
+		t.Errorf("Failed to match a long line (%d): %d bytes", status, len(out))
+	}
+}
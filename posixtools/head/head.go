@@ -0,0 +1,54 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/hraban/lush/posixtools/posix"
+)
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := posix.NewFlagSet("head", "[-n count] [file...]")
+	nstr := fs.String('n', "10")
+	files, err := fs.Parse(args)
+	if err != nil {
+		return fs.Fail(stderr, err)
+	}
+	n, err := fs.Int('n', *nstr)
+	if err != nil {
+		return fs.Fail(stderr, err)
+	}
+	first := true
+	return posix.EachFile(fs, files, stdin, stderr, func(name string, r io.Reader) error {
+		if len(files) > 1 {
+			if !first {
+				fmt.Fprintln(stdout)
+			}
+			fmt.Fprintf(stdout, "==> %s <==\n", name)
+		}
+		first = false
+		br := bufio.NewReader(r)
+		for i := 0; i < n; i++ {
+			line, err := br.ReadString('\n')
+			if _, werr := io.WriteString(stdout, line); werr != nil {
+				return werr
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func main() {
+	posix.Main(run)
+}
@@ -0,0 +1,32 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hraban/lush/posixtools/posix"
+)
+
+func TestHead(t *testing.T) {
+	input := strings.Repeat("line\n", 20) + "partial"
+	out, _, status := posix.Capture(run, input)
+	if status != 0 || out != strings.Repeat("line\n", 10) {
+		t.Errorf("unexpected default output (%d): %q", status, out)
+	}
+	out, _, _ = posix.Capture(run, "a\nb\nc", "-n2")
+	if out != "a\nb\n" {
+		t.Errorf("unexpected output for -n2: %q", out)
+	}
+	out, _, _ = posix.Capture(run, "a\nb\nc", "-n", "5")
+	if out != "a\nb\nc" {
+		t.Errorf("unexpected output for short input: %q", out)
+	}
+	_, _, status = posix.Capture(run, "", "-n", "x")
+	if status != 2 {
+		t.Errorf("expected usage error for invalid count, got %d", status)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hraban/lush/posixtools/posix"
+)
+
+type lister struct {
+	all, long, dirsAsFiles, classify bool
+	stdout                           io.Writer
+}
+
+func (l *lister) entry(fi os.FileInfo, name string) {
+	if l.long {
+		fmt.Fprintf(l.stdout, "%s %10d %s ", fi.Mode(), fi.Size(),
+			fi.ModTime().Format("Jan _2 15:04"))
+	}
+	fmt.Fprint(l.stdout, name)
+	if l.classify {
+		switch {
+		case fi.IsDir():
+			fmt.Fprint(l.stdout, "/")
+		case fi.Mode()&os.ModeSymlink != 0:
+			fmt.Fprint(l.stdout, "@")
+		case fi.Mode()&0111 != 0:
+			fmt.Fprint(l.stdout, "*")
+		}
+	}
+	fmt.Fprintln(l.stdout)
+}
+
+func (l *lister) dir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	fis, err := f.Readdir(-1)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	sort.Slice(fis, func(i, j int) bool { return fis[i].Name() < fis[j].Name() })
+	for _, fi := range fis {
+		if !l.all && strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+		l.entry(fi, fi.Name())
+	}
+	return nil
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := posix.NewFlagSet("ls", "[-1aFdl] [file...]")
+	l := &lister{stdout: stdout}
+	all, long, dirsAsFiles, classify := fs.Bool('a'), fs.Bool('l'), fs.Bool('d'), fs.Bool('F')
+	// one per line is all we do
+	fs.Bool('1')
+	operands, err := fs.Parse(args)
+	if err != nil {
+		return fs.Fail(stderr, err)
+	}
+	l.all, l.long, l.dirsAsFiles, l.classify = *all, *long, *dirsAsFiles, *classify
+	if len(operands) == 0 {
+		operands = []string{"."}
+	}
+	status := 0
+	// like ls: files first, then directories
+	var dirs []string
+	for _, name := range operands {
+		fi, err := os.Lstat(name)
+		if err != nil {
+			fs.Errorf(stderr, "%v", err)
+			status = 1
+			continue
+		}
+		if fi.Mode()&os.ModeSymlink != 0 && !l.dirsAsFiles {
+			if target, err := os.Stat(name); err == nil {
+				fi = target
+			}
+		}
+		if fi.IsDir() && !l.dirsAsFiles {
+			dirs = append(dirs, name)
+		} else {
+			l.entry(fi, name)
+		}
+	}
+	for i, dir := range dirs {
+		if len(operands) > 1 {
+			if i > 0 || len(dirs) < len(operands) {
+				fmt.Fprintln(stdout)
+			}
+			fmt.Fprintf(stdout, "%s:\n", filepath.Clean(dir))
+		}
+		if err := l.dir(dir); err != nil {
+			fs.Errorf(stderr, "%v", err)
+			status = 1
+		}
+	}
+	return status
+}
+
+func main() {
+	posix.Main(run)
+}
@@ -0,0 +1,48 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hraban/lush/posixtools/posix"
+)
+
+func TestLs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lush-ls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "b"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "a"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(dir, ".hidden"), nil, 0644)
+	out, _, status := posix.Capture(run, "", dir)
+	if status != 0 || out != "a\nb\nsub\n" {
+		t.Errorf("unexpected output (%d): %q", status, out)
+	}
+	out, _, _ = posix.Capture(run, "", "-aF", dir)
+	if out != ".hidden\na\nb\nsub/\n" {
+		t.Errorf("unexpected output for -aF: %q", out)
+	}
+	out, _, _ = posix.Capture(run, "", "-d", dir)
+	if out != dir+"\n" {
+		t.Errorf("unexpected output for -d: %q", out)
+	}
+	a := filepath.Join(dir, "a")
+	sub := filepath.Join(dir, "sub")
+	out, _, _ = posix.Capture(run, "", sub, a)
+	if out != a+"\n\n"+sub+":\n" {
+		t.Errorf("unexpected output for multiple operands: %q", out)
+	}
+	_, _, status = posix.Capture(run, "", filepath.Join(dir, "nope"))
+	if status != 1 {
+		t.Errorf("expected status 1 for missing file, got %d", status)
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/hraban/lush/posixtools/posix"
+)
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := posix.NewFlagSet("mkdir", "[-p] [-m mode] dir...")
+	parents := fs.Bool('p')
+	modestr := fs.String('m', "777")
+	operands, err := fs.Parse(args)
+	if err != nil {
+		return fs.Fail(stderr, err)
+	}
+	if len(operands) == 0 {
+		return fs.Fail(stderr, errors.New("missing operand"))
+	}
+	// only octal modes, no symbolic ones
+	mode, err := strconv.ParseUint(*modestr, 8, 32)
+	if err != nil {
+		return fs.Fail(stderr, errors.New("invalid mode: "+*modestr))
+	}
+	status := 0
+	for _, dir := range operands {
+		if *parents {
+			err = os.MkdirAll(dir, os.FileMode(mode))
+		} else {
+			err = os.Mkdir(dir, os.FileMode(mode))
+		}
+		if err != nil {
+			fs.Errorf(stderr, "%v", err)
+			status = 1
+		}
+	}
+	return status
+}
+
+func main() {
+	posix.Main(run)
+}
@@ -0,0 +1,44 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hraban/lush/posixtools/posix"
+)
+
+func TestMkdir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lush-mkdir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := func(name string) string { return filepath.Join(dir, name) }
+	_, _, status := posix.Capture(run, "", p("a"), p("b"))
+	if status != 0 {
+		t.Errorf("mkdir failed: %d", status)
+	}
+	_, _, status = posix.Capture(run, "", p("a"))
+	if status != 1 {
+		t.Errorf("expected status 1 for existing dir, got %d", status)
+	}
+	_, _, status = posix.Capture(run, "", p("x/y"))
+	if status != 1 {
+		t.Errorf("expected status 1 for missing parent, got %d", status)
+	}
+	_, _, status = posix.Capture(run, "", "-p", "-m", "700", p("x/y"), p("a"))
+	fi, err := os.Stat(p("x/y"))
+	if status != 0 || err != nil || !fi.IsDir() {
+		t.Fatalf("mkdir -p failed (%d): %v", status, err)
+	}
+	_, _, status = posix.Capture(run, "", "-m", "rwx", p("c"))
+	if status != 2 {
+		t.Errorf("expected usage error for symbolic mode, got %d", status)
+	}
+}
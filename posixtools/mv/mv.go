@@ -0,0 +1,52 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/hraban/lush/posixtools/posix"
+)
+
+// no fallback to copying across file systems, yet
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := posix.NewFlagSet("mv", "[-f] source... target")
+	// we never ask anyway
+	fs.Bool('f')
+	operands, err := fs.Parse(args)
+	if err != nil {
+		return fs.Fail(stderr, err)
+	}
+	if len(operands) < 2 {
+		return fs.Fail(stderr, errors.New("missing operand"))
+	}
+	srcs, target := operands[:len(operands)-1], operands[len(operands)-1]
+	fi, err := os.Stat(target)
+	intoDir := err == nil && fi.IsDir()
+	if len(srcs) > 1 && !intoDir {
+		return fs.Fail(stderr, fmt.Errorf("target %s is not a directory", target))
+	}
+	status := 0
+	for _, src := range srcs {
+		dst := target
+		if intoDir {
+			dst = filepath.Join(target, filepath.Base(src))
+		}
+		err := os.Rename(src, dst)
+		if err != nil {
+			fs.Errorf(stderr, "%v", err)
+			status = 1
+		}
+	}
+	return status
+}
+
+func main() {
+	posix.Main(run)
+}
@@ -0,0 +1,40 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hraban/lush/posixtools/posix"
+)
+
+func TestMv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lush-mv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := func(name string) string { return filepath.Join(dir, name) }
+	os.Mkdir(p("dir"), 0755)
+	ioutil.WriteFile(p("a"), nil, 0644)
+	ioutil.WriteFile(p("b"), nil, 0644)
+	_, _, status := posix.Capture(run, "", p("a"), p("c"))
+	if _, err := os.Stat(p("c")); status != 0 || err != nil {
+		t.Errorf("rename failed (%d): %v", status, err)
+	}
+	_, _, status = posix.Capture(run, "", p("b"), p("c"), p("dir"))
+	for _, name := range []string{"dir/b", "dir/c"} {
+		if _, err := os.Stat(p(name)); status != 0 || err != nil {
+			t.Errorf("move into directory failed (%d): %v", status, err)
+		}
+	}
+	_, _, status = posix.Capture(run, "", p("nope"), p("dir"))
+	if status != 1 {
+		t.Errorf("expected status 1 moving missing file, got %d", status)
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+// Shared plumbing for the posixtools: flag parsing and error reporting that
+// behave the same for every tool.
+package posix
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A tool is run with its arguments (without the program name) and standard
+// streams, and returns its exit status. Keeping os out of it makes them easy
+// to test.
+type Tool func(args []string, stdin io.Reader, stdout, stderr io.Writer) int
+
+// Use as the main function of a tool
+func Main(t Tool) {
+	os.Exit(t(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// Run a tool with the given stdin and capture its output, for testing
+func Capture(t Tool, stdin string, args ...string) (stdout, stderr string, status int) {
+	var out, errout bytes.Buffer
+	status = t(args, strings.NewReader(stdin), &out, &errout)
+	return out.String(), errout.String(), status
+}
+
+// Single letter options, parsed like POSIX getopt: options can be grouped
+// (-la), option arguments are either attached (-n5) or the next argument
+// (-n 5), and parsing stops at the first operand or at "--".
+type FlagSet struct {
+	Name string
+	// Synopsis, eg "[-n count] [file...]"
+	Usage string
+	bools map[byte]*bool
+	// options taking an argument
+	strs map[byte]*string
+}
+
+func NewFlagSet(name, usage string) *FlagSet {
+	return &FlagSet{
+		Name:  name,
+		Usage: usage,
+		bools: map[byte]*bool{},
+		strs:  map[byte]*string{},
+	}
+}
+
+func (f *FlagSet) Bool(c byte) *bool {
+	b := new(bool)
+	f.bools[c] = b
+	return b
+}
+
+func (f *FlagSet) String(c byte, def string) *string {
+	s := &def
+	f.strs[c] = s
+	return s
+}
+
+// Parse args, return the operands
+func (f *FlagSet) Parse(args []string) ([]string, error) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return args[i+1:], nil
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			return args[i:], nil
+		}
+		for j := 1; j < len(arg); j++ {
+			c := arg[j]
+			if b, ok := f.bools[c]; ok {
+				*b = true
+				continue
+			}
+			s, ok := f.strs[c]
+			if !ok {
+				return nil, fmt.Errorf("unknown option: -%c", c)
+			}
+			if j+1 < len(arg) {
+				*s = arg[j+1:]
+			} else if i+1 < len(args) {
+				i++
+				*s = args[i]
+			} else {
+				return nil, fmt.Errorf("option requires an argument: -%c", c)
+			}
+			break
+		}
+	}
+	return nil, nil
+}
+
+// Integer value of an option, for options parsed through String
+func (f *FlagSet) Int(c byte, s string) (int, error) {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number for -%c: %q", c, s)
+	}
+	return i, nil
+}
+
+// Print a "name: message" line to w
+func (f *FlagSet) Errorf(w io.Writer, format string, args ...interface{}) {
+	fmt.Fprintf(w, f.Name+": "+format+"\n", args...)
+}
+
+// Report a usage error and return the exit status for it
+func (f *FlagSet) Fail(w io.Writer, err error) int {
+	f.Errorf(w, "%v", err)
+	fmt.Fprintf(w, "usage: %s %s\n", f.Name, f.Usage)
+	return 2
+}
+
+// Open a file operand. "-" is stdin, which is not closed by closing the
+// result.
+func Open(name string, stdin io.Reader) (io.ReadCloser, error) {
+	if name == "-" {
+		return nopCloser{stdin}, nil
+	}
+	return os.Open(name)
+}
+
+type nopCloser struct{ io.Reader }
+
+func (nopCloser) Close() error { return nil }
+
+// Call f for every file operand, stdin if there are none. Errors are reported
+// but don't stop the iteration. Returns the exit status: 1 if anything
+// failed, 0 otherwise.
+func EachFile(fs *FlagSet, files []string, stdin io.Reader, stderr io.Writer, f func(name string, r io.Reader) error) int {
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	status := 0
+	for _, name := range files {
+		r, err := Open(name, stdin)
+		if err == nil {
+			err = f(name, r)
+			r.Close()
+		}
+		if err != nil {
+			fs.Errorf(stderr, "%v", err)
+			status = 1
+		}
+	}
+	return status
+}
+
+// Reads lines like a bufio.Scanner, but without a limit on their length
+type LineReader struct {
+	br   *bufio.Reader
+	line string
+	err  error
+	done bool
+}
+
+func NewLineReader(r io.Reader) *LineReader {
+	return &LineReader{br: bufio.NewReader(r)}
+}
+
+// Read the next line, false at the end or on error
+func (l *LineReader) Scan() bool {
+	if l.done {
+		return false
+	}
+	line, err := l.br.ReadString('\n')
+	if err != nil {
+		l.done = true
+		if err != io.EOF {
+			l.err = err
+			return false
+		}
+		if line == "" {
+			return false
+		}
+	}
+	l.line = strings.TrimSuffix(line, "\n")
+	return true
+}
+
+// The last line read, without the newline
+func (l *LineReader) Text() string {
+	return l.line
+}
+
+// The first error other than EOF
+func (l *LineReader) Err() error {
+	return l.err
+}
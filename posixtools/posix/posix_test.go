@@ -0,0 +1,61 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package posix
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFlagSetParse(t *testing.T) {
+	for _, c := range []struct {
+		args     []string
+		a, b     bool
+		n        string
+		operands []string
+	}{
+		{[]string{}, false, false, "10", nil},
+		{[]string{"-ab", "x"}, true, true, "10", []string{"x"}},
+		{[]string{"-n5", "-a"}, true, false, "5", []string{}},
+		{[]string{"-bn", "7", "x", "-a"}, false, true, "7", []string{"x", "-a"}},
+		{[]string{"--", "-a"}, false, false, "10", []string{"-a"}},
+		{[]string{"-", "-a"}, false, false, "10", []string{"-", "-a"}},
+	} {
+		fs := NewFlagSet("test", "")
+		a, b, n := fs.Bool('a'), fs.Bool('b'), fs.String('n', "10")
+		operands, err := fs.Parse(c.args)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", c.args, err)
+			continue
+		}
+		if *a != c.a || *b != c.b || *n != c.n ||
+			len(operands) != len(c.operands) ||
+			(len(operands) > 0 && !reflect.DeepEqual(operands, c.operands)) {
+			t.Errorf("%q: got -a=%v -b=%v -n=%q %q", c.args, *a, *b, *n, operands)
+		}
+	}
+	for _, args := range [][]string{{"-x"}, {"-n"}, {"-an"}} {
+		fs := NewFlagSet("test", "")
+		fs.Bool('a')
+		fs.String('n', "")
+		_, err := fs.Parse(args)
+		if err == nil {
+			t.Errorf("%q: expected error", args)
+		}
+	}
+}
+
+func TestLineReader(t *testing.T) {
+	long := strings.Repeat("x", 1<<20)
+	l := NewLineReader(strings.NewReader("a\n\n" + long + "\nlast"))
+	var lines []string
+	for l.Scan() {
+		lines = append(lines, l.Text())
+	}
+	if l.Err() != nil || !reflect.DeepEqual(lines, []string{"a", "", long, "last"}) {
+		t.Errorf("Unexpected lines (%v): %d", l.Err(), len(lines))
+	}
+}
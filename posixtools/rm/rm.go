@@ -0,0 +1,60 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hraban/lush/posixtools/posix"
+)
+
+// is the last component . or ..? POSIX says not to touch those. / counts, too.
+func isDots(name string) bool {
+	base := filepath.Base(strings.TrimRight(name, "/"+string(filepath.Separator)))
+	return base == "." || base == ".."
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := posix.NewFlagSet("rm", "[-fR] file...")
+	force, recursive, recursive2 := fs.Bool('f'), fs.Bool('R'), fs.Bool('r')
+	operands, err := fs.Parse(args)
+	if err != nil {
+		return fs.Fail(stderr, err)
+	}
+	if len(operands) == 0 && !*force {
+		return fs.Fail(stderr, errors.New("missing operand"))
+	}
+	status := 0
+	for _, name := range operands {
+		fi, err := os.Lstat(name)
+		switch {
+		case isDots(name):
+			err = fmt.Errorf("refusing to remove %s", name)
+		case os.IsNotExist(err) && *force:
+			continue
+		case err != nil:
+		case fi.IsDir() && !*recursive && !*recursive2:
+			err = fmt.Errorf("%s is a directory", name)
+		case fi.IsDir():
+			err = os.RemoveAll(name)
+		default:
+			err = os.Remove(name)
+		}
+		if err != nil {
+			fs.Errorf(stderr, "%v", err)
+			status = 1
+		}
+	}
+	return status
+}
+
+func main() {
+	posix.Main(run)
+}
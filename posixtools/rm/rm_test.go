@@ -0,0 +1,53 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hraban/lush/posixtools/posix"
+)
+
+func TestRm(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lush-rm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := func(name string) string { return filepath.Join(dir, name) }
+	os.MkdirAll(p("sub/deep"), 0755)
+	ioutil.WriteFile(p("file"), nil, 0644)
+	_, _, status := posix.Capture(run, "", p("file"))
+	if _, err := os.Stat(p("file")); status != 0 || !os.IsNotExist(err) {
+		t.Errorf("removing file failed (%d)", status)
+	}
+	_, _, status = posix.Capture(run, "", p("file"))
+	if status != 1 {
+		t.Errorf("expected status 1 removing missing file, got %d", status)
+	}
+	_, _, status = posix.Capture(run, "", "-f", p("file"))
+	if status != 0 {
+		t.Errorf("expected -f to ignore missing file, got %d", status)
+	}
+	_, _, status = posix.Capture(run, "", p("sub"))
+	if status != 1 {
+		t.Errorf("expected error removing directory without -r, got %d", status)
+	}
+	// all within dir, in case this goes wrong
+	for _, name := range []string{"sub/.", "sub/deep/..", "sub/deep/./", "sub/deep/../"} {
+		// not p: Join cleans it up
+		_, stderr, status := posix.Capture(run, "", "-rf", dir+"/"+name)
+		if _, err := os.Stat(p("sub/deep")); status != 1 || err != nil || stderr == "" {
+			t.Errorf("removing %s (%d, %q): %v", name, status, stderr, err)
+		}
+	}
+	_, _, status = posix.Capture(run, "", "-r", p("sub"))
+	if _, err := os.Stat(p("sub")); status != 0 || !os.IsNotExist(err) {
+		t.Errorf("recursive remove failed (%d)", status)
+	}
+}
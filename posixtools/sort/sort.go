@@ -0,0 +1,83 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hraban/lush/posixtools/posix"
+)
+
+// leading number of a line for -n, 0 if there is none
+func numericKey(line string) float64 {
+	line = strings.TrimLeft(line, " \t")
+	end := 0
+	for end < len(line) && strings.ContainsRune("+-.0123456789", rune(line[end])) {
+		end++
+	}
+	f, _ := strconv.ParseFloat(line[:end], 64)
+	return f
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := posix.NewFlagSet("sort", "[-fnru] [file...]")
+	fold, numeric, reverse, unique := fs.Bool('f'), fs.Bool('n'), fs.Bool('r'), fs.Bool('u')
+	files, err := fs.Parse(args)
+	if err != nil {
+		return fs.Fail(stderr, err)
+	}
+	var lines []string
+	status := posix.EachFile(fs, files, stdin, stderr, func(name string, r io.Reader) error {
+		scanner := posix.NewLineReader(r)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		return scanner.Err()
+	})
+	key := func(line string) string {
+		if *fold {
+			return strings.ToLower(line)
+		}
+		return line
+	}
+	// -1, 0 or 1 like strings.Compare, but by the sort key
+	compare := func(a, b string) int {
+		if *numeric {
+			na, nb := numericKey(a), numericKey(b)
+			switch {
+			case na < nb:
+				return -1
+			case na > nb:
+				return 1
+			}
+			if *unique {
+				return 0
+			}
+		}
+		return strings.Compare(key(a), key(b))
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		c := compare(lines[i], lines[j])
+		if *reverse {
+			return c > 0
+		}
+		return c < 0
+	})
+	for i, line := range lines {
+		if *unique && i > 0 && compare(lines[i-1], line) == 0 {
+			continue
+		}
+		fmt.Fprintln(stdout, line)
+	}
+	return status
+}
+
+func main() {
+	posix.Main(run)
+}
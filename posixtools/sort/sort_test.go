@@ -0,0 +1,30 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/hraban/lush/posixtools/posix"
+)
+
+func TestSort(t *testing.T) {
+	for _, c := range []struct {
+		args            []string
+		input, expected string
+	}{
+		{nil, "b\na\nc\n", "a\nb\nc\n"},
+		{[]string{"-r"}, "b\na\nc\n", "c\nb\na\n"},
+		{[]string{"-n"}, "10\n9\n-1\nx\n", "-1\nx\n9\n10\n"},
+		{[]string{"-u"}, "b\na\nb\n", "a\nb\n"},
+		{[]string{"-fu"}, "B\na\nb\n", "a\nB\n"},
+		{[]string{"-rn"}, "1\n3\n2", "3\n2\n1\n"},
+	} {
+		out, _, status := posix.Capture(run, c.input, c.args...)
+		if status != 0 || out != c.expected {
+			t.Errorf("%q: expected %q, got %q (%d)", c.args, c.expected, out, status)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hraban/lush/posixtools/posix"
+)
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := posix.NewFlagSet("tail", "[-n [+]count] [file...]")
+	nstr := fs.String('n', "10")
+	files, err := fs.Parse(args)
+	if err != nil {
+		return fs.Fail(stderr, err)
+	}
+	// +N: from line N on, instead of the last N lines
+	fromStart := strings.HasPrefix(*nstr, "+")
+	n, err := fs.Int('n', strings.TrimPrefix(*nstr, "+"))
+	if err != nil {
+		return fs.Fail(stderr, err)
+	}
+	if n < 0 {
+		n = -n
+	}
+	first := true
+	return posix.EachFile(fs, files, stdin, stderr, func(name string, r io.Reader) error {
+		if len(files) > 1 {
+			if !first {
+				fmt.Fprintln(stdout)
+			}
+			fmt.Fprintf(stdout, "==> %s <==\n", name)
+		}
+		first = false
+		br := bufio.NewReader(r)
+		// ring of the last n lines
+		var last []string
+		lineno := 0
+		for {
+			line, err := br.ReadString('\n')
+			if line != "" {
+				lineno++
+				switch {
+				case fromStart:
+					if lineno >= n {
+						if _, werr := io.WriteString(stdout, line); werr != nil {
+							return werr
+						}
+					}
+				case n > 0:
+					if len(last) < n {
+						last = append(last, line)
+					} else {
+						last[(lineno-1)%n] = line
+					}
+				}
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if fromStart || len(last) == 0 {
+			return nil
+		}
+		// oldest line is the one after the most recent
+		start := lineno % len(last)
+		for i := range last {
+			_, err := io.WriteString(stdout, last[(start+i)%len(last)])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func main() {
+	posix.Main(run)
+}
@@ -0,0 +1,34 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/hraban/lush/posixtools/posix"
+)
+
+func TestTail(t *testing.T) {
+	input := "1\n2\n3\n4\n5\n"
+	for _, c := range []struct {
+		args     []string
+		expected string
+	}{
+		{nil, input},
+		{[]string{"-n", "2"}, "4\n5\n"},
+		{[]string{"-n3"}, "3\n4\n5\n"},
+		{[]string{"-n", "+4"}, "4\n5\n"},
+		{[]string{"-n0"}, ""},
+	} {
+		out, _, status := posix.Capture(run, input, c.args...)
+		if status != 0 || out != c.expected {
+			t.Errorf("%q: expected %q, got %q (%d)", c.args, c.expected, out, status)
+		}
+	}
+	out, _, _ := posix.Capture(run, "a\nb", "-n1")
+	if out != "b" {
+		t.Errorf("expected unterminated last line, got %q", out)
+	}
+}
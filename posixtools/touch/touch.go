@@ -0,0 +1,50 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/hraban/lush/posixtools/posix"
+)
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := posix.NewFlagSet("touch", "[-c] file...")
+	nocreate := fs.Bool('c')
+	operands, err := fs.Parse(args)
+	if err != nil {
+		return fs.Fail(stderr, err)
+	}
+	if len(operands) == 0 {
+		return fs.Fail(stderr, errors.New("missing operand"))
+	}
+	status := 0
+	now := time.Now()
+	for _, name := range operands {
+		err := os.Chtimes(name, now, now)
+		if os.IsNotExist(err) {
+			if *nocreate {
+				continue
+			}
+			var f *os.File
+			f, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE, 0666)
+			if err == nil {
+				err = f.Close()
+			}
+		}
+		if err != nil {
+			fs.Errorf(stderr, "%v", err)
+			status = 1
+		}
+	}
+	return status
+}
+
+func main() {
+	posix.Main(run)
+}
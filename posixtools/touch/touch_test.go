@@ -0,0 +1,39 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hraban/lush/posixtools/posix"
+)
+
+func TestTouch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lush-touch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := func(name string) string { return filepath.Join(dir, name) }
+	_, _, status := posix.Capture(run, "", "-c", p("nope"))
+	if _, err := os.Stat(p("nope")); status != 0 || !os.IsNotExist(err) {
+		t.Errorf("touch -c created file or failed (%d)", status)
+	}
+	_, _, status = posix.Capture(run, "", p("new"))
+	if _, err := os.Stat(p("new")); status != 0 || err != nil {
+		t.Errorf("touch didn't create file (%d): %v", status, err)
+	}
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(p("new"), old, old)
+	posix.Capture(run, "", p("new"))
+	fi, _ := os.Stat(p("new"))
+	if !fi.ModTime().After(old.Add(time.Minute)) {
+		t.Errorf("touch didn't update modification time: %v", fi.ModTime())
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hraban/lush/posixtools/posix"
+)
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := posix.NewFlagSet("uniq", "[-c] [-d | -u] [-i] [input]")
+	count, dupsOnly, uniqOnly, nocase := fs.Bool('c'), fs.Bool('d'), fs.Bool('u'), fs.Bool('i')
+	files, err := fs.Parse(args)
+	if err != nil {
+		return fs.Fail(stderr, err)
+	}
+	if len(files) > 1 {
+		return fs.Fail(stderr, errors.New("too many operands"))
+	}
+	equal := func(a, b string) bool {
+		if *nocase {
+			return strings.EqualFold(a, b)
+		}
+		return a == b
+	}
+	return posix.EachFile(fs, files, stdin, stderr, func(name string, r io.Reader) error {
+		var prev string
+		n := 0
+		flush := func() {
+			if n == 0 || (*dupsOnly && n == 1) || (*uniqOnly && n > 1) {
+				return
+			}
+			if *count {
+				fmt.Fprintf(stdout, "%7d %s\n", n, prev)
+			} else {
+				fmt.Fprintln(stdout, prev)
+			}
+		}
+		scanner := posix.NewLineReader(r)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if n > 0 && equal(line, prev) {
+				n++
+				continue
+			}
+			flush()
+			prev, n = line, 1
+		}
+		flush()
+		return scanner.Err()
+	})
+}
+
+func main() {
+	posix.Main(run)
+}
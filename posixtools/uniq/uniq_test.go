@@ -0,0 +1,34 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/hraban/lush/posixtools/posix"
+)
+
+func TestUniq(t *testing.T) {
+	input := "a\na\nb\nA\nc\nc\nc\n"
+	for _, c := range []struct {
+		args     []string
+		expected string
+	}{
+		{nil, "a\nb\nA\nc\n"},
+		{[]string{"-d"}, "a\nc\n"},
+		{[]string{"-u"}, "b\nA\n"},
+		{[]string{"-c"}, "      2 a\n      1 b\n      1 A\n      3 c\n"},
+		{[]string{"-i"}, "a\nb\nA\nc\n"},
+	} {
+		out, _, status := posix.Capture(run, input, c.args...)
+		if status != 0 || out != c.expected {
+			t.Errorf("%q: expected %q, got %q (%d)", c.args, c.expected, out, status)
+		}
+	}
+	out, _, _ := posix.Capture(run, "x\nX\nx\n", "-i")
+	if out != "x\n" {
+		t.Errorf("expected case insensitive merge, got %q", out)
+	}
+}
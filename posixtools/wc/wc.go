@@ -0,0 +1,89 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"unicode"
+
+	"github.com/hraban/lush/posixtools/posix"
+)
+
+type counts struct {
+	lines, words, bytes int
+}
+
+func count(r io.Reader) (c counts, err error) {
+	br := bufio.NewReader(r)
+	inword := false
+	for {
+		ch, size, err := br.ReadRune()
+		if err == io.EOF {
+			return c, nil
+		}
+		if err != nil {
+			return c, err
+		}
+		c.bytes += size
+		if ch == '\n' {
+			c.lines++
+		}
+		if unicode.IsSpace(ch) {
+			inword = false
+		} else if !inword {
+			inword = true
+			c.words++
+		}
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := posix.NewFlagSet("wc", "[-c] [-l] [-w] [file...]")
+	bytes, lines, words := fs.Bool('c'), fs.Bool('l'), fs.Bool('w')
+	files, err := fs.Parse(args)
+	if err != nil {
+		return fs.Fail(stderr, err)
+	}
+	if !*bytes && !*lines && !*words {
+		*bytes, *lines, *words = true, true, true
+	}
+	print := func(c counts, name string) {
+		if *lines {
+			fmt.Fprintf(stdout, "%8d", c.lines)
+		}
+		if *words {
+			fmt.Fprintf(stdout, "%8d", c.words)
+		}
+		if *bytes {
+			fmt.Fprintf(stdout, "%8d", c.bytes)
+		}
+		if name != "-" {
+			fmt.Fprintf(stdout, " %s", name)
+		}
+		fmt.Fprintln(stdout)
+	}
+	var total counts
+	status := posix.EachFile(fs, files, stdin, stderr, func(name string, r io.Reader) error {
+		c, err := count(r)
+		if err != nil {
+			return err
+		}
+		total.lines += c.lines
+		total.words += c.words
+		total.bytes += c.bytes
+		print(c, name)
+		return nil
+	})
+	if len(files) > 1 {
+		print(total, "total")
+	}
+	return status
+}
+
+func main() {
+	posix.Main(run)
+}
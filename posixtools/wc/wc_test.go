@@ -0,0 +1,27 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/hraban/lush/posixtools/posix"
+)
+
+func TestWc(t *testing.T) {
+	input := "hello wörld\n  foo\n"
+	out, _, status := posix.Capture(run, input)
+	if status != 0 || out != "       2       3      19\n" {
+		t.Errorf("unexpected output (%d): %q", status, out)
+	}
+	out, _, _ = posix.Capture(run, input, "-l")
+	if out != "       2\n" {
+		t.Errorf("unexpected output for -l: %q", out)
+	}
+	out, _, _ = posix.Capture(run, input, "-wc")
+	if out != "       3      19\n" {
+		t.Errorf("unexpected output for -wc: %q", out)
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+// The rc file configures a new session. One directive per line, empty lines
+// and lines starting with # are ignored:
+//
+//     env NAME=value         set an environment variable. value is the rest
+//                            of the line, as is.
+//     path DIR               add DIR to the front of PATH
+//     alias NAME WORD...     define an alias, see liblush/alias.go
+//     scrollback [stdout|stderr] BYTES
+//                            default scrollback size of new commands, for
+//                            one or both streams
+//     cd DIR                 initial directory
+//
+// A DIR starting with ~/ is relative to the home directory. A broken line is
+// reported and skipped, the rest of the file still applies.
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type rcDirective func(s *server, args []string, line string) error
+
+var rcDirectives = map[string]rcDirective{
+	"env":        rcEnv,
+	"path":       rcPath,
+	"alias":      rcAlias,
+	"scrollback": rcScrollback,
+	"cd":         rcCd,
+}
+
+// ~/foo to foo in the home dir of the session
+func rcExpandDir(s *server, dir string) (string, error) {
+	if dir == "~" || strings.HasPrefix(dir, "~/") {
+		home := homeDir(s, "")
+		if home == "" {
+			return "", errors.New("unknown home directory")
+		}
+		dir = home + dir[1:]
+	}
+	if !filepath.IsAbs(dir) {
+		return "", fmt.Errorf("not an absolute path: %s", dir)
+	}
+	return dir, nil
+}
+
+func rcEnv(s *server, args []string, line string) error {
+	kv := strings.SplitN(strings.TrimSpace(line), "=", 2)
+	if len(args) == 0 || len(kv) != 2 || kv[0] == "" || strings.ContainsAny(kv[0], " \t") {
+		return errors.New("usage: env NAME=value")
+	}
+	s.session.Setenv(kv[0], kv[1])
+	return nil
+}
+
+func rcPath(s *server, args []string, _ string) error {
+	if len(args) != 1 {
+		return errors.New("usage: path DIR")
+	}
+	dir, err := rcExpandDir(s, args[0])
+	if err != nil {
+		return err
+	}
+	// for finding commands and for their children
+	err = setPath(append([]string{dir}, getPath()...))
+	if err != nil {
+		return err
+	}
+	s.session.Setenv("PATH", os.Getenv("PATH"))
+	return nil
+}
+
+func rcAlias(s *server, args []string, _ string) error {
+	if len(args) < 2 {
+		return errors.New("usage: alias NAME WORD...")
+	}
+	return s.session.SetAlias(args[0], args[1:])
+}
+
+func rcScrollback(s *server, args []string, _ string) error {
+	stdout, stderr := true, true
+	if len(args) == 2 {
+		switch args[0] {
+		case "stdout":
+			stderr = false
+		case "stderr":
+			stdout = false
+		default:
+			return fmt.Errorf("unknown stream: %s", args[0])
+		}
+		args = args[1:]
+	}
+	if len(args) != 1 {
+		return errors.New("usage: scrollback [stdout|stderr] BYTES")
+	}
+	size, err := strconv.Atoi(args[0])
+	if err != nil || size < 0 {
+		return fmt.Errorf("invalid scrollback size: %s", args[0])
+	}
+	if stdout {
+		s.stdoutScrollback = size
+	}
+	if stderr {
+		s.stderrScrollback = size
+	}
+	return nil
+}
+
+func rcCd(s *server, args []string, _ string) error {
+	if len(args) != 1 {
+		return errors.New("usage: cd DIR")
+	}
+	dir, err := rcExpandDir(s, args[0])
+	if err != nil {
+		return err
+	}
+	return s.session.Chdir(dir)
+}
+
+// Apply an rc file to the session. A missing file is fine. Errors are logged
+// and kept for the first websocket client to connect (see takeRcErrors).
+func (s *server) LoadRc(fname string) {
+	f, err := os.Open(fname)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			s.rcError(err)
+		}
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		args := strings.Fields(line)
+		d := rcDirectives[args[0]]
+		if d == nil {
+			err = fmt.Errorf("unknown directive: %s", args[0])
+		} else {
+			err = d(s, args[1:], strings.TrimPrefix(line, args[0]))
+		}
+		if err != nil {
+			s.rcError(fmt.Errorf("%s:%d: %v", fname, lineno, err))
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		s.rcError(fmt.Errorf("%s: %v", fname, err))
+	}
+}
+
+func (s *server) rcError(err error) {
+	log.Print("rc file: ", err)
+	s.rclock.Lock()
+	defer s.rclock.Unlock()
+	s.rcerrors = append(s.rcerrors, err.Error())
+}
+
+// errors from loading the rc file that haven't been reported yet
+func (s *server) takeRcErrors() []string {
+	s.rclock.Lock()
+	defer s.rclock.Unlock()
+	errs := s.rcerrors
+	s.rcerrors = nil
+	return errs
+}
+
+// ~/.lushrc, or nothing if we don't know where home is
+func defaultRcFile() string {
+	home := os.Getenv("HOME")
+	if home == "" {
+		return ""
+	}
+	return filepath.Join(home, ".lushrc")
+}
@@ -0,0 +1,87 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hraban/lush/lushclient"
+)
+
+func TestRcFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lush-rc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir, _ = filepath.EvalSymlinks(dir)
+	oldwd, _ := os.Getwd()
+	defer os.Chdir(oldwd)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	fname := filepath.Join(dir, "lushrc")
+	rc := fmt.Sprintf(`# test
+env LUSHTEST=foo bar=baz
+path %s/bin
+alias ll ls -l
+
+scrollback 50
+scrollback stderr 20
+cd %s
+bogus directive
+scrollback stdin 10
+`, dir, dir)
+	err = ioutil.WriteFile(fname, []byte(rc), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newServer()
+	s.LoadRc(fname)
+	if v := s.session.Getenv("LUSHTEST"); v != "foo bar=baz" {
+		t.Errorf("Expected LUSHTEST=foo bar=baz, got %q", v)
+	}
+	if p := getPath(); p[0] != dir+"/bin" {
+		t.Errorf("Expected %s/bin at the front of PATH, got %v", dir, p)
+	}
+	if !strings.HasPrefix(s.session.Getenv("PATH"), dir+"/bin") {
+		t.Errorf("PATH not set in session: %q", s.session.Getenv("PATH"))
+	}
+	if a := s.session.Aliases()["ll"]; len(a) != 2 {
+		t.Errorf("Unexpected alias for ll: %v", a)
+	}
+	if s.stdoutScrollback != 50 || s.stderrScrollback != 20 {
+		t.Errorf("Unexpected scrollback sizes: %d, %d", s.stdoutScrollback, s.stderrScrollback)
+	}
+	if wd, _ := os.Getwd(); wd != dir {
+		t.Errorf("Expected to be in %s, am in %s", dir, wd)
+	}
+	// errors are reported to the first client only
+	ts := httptest.NewServer(s.httpHandler)
+	defer ts.Close()
+	c := connectClient(t, ts, nil)
+	defer c.Close()
+	for _, lineno := range []int{9, 10} {
+		e, err := c.Next()
+		if err != nil {
+			t.Fatal("Error reading websocket message:", err)
+		}
+		expected := fmt.Sprintf("rc file: %s:%d: ", fname, lineno)
+		if eerr, ok := e.(*lushclient.ErrorEvent); !ok || !strings.HasPrefix(eerr.Msg, expected) {
+			t.Errorf("Expected error %q..., got %#v", expected, e)
+		}
+	}
+	c2 := connectClient(t, ts, nil)
+	defer c2.Close()
+	c2.SetDeadline(time.Now().Add(100 * time.Millisecond))
+	if e, err := c2.Next(); err == nil {
+		t.Errorf("Unexpected message for second client: %#v", e)
+	}
+}
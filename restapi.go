@@ -0,0 +1,308 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+// REST API for the entire life of a command, for curl and scripts. Changes go
+// through the same handlers as the websocket events, so websocket clients see
+// them like any other:
+//
+//     GET    /api/cmds               metadata of all commands, by id
+//     POST   /api/cmds               create one. body like a new event
+//     GET    /api/cmds/N             metadata
+//     PATCH  /api/cmds/N             set properties. body like
+//                                    {"name":"build","timeout":60}
+//     DELETE /api/cmds/N             release
+//     POST   /api/cmds/N/start
+//     POST   /api/cmds/N/stop        walk the stop sequence
+//     POST   /api/cmds/N/signal      signal=SIGINT
+//     GET    /api/cmds/N/stdout      scrollback, optionally a byte range:
+//     GET    /api/cmds/N/stderr      ?start=0&end=100. negative offsets
+//                                    count from the end. with &unit=lines
+//                                    they count lines, for streams with
+//                                    a line scrollback.
+//     GET    /api/search             search the scrollback, see search.go
+//
+// Everything but GET requires master. Anything the handler rejects is a 400,
+// unknown commands are a 404.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+
+	"github.com/hraban/lush/liblush"
+	"github.com/hraban/web"
+)
+
+// call a websocket event handler on behalf of an HTTP client. all errors are
+// the client's fault: the ones that aren't lushErrors are protocol
+// violations, as far as websocket clients are concerned.
+func restEvent(ctx *web.Context, h wsHandler, payload string) error {
+	err := h(ctx.User.(*server), payload)
+	if err != nil {
+		return web.WebError{400, err.Error()}
+	}
+	return nil
+}
+
+func writeCmdJson(ctx *web.Context, c liblush.Cmd, code int) error {
+	md, err := metacmd{c}.Metadata()
+	if err != nil {
+		return err
+	}
+	ctx.ContentType("json")
+	ctx.WriteHeader(code)
+	return json.NewEncoder(ctx).Encode(md)
+}
+
+func handleGetApiCmds(ctx *web.Context) error {
+	s := ctx.User.(*server)
+	ids := s.session.GetCommandIds()
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	mds := []cmdmetadata{}
+	for _, id := range ids {
+		c := s.session.GetCommand(id)
+		if c == nil {
+			// released in the meantime
+			continue
+		}
+		md, err := metacmd{c}.Metadata()
+		if err != nil {
+			return err
+		}
+		mds = append(mds, md)
+	}
+	ctx.ContentType("json")
+	return json.NewEncoder(ctx).Encode(mds)
+}
+
+func handlePostApiCmds(ctx *web.Context) error {
+	if err := errorIfNotMaster(ctx); err != nil {
+		return err
+	}
+	body, err := ioutil.ReadAll(ctx.Request.Body)
+	if err != nil {
+		return err
+	}
+	c, err := newCmd(ctx.User.(*server), string(body))
+	if err != nil {
+		return web.WebError{400, err.Error()}
+	}
+	ctx.Header().Set("Location", fmt.Sprintf("/api/cmds/%d", c.Id()))
+	return writeCmdJson(ctx, c, 201)
+}
+
+func handleGetApiCmd(ctx *web.Context, idstr string) error {
+	c, err := getCmdWeb(ctx.User.(*server).session, idstr)
+	if err != nil {
+		return err
+	}
+	return writeCmdJson(ctx, c, 200)
+}
+
+// properties a PATCH can set: those updatecmd knows. the rest are read-only.
+var writableCmdProps = map[string]bool{
+	"name":                  true,
+	"cmd":                   true,
+	"args":                  true,
+	"literal":               true,
+	"expand":                true,
+	"userdata":              true,
+	"timeout":               true,
+	"watch":                 true,
+	"triggers":              true,
+	"stopSequence":          true,
+	"limits":                true,
+	"stdoutScrollback":      true,
+	"stderrScrollback":      true,
+	"stdoutScrollbackLines": true,
+	"stderrScrollbackLines": true,
+	"stdoutRecords":         true,
+	"stderrRecords":         true,
+	"stdoutto":              true,
+	"stderrto":              true,
+	"onexit":                true,
+	"onsuccess":             true,
+	"onfailure":             true,
+}
+
+func handlePatchApiCmd(ctx *web.Context, idstr string) error {
+	if err := errorIfNotMaster(ctx); err != nil {
+		return err
+	}
+	s := ctx.User.(*server)
+	c, err := getCmdWeb(s.session, idstr)
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadAll(ctx.Request.Body)
+	if err != nil {
+		return err
+	}
+	var props map[string]json.RawMessage
+	err = json.Unmarshal(body, &props)
+	if err != nil {
+		return web.WebError{400, "malformed JSON: " + err.Error()}
+	}
+	for name := range props {
+		// updatecmd silently ignores what it doesn't know
+		if _, err := cmdProp(c, name); err != nil {
+			return web.WebError{400, err.Error()}
+		}
+		if !writableCmdProps[name] {
+			return web.WebError{400, "read-only property: " + name}
+		}
+	}
+	props["nid"], _ = json.Marshal(c.Id())
+	update, _ := json.Marshal(props)
+	err = restEvent(ctx, wseventUpdatecmd, string(update))
+	if err != nil {
+		return err
+	}
+	// like setprop
+	for name := range props {
+		if name == "nid" {
+			continue
+		}
+		value, _ := cmdProp(c, name)
+		notifyPropertyUpdate(&s.ctrlclients, getPropResponse{
+			Objname:  cmdId2Json(c.Id()),
+			Propname: name,
+			Value:    value,
+		})
+	}
+	return writeCmdJson(ctx, c, 200)
+}
+
+func handleDeleteApiCmd(ctx *web.Context, idstr string) error {
+	if err := errorIfNotMaster(ctx); err != nil {
+		return err
+	}
+	if _, err := getCmdWeb(ctx.User.(*server).session, idstr); err != nil {
+		return err
+	}
+	err := restEvent(ctx, wseventRelease, idstr)
+	if err != nil {
+		return err
+	}
+	ctx.WriteHeader(204)
+	return nil
+}
+
+// POST /api/cmds/N/start, /stop and /signal
+func handlePostApiCmdAction(ctx *web.Context, idstr, action string) error {
+	if err := errorIfNotMaster(ctx); err != nil {
+		return err
+	}
+	c, err := getCmdWeb(ctx.User.(*server).session, idstr)
+	if err != nil {
+		return err
+	}
+	switch action {
+	case "start":
+		err = restEvent(ctx, wseventStart, idstr)
+	case "stop":
+		err = restEvent(ctx, wseventStop, idstr)
+	case "signal":
+		err = restEvent(ctx, wseventSignal, idstr+";"+ctx.Params["signal"])
+	}
+	if err != nil {
+		return err
+	}
+	return writeCmdJson(ctx, c, 200)
+}
+
+// offset in data of length n from a query parameter, def if empty
+func parseOffset(param string, def, n int) (int, error) {
+	if param == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(param)
+	if err != nil {
+		return 0, web.WebError{400, "invalid offset: " + param}
+	}
+	if i < 0 {
+		i += n
+	}
+	switch {
+	case i < 0:
+		return 0, nil
+	case i > n:
+		return n, nil
+	}
+	return i, nil
+}
+
+func handleGetApiCmdOutput(ctx *web.Context, idstr, streamname string) error {
+	c, err := getCmdWeb(ctx.User.(*server).session, idstr)
+	if err != nil {
+		return err
+	}
+	stream := c.Stdout()
+	if streamname == "stderr" {
+		stream = c.Stderr()
+	}
+	if ctx.Params["unit"] == "lines" {
+		return writeLines(ctx, stream)
+	}
+	var buf bytes.Buffer
+	stream.Scrollback().WriteTo(&buf)
+	data := buf.Bytes()
+	start, err := parseOffset(ctx.Params["start"], 0, len(data))
+	if err != nil {
+		return err
+	}
+	end, err := parseOffset(ctx.Params["end"], len(data), len(data))
+	if err != nil {
+		return err
+	}
+	if end < start {
+		end = start
+	}
+	ctx.ContentType("txt")
+	_, err = ctx.Write(data[start:end])
+	return err
+}
+
+// ?unit=lines: start and end count lines, for a stream with a line scrollback
+func writeLines(ctx *web.Context, stream liblush.OutStream) error {
+	lb, ok := stream.Scrollback().(liblush.LineBuffer)
+	if !ok {
+		return web.WebError{400, "not a line scrollback"}
+	}
+	n := lb.NumLines()
+	start, err := parseOffset(ctx.Params["start"], 0, n)
+	if err != nil {
+		return err
+	}
+	end, err := parseOffset(ctx.Params["end"], n, n)
+	if err != nil {
+		return err
+	}
+	ctx.ContentType("txt")
+	for _, line := range lb.Lines(start, end) {
+		_, err = fmt.Fprintln(ctx, line)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	serverinitializers = append(serverinitializers, func(s *server) {
+		s.web.Get(`/api/cmds`, handleGetApiCmds)
+		s.web.Get(`/api/cmds/(\d+)`, handleGetApiCmd)
+		s.web.Get(`/api/cmds/(\d+)/(stdout|stderr)`, handleGetApiCmdOutput)
+		// only master
+		s.web.Post(`/api/cmds`, handlePostApiCmds)
+		s.web.Match("PATCH", `/api/cmds/(\d+)`, handlePatchApiCmd)
+		s.web.Delete(`/api/cmds/(\d+)`, handleDeleteApiCmd)
+		s.web.Post(`/api/cmds/(\d+)/(start|stop|signal)`, handlePostApiCmdAction)
+	})
+}
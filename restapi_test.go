@@ -0,0 +1,193 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// perform a request, return status code and body. errors are fatal.
+func restRequest(t *testing.T, method, url, body string) (int, string) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	return resp.StatusCode, string(data)
+}
+
+// poll the metadata of a command until it has exited
+func restWaitExit(t *testing.T, url string) cmdmetadata {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		code, body := restRequest(t, "GET", url, "")
+		var md cmdmetadata
+		if code != 200 || json.Unmarshal([]byte(body), &md) != nil {
+			t.Fatalf("GET %s: %d %s", url, code, body)
+		}
+		if md.Status.Code >= 2 {
+			return md
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s didn't exit: %s", url, body)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRestApi(t *testing.T) {
+	s := newServer()
+	ts := httptest.NewServer(s.httpHandler)
+	defer ts.Close()
+	api := ts.URL + "/api/cmds"
+	code, body := restRequest(t, "POST", api, `{"cmd":"pwd","name":"where"}`)
+	if code != 201 {
+		t.Fatalf("Creating command failed: %d %s", code, body)
+	}
+	var md cmdmetadata
+	json.Unmarshal([]byte(body), &md)
+	cmdurl := fmt.Sprintf("%s/%d", api, md.Id)
+	code, body = restRequest(t, "PATCH", cmdurl, `{"name":"here"}`)
+	if code != 200 || !strings.Contains(body, `"name":"here"`) {
+		t.Errorf("Unexpected response to PATCH: %d %s", code, body)
+	}
+	code, _ = restRequest(t, "PATCH", cmdurl, `{"bogus":1}`)
+	if code != 400 {
+		t.Errorf("Expected 400 setting unknown property, got %d", code)
+	}
+	for _, prop := range []string{"status", "cwd", "startwd", "expandedArgv", "triggermatches", "sandbox"} {
+		code, _ = restRequest(t, "PATCH", cmdurl, `{"`+prop+`":null}`)
+		if code != 400 {
+			t.Errorf("Expected 400 setting read-only property %s, got %d", prop, code)
+		}
+	}
+	code, body = restRequest(t, "PATCH", cmdurl, `{"stopSequence":[{"signal":"SIGTERM","wait":1}]}`)
+	if code != 200 || !strings.Contains(body, `"stopSequence":[{"signal":"SIGTERM","wait":1}]`) {
+		t.Errorf("Unexpected response to PATCH of the stop sequence: %d %s", code, body)
+	}
+	// all or nothing
+	code, _ = restRequest(t, "PATCH", cmdurl, `{"name":"nowhere","triggers":[{"pattern":"("}]}`)
+	if code != 400 {
+		t.Errorf("Expected 400 setting an invalid trigger, got %d", code)
+	}
+	code, _ = restRequest(t, "PATCH", cmdurl, `{"name":"nowhere","onexit":12345}`)
+	if code != 400 {
+		t.Errorf("Expected 400 chaining to an unknown command, got %d", code)
+	}
+	_, body = restRequest(t, "GET", cmdurl, "")
+	if !strings.Contains(body, `"name":"here"`) {
+		t.Errorf("Failed PATCH changed the command: %s", body)
+	}
+	code, body = restRequest(t, "POST", cmdurl+"/start", "")
+	if code != 200 {
+		t.Fatalf("Starting command failed: %d %s", code, body)
+	}
+	md = restWaitExit(t, cmdurl)
+	if md.Status.Code != 2 {
+		t.Errorf("Command failed: %v", md.Status)
+	}
+	wd, _ := os.Getwd()
+	_, body = restRequest(t, "GET", cmdurl+"/stdout", "")
+	if body != wd+"\n" {
+		t.Errorf("Expected stdout %q, got %q", wd+"\n", body)
+	}
+	_, body = restRequest(t, "GET", cmdurl+"/stdout?start=-2&end=-1", "")
+	if body != wd[len(wd)-1:] {
+		t.Errorf("Unexpected output range: %q", body)
+	}
+	code, body = restRequest(t, "POST", cmdurl+"/start", "")
+	if code != 400 {
+		t.Errorf("Expected 400 restarting command, got %d %s", code, body)
+	}
+	_, body = restRequest(t, "GET", api, "")
+	if !strings.Contains(body, `"name":"here"`) {
+		t.Errorf("Command missing from list: %s", body)
+	}
+	code, _ = restRequest(t, "DELETE", cmdurl, "")
+	if code != 204 {
+		t.Errorf("Expected 204 releasing command, got %d", code)
+	}
+	code, _ = restRequest(t, "GET", cmdurl, "")
+	if code != 404 {
+		t.Errorf("Expected 404 for released command, got %d", code)
+	}
+}
+
+func TestRestApiSignal(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("no sleep command")
+	}
+	s := newServer()
+	ts := httptest.NewServer(s.httpHandler)
+	defer ts.Close()
+	_, body := restRequest(t, "POST", ts.URL+"/api/cmds", `{"cmd":"sleep","args":["10"]}`)
+	var md cmdmetadata
+	json.Unmarshal([]byte(body), &md)
+	cmdurl := fmt.Sprintf("%s/api/cmds/%d", ts.URL, md.Id)
+	restRequest(t, "POST", cmdurl+"/start", "")
+	code, body := restRequest(t, "POST", cmdurl+"/signal?signal=SIGBOGUS", "")
+	if code != 400 {
+		t.Errorf("Expected 400 for unknown signal, got %d %s", code, body)
+	}
+	code, body = restRequest(t, "POST", cmdurl+"/signal?signal=SIGKILL", "")
+	if code != 200 {
+		t.Fatalf("Signal failed: %d %s", code, body)
+	}
+	md = restWaitExit(t, cmdurl)
+	if md.Status.Code != 3 {
+		t.Errorf("Expected killed command to fail, got %v", md.Status)
+	}
+}
+
+func TestRestApiLines(t *testing.T) {
+	s := newServer()
+	ts := httptest.NewServer(s.httpHandler)
+	defer ts.Close()
+	api := ts.URL + "/api/cmds"
+	code, body := restRequest(t, "POST", api, `{"cmd":"true","stdoutScrollbackLines":3}`)
+	var md cmdmetadata
+	if code != 201 || json.Unmarshal([]byte(body), &md) != nil {
+		t.Fatalf("Creating command failed: %d %s", code, body)
+	}
+	if md.StdoutScrollbackLines != 3 || md.StderrScrollbackLines != 0 {
+		t.Errorf("Unexpected scrollback lines: %d, %d", md.StdoutScrollbackLines, md.StderrScrollbackLines)
+	}
+	c := s.session.GetCommand(md.Id)
+	c.Stdout().Scrollback().Write([]byte("one\ntwo\nthree\nfour\n"))
+	cmdurl := fmt.Sprintf("%s/%d", api, md.Id)
+	_, body = restRequest(t, "GET", cmdurl+"/stdout", "")
+	if body != "two\nthree\nfour\n" {
+		t.Errorf("Unexpected scrollback: %q", body)
+	}
+	_, body = restRequest(t, "GET", cmdurl+"/stdout?unit=lines&start=-2&end=-1", "")
+	if body != "three\n" {
+		t.Errorf("Unexpected line range: %q", body)
+	}
+	code, _ = restRequest(t, "GET", cmdurl+"/stderr?unit=lines", "")
+	if code != 400 {
+		t.Errorf("Expected 400 for lines of a byte scrollback, got %d", code)
+	}
+	code, body = restRequest(t, "PATCH", cmdurl, `{"stdoutScrollbackLines":0,"stderrScrollbackLines":5}`)
+	if code != 200 || !strings.Contains(body, `"stdoutScrollbackLines":0,"stderrScrollbackLines":5`) {
+		t.Errorf("Unexpected response to PATCH: %d %s", code, body)
+	}
+}
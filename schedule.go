@@ -0,0 +1,330 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+// Scheduled commands: a command template (the options of a new event) that is
+// run on a cron schedule (see cron.go) or at an interval. Every run is a new
+// command in the session, announced like any other. Only the last few
+// finished runs are kept, older ones are released.
+//
+// A run is skipped if the previous one is still going.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hraban/lush/liblush"
+)
+
+// finished runs to keep if a schedule doesn't say
+const defaultScheduleKeep = 10
+
+type schedule struct {
+	Id int `json:"id"`
+	// either one of these
+	Cron     string `json:"cron,omitempty"`
+	Interval string `json:"interval,omitempty"`
+	// options of the command, as in the new event
+	Cmd json.RawMessage `json:"cmd"`
+	// number of finished runs to keep. 0 for the default, negative for all.
+	Keep   int  `json:"keep"`
+	Paused bool `json:"paused"`
+	// past and running commands, oldest first
+	Runs []liblush.CmdId `json:"runs"`
+	// nil when paused or never again
+	Next  *time.Time `json:"next"`
+	sched cronSchedule
+	timer *time.Timer
+}
+
+// parse and check a schedule sent by a client
+func parseSchedule(scheduleJSON string) (*schedule, error) {
+	var sc schedule
+	err := json.Unmarshal([]byte(scheduleJSON), &sc)
+	if err != nil {
+		return nil, fmt.Errorf("malformed JSON: %v", err)
+	}
+	switch {
+	case sc.Cron != "" && sc.Interval != "":
+		return nil, errors.New("schedule needs a cron expression or an interval, not both")
+	case sc.Cron != "":
+		sc.sched, err = parseCron(sc.Cron)
+	case sc.Interval != "":
+		var d time.Duration
+		d, err = time.ParseDuration(sc.Interval)
+		if err == nil {
+			sc.sched, err = newIntervalSchedule(d)
+		}
+	default:
+		err = errors.New("schedule needs a cron expression or an interval")
+	}
+	if err != nil {
+		return nil, err
+	}
+	var options cmdOptions
+	if json.Unmarshal(sc.Cmd, &options) != nil || options.Cmd == "" {
+		return nil, errors.New("schedule needs the options of a command, including cmd")
+	}
+	if sc.Keep == 0 {
+		sc.Keep = defaultScheduleKeep
+	}
+	sc.Runs = []liblush.CmdId{}
+	return &sc, nil
+}
+
+// set the timer for the next run. caller must hold the lock.
+func (s *server) armSchedule(sc *schedule) {
+	if sc.timer != nil {
+		sc.timer.Stop()
+		sc.timer = nil
+	}
+	sc.Next = nil
+	if sc.Paused {
+		return
+	}
+	next := sc.sched.Next(time.Now())
+	if next.IsZero() {
+		return
+	}
+	sc.Next = &next
+	id := sc.Id
+	sc.timer = time.AfterFunc(next.Sub(time.Now()), func() {
+		s.runSchedule(id)
+	})
+}
+
+// Add a schedule and start its timer
+func (s *server) AddSchedule(sc *schedule) {
+	s.schedlock.Lock()
+	s.lastschedid++
+	sc.Id = s.lastschedid
+	s.schedules[sc.Id] = sc
+	s.armSchedule(sc)
+	s.schedlock.Unlock()
+	s.notifySchedule(sc.Id)
+}
+
+// broadcast a schedule event
+func (s *server) notifySchedule(id int) error {
+	s.schedlock.Lock()
+	data, err := json.Marshal(s.schedules[id])
+	s.schedlock.Unlock()
+	if err != nil {
+		return err
+	}
+	_, err = s.ctrlclients.Write(append([]byte("schedule;"), data...))
+	return err
+}
+
+func isRunningCmd(c liblush.Cmd) bool {
+	st := c.Status()
+	return st.Started() != nil && st.Exited() == nil
+}
+
+// drop the oldest finished runs beyond the retention from a schedule and
+// return them, for the caller to release once it let go of the lock. caller
+// must hold the lock.
+func (s *server) pruneRuns(sc *schedule) []liblush.CmdId {
+	var live []liblush.CmdId
+	finished := 0
+	for _, id := range sc.Runs {
+		c := s.session.GetCommand(id)
+		if c == nil {
+			// released by someone else
+			continue
+		}
+		live = append(live, id)
+		if !isRunningCmd(c) {
+			finished++
+		}
+	}
+	var pruned []liblush.CmdId
+	sc.Runs = []liblush.CmdId{}
+	for _, id := range live {
+		c := s.session.GetCommand(id)
+		if sc.Keep > 0 && finished > sc.Keep && c != nil && !isRunningCmd(c) {
+			pruned = append(pruned, id)
+			finished--
+			continue
+		}
+		sc.Runs = append(sc.Runs, id)
+	}
+	return pruned
+}
+
+func (s *server) releaseRuns(ids []liblush.CmdId) {
+	for _, id := range ids {
+		err := wseventRelease(s, fmt.Sprint(id))
+		if err != nil {
+			s.web.Logger.Printf("Failed to release old run %d: %v", id, err)
+		}
+	}
+}
+
+// timer callback: create and start a new run
+func (s *server) runSchedule(id int) {
+	s.schedlock.Lock()
+	sc := s.schedules[id]
+	if sc == nil || sc.Paused {
+		s.schedlock.Unlock()
+		return
+	}
+	if n := len(sc.Runs); n > 0 {
+		if c := s.session.GetCommand(sc.Runs[n-1]); c != nil && isRunningCmd(c) {
+			s.web.Logger.Printf("Skipping run of schedule %d, command %d is still running", id, c.Id())
+			s.armSchedule(sc)
+			s.schedlock.Unlock()
+			return
+		}
+	}
+	options := string(sc.Cmd)
+	s.schedlock.Unlock()
+	// the timer is only armed again below, so no other run can sneak in
+	c, err := newCmd(s, options)
+	if err != nil {
+		s.web.Logger.Printf("Failed to create command for schedule %d: %v", id, err)
+	} else {
+		// failure to start is in its status, for all to see
+		c.Start()
+	}
+	s.schedlock.Lock()
+	sc = s.schedules[id]
+	if sc == nil {
+		// deleted in the meantime
+		s.schedlock.Unlock()
+		return
+	}
+	if c != nil {
+		sc.Runs = append(sc.Runs, c.Id())
+	}
+	pruned := s.pruneRuns(sc)
+	s.armSchedule(sc)
+	s.schedlock.Unlock()
+	s.releaseRuns(pruned)
+	s.notifySchedule(id)
+}
+
+// pause or resume a schedule
+func (s *server) pauseSchedule(id int, paused bool) error {
+	s.schedlock.Lock()
+	sc := s.schedules[id]
+	if sc == nil {
+		s.schedlock.Unlock()
+		return fmt.Errorf("no such schedule: %d", id)
+	}
+	sc.Paused = paused
+	s.armSchedule(sc)
+	s.schedlock.Unlock()
+	s.notifySchedule(id)
+	return nil
+}
+
+// remove a schedule. its runs remain.
+func (s *server) deleteSchedule(id int) error {
+	s.schedlock.Lock()
+	defer s.schedlock.Unlock()
+	sc := s.schedules[id]
+	if sc == nil {
+		return fmt.Errorf("no such schedule: %d", id)
+	}
+	sc.Paused = true
+	s.armSchedule(sc)
+	delete(s.schedules, id)
+	return nil
+}
+
+// all schedules, by id
+func (s *server) Schedules() []*schedule {
+	s.schedlock.Lock()
+	defer s.schedlock.Unlock()
+	scs := []*schedule{}
+	for _, sc := range s.schedules {
+		cp := *sc
+		cp.Runs = append([]liblush.CmdId{}, sc.Runs...)
+		scs = append(scs, &cp)
+	}
+	sort.Slice(scs, func(i, j int) bool { return scs[i].Id < scs[j].Id })
+	return scs
+}
+
+// add a schedule, eg:
+//
+//     addschedule;{"cron":"*/15 * * * *","cmd":{"cmd":"make","args":["backup"]},"keep":5}
+//     addschedule;{"interval":"90s","cmd":{"cmd":"df","args":["-h"]}}
+//
+// generates a schedule event with the id, the runs so far and the next run:
+//
+//     schedule;{"id":1,"interval":"90s","cmd":{...},"keep":10,"paused":false,"runs":[],"next":"2016-..."}
+//
+// which is sent again every time a schedule changes.
+func wseventAddschedule(s *server, scheduleJSON string) error {
+	sc, err := parseSchedule(scheduleJSON)
+	if err != nil {
+		return lushError{err}
+	}
+	s.AddSchedule(sc)
+	return nil
+}
+
+// getschedules;
+// schedules;[{"id":1,...},...]
+func wseventGetschedules(s *server, _ string) error {
+	return writePrefixedJson(&s.ctrlclients, "schedules;", s.Schedules())
+}
+
+func parseScheduleId(idstr string) (int, error) {
+	id, err := strconv.Atoi(idstr)
+	if err != nil {
+		return 0, lushError{fmt.Errorf("invalid schedule id: %q", idstr)}
+	}
+	return id, nil
+}
+
+// pauseschedule;3
+func wseventPauseschedule(s *server, idstr string) error {
+	id, err := parseScheduleId(idstr)
+	if err != nil {
+		return err
+	}
+	err = s.pauseSchedule(id, true)
+	if err != nil {
+		return lushError{err}
+	}
+	return nil
+}
+
+// resumeschedule;3
+func wseventResumeschedule(s *server, idstr string) error {
+	id, err := parseScheduleId(idstr)
+	if err != nil {
+		return err
+	}
+	err = s.pauseSchedule(id, false)
+	if err != nil {
+		return lushError{err}
+	}
+	return nil
+}
+
+// delete a schedule, not its runs:
+//
+//     delschedule;3
+//     schedule_deleted;3
+func wseventDelschedule(s *server, idstr string) error {
+	id, err := parseScheduleId(idstr)
+	if err != nil {
+		return err
+	}
+	err = s.deleteSchedule(id)
+	if err != nil {
+		return lushError{err}
+	}
+	_, err = fmt.Fprintf(&s.ctrlclients, "schedule_deleted;%d", id)
+	return err
+}
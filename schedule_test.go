@@ -0,0 +1,125 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hraban/lush/liblush"
+)
+
+func TestScheduleRuns(t *testing.T) {
+	s := newServer()
+	var buf bytes.Buffer
+	s.ctrlclients.AddWriter(&buf)
+	err := wseventAddschedule(s, `{"interval": "1h", "cmd": {"cmd": "pwd", "name": "tick"}, "keep": 2}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scs := s.Schedules()
+	if len(scs) != 1 || scs[0].Next == nil || scs[0].Next.Sub(time.Now()) < 59*time.Minute {
+		t.Fatalf("Unexpected schedules: %#v", scs)
+	}
+	id := scs[0].Id
+	defer s.deleteSchedule(id)
+	if !strings.HasPrefix(buf.String(), `schedule;{"id":1,"interval":"1h"`) {
+		t.Errorf("Unexpected schedule event: %q", buf.String())
+	}
+	var runs []liblush.CmdId
+	for i := 0; i < 4; i++ {
+		s.runSchedule(id)
+		sc := s.Schedules()[0]
+		newrun := sc.Runs[len(sc.Runs)-1]
+		c := s.session.GetCommand(newrun)
+		if c == nil || c.Name() != "tick" {
+			t.Fatalf("Run %d: unexpected command %d", i, newrun)
+		}
+		c.Wait()
+		runs = append(runs, newrun)
+	}
+	// all finished now
+	s.schedlock.Lock()
+	pruned := s.pruneRuns(s.schedules[id])
+	s.schedlock.Unlock()
+	s.releaseRuns(pruned)
+	sc := s.Schedules()[0]
+	if len(sc.Runs) != 2 || sc.Runs[0] != runs[2] || sc.Runs[1] != runs[3] {
+		t.Errorf("Expected runs %v, got %v", runs[2:], sc.Runs)
+	}
+	if s.session.GetCommand(runs[0]) != nil || s.session.GetCommand(runs[1]) != nil {
+		t.Errorf("Expected runs %v to be released", runs[:2])
+	}
+	if !strings.Contains(buf.String(), "cmd_released;") {
+		t.Error("Expected a cmd_released event")
+	}
+	// paused: no runs, no next
+	err = wseventPauseschedule(s, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.runSchedule(id)
+	sc = s.Schedules()[0]
+	if !sc.Paused || sc.Next != nil || len(sc.Runs) != 2 {
+		t.Errorf("Unexpected paused schedule: %#v", sc)
+	}
+	err = wseventResumeschedule(s, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc = s.Schedules()[0]; sc.Paused || sc.Next == nil {
+		t.Errorf("Unexpected resumed schedule: %#v", sc)
+	}
+	buf.Reset()
+	err = wseventGetschedules(s, "")
+	var got []schedule
+	if err != nil || !strings.HasPrefix(buf.String(), "schedules;") ||
+		json.Unmarshal(buf.Bytes()[len("schedules;"):], &got) != nil || len(got) != 1 {
+		t.Errorf("Unexpected schedules event: %q (%v)", buf.String(), err)
+	}
+	buf.Reset()
+	err = wseventDelschedule(s, "1")
+	if err != nil || buf.String() != "schedule_deleted;1" || len(s.Schedules()) != 0 {
+		t.Errorf("Failed to delete schedule: %q (%v)", buf.String(), err)
+	}
+	if _, ok := wseventDelschedule(s, "1").(lushError); !ok {
+		t.Error("Expected an error deleting a deleted schedule")
+	}
+}
+
+func TestScheduleTimer(t *testing.T) {
+	s := newServer()
+	sc, err := parseSchedule(`{"cron": "@every 1s", "cmd": {"cmd": "pwd"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.AddSchedule(sc)
+	defer s.deleteSchedule(sc.Id)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(s.Schedules()[0].Runs) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Schedule didn't run")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestScheduleInvalid(t *testing.T) {
+	for _, js := range []string{
+		`{"cmd": {"cmd": "ls"}}`,
+		`{"cron": "* * * * *", "interval": "1m", "cmd": {"cmd": "ls"}}`,
+		`{"cron": "* * *", "cmd": {"cmd": "ls"}}`,
+		`{"interval": "10ms", "cmd": {"cmd": "ls"}}`,
+		`{"interval": "1m"}`,
+		`{"interval": "1m", "cmd": {"args": ["foo"]}}`,
+	} {
+		if _, err := parseSchedule(js); err == nil {
+			t.Errorf("Expected error for %s", js)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+// Search through the output of the commands in the session, line by line. Only
+// the scrollback is searched: output isn't kept anywhere else. Offsets are in
+// bytes from the start of the scrollback, like the byte ranges of
+// /api/cmds/N/stdout, so they shift as new output pushes out the old.
+//
+//     search;{"q":"error","icase":true,"nid":3,"stream":"stderr","context":2,"userdata":"x"}
+//
+// all fields but q are optional. q is a regular expression if "regex" is set.
+// results, by command and stream, are sent as a searchresults event:
+//
+//     searchresults;{"userdata":"x","matches":[{"nid":3,"stream":"stderr","offset":1234,"length":5,"lineno":17,"line":"an error here","before":[...],"after":[...]},...]}
+//
+// Also over HTTP: GET /api/search?q=error&icase=1&nid=3&stream=stderr&context=2
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/hraban/lush/liblush"
+	"github.com/hraban/web"
+)
+
+const defaultSearchLimit = 100
+
+const maxSearchContext = 20
+
+type searchOptions struct {
+	Q     string `json:"q"`
+	Regex bool   `json:"regex"`
+	// case insensitive
+	IgnoreCase bool `json:"icase"`
+	// only this command, 0 for all
+	Id liblush.CmdId `json:"nid"`
+	// stdout, stderr or empty for both
+	Stream string `json:"stream"`
+	// lines before and after every match
+	Context int `json:"context"`
+	// max number of matches, 0 for the default
+	Limit    int         `json:"limit"`
+	Userdata interface{} `json:"userdata"`
+}
+
+type searchMatch struct {
+	Id     liblush.CmdId `json:"nid"`
+	Stream string        `json:"stream"`
+	Offset int           `json:"offset"`
+	Length int           `json:"length"`
+	// first line of the scrollback is 1
+	LineNo int      `json:"lineno"`
+	Line   string   `json:"line"`
+	Before []string `json:"before"`
+	After  []string `json:"after"`
+}
+
+type searchResults struct {
+	Userdata interface{}   `json:"userdata,omitempty"`
+	Matches  []searchMatch `json:"matches"`
+}
+
+func compileSearch(o searchOptions) (*regexp.Regexp, error) {
+	if o.Q == "" {
+		return nil, errors.New("empty search query")
+	}
+	expr := o.Q
+	if !o.Regex {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if o.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+	return regexp.Compile(expr)
+}
+
+// search the scrollback of one stream, appending to matches until there are
+// limit
+func searchStream(matches []searchMatch, re *regexp.Regexp, id liblush.CmdId, streamname string, rb liblush.Ringbuffer, context, limit int) []searchMatch {
+	var buf bytes.Buffer
+	rb.WriteTo(&buf)
+	data := buf.Bytes()
+	// the oldest character may have been cut in half
+	start := 0
+	for start < len(data) && !utf8.RuneStart(data[start]) {
+		start++
+	}
+	lines := bytes.Split(data[start:], []byte{'\n'})
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		// trailing newline
+		lines = lines[:len(lines)-1]
+	}
+	offset := start
+	for i, line := range lines {
+		for _, loc := range re.FindAllIndex(line, -1) {
+			if loc[0] == loc[1] {
+				continue
+			}
+			if len(matches) >= limit {
+				return matches
+			}
+			m := searchMatch{
+				Id:     id,
+				Stream: streamname,
+				Offset: offset + loc[0],
+				Length: loc[1] - loc[0],
+				LineNo: i + 1,
+				Line:   string(line),
+				Before: []string{},
+				After:  []string{},
+			}
+			for j := i - context; j < i; j++ {
+				if j >= 0 {
+					m.Before = append(m.Before, string(lines[j]))
+				}
+			}
+			for j := i + 1; j <= i+context && j < len(lines); j++ {
+				m.After = append(m.After, string(lines[j]))
+			}
+			matches = append(matches, m)
+		}
+		offset += len(line) + 1
+	}
+	return matches
+}
+
+func (s *server) searchOutput(o searchOptions) ([]searchMatch, error) {
+	re, err := compileSearch(o)
+	if err != nil {
+		return nil, err
+	}
+	switch o.Stream {
+	case "", "stdout", "stderr":
+	default:
+		return nil, fmt.Errorf("unknown stream: %q", o.Stream)
+	}
+	if o.Context < 0 {
+		o.Context = 0
+	} else if o.Context > maxSearchContext {
+		o.Context = maxSearchContext
+	}
+	if o.Limit <= 0 {
+		o.Limit = defaultSearchLimit
+	}
+	var ids []int
+	if o.Id != 0 {
+		if s.session.GetCommand(o.Id) == nil {
+			return nil, fmt.Errorf("no such command: %d", o.Id)
+		}
+		ids = append(ids, int(o.Id))
+	} else {
+		for _, id := range s.session.GetCommandIds() {
+			ids = append(ids, int(id))
+		}
+		sort.Ints(ids)
+	}
+	matches := []searchMatch{}
+	for _, i := range ids {
+		id := liblush.CmdId(i)
+		c := s.session.GetCommand(id)
+		if c == nil {
+			// released in the meantime
+			continue
+		}
+		if o.Stream != "stderr" {
+			matches = searchStream(matches, re, id, "stdout", c.Stdout().Scrollback(), o.Context, o.Limit)
+		}
+		if o.Stream != "stdout" {
+			matches = searchStream(matches, re, id, "stderr", c.Stderr().Scrollback(), o.Context, o.Limit)
+		}
+	}
+	return matches, nil
+}
+
+func wseventSearch(s *server, optionsJSON string) error {
+	var options searchOptions
+	err := json.Unmarshal([]byte(optionsJSON), &options)
+	if err != nil {
+		return fmt.Errorf("malformed JSON: %v", err)
+	}
+	matches, err := s.searchOutput(options)
+	if err != nil {
+		return lushError{err}
+	}
+	return writePrefixedJson(&s.ctrlclients, "searchresults;", searchResults{
+		Userdata: options.Userdata,
+		Matches:  matches,
+	})
+}
+
+// ?q=...&regex=1&icase=1&nid=N&stream=stdout|stderr&context=N&limit=N, the
+// matches as a JSON array
+func handleGetApiSearch(ctx *web.Context) error {
+	s := ctx.User.(*server)
+	o := searchOptions{
+		Q:          ctx.Params["q"],
+		Regex:      ctx.Params["regex"] != "" && ctx.Params["regex"] != "0",
+		IgnoreCase: ctx.Params["icase"] != "" && ctx.Params["icase"] != "0",
+		Stream:     ctx.Params["stream"],
+	}
+	for param, dst := range map[string]*int{
+		"context": &o.Context,
+		"limit":   &o.Limit,
+	} {
+		if v := ctx.Params[param]; v != "" {
+			var err error
+			*dst, err = strconv.Atoi(v)
+			if err != nil {
+				return web.WebError{400, "invalid " + param + ": " + v}
+			}
+		}
+	}
+	if v := ctx.Params["nid"]; v != "" {
+		_, err := fmt.Sscan(v, &o.Id)
+		if err != nil {
+			return web.WebError{400, "invalid nid: " + v}
+		}
+	}
+	matches, err := s.searchOutput(o)
+	if err != nil {
+		return web.WebError{400, err.Error()}
+	}
+	ctx.ContentType("json")
+	return json.NewEncoder(ctx).Encode(matches)
+}
+
+func init() {
+	serverinitializers = append(serverinitializers, func(s *server) {
+		s.web.Get(`/api/search`, handleGetApiSearch)
+	})
+}
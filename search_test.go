@@ -0,0 +1,127 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hraban/lush/liblush"
+)
+
+// a command that was never started, with this output in its scrollback
+func cmdWithOutput(t *testing.T, s *server, stdout, stderr string) liblush.Cmd {
+	c, err := newCmd(s, `{"cmd": "true"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Stdout().Scrollback().Write([]byte(stdout))
+	c.Stderr().Scrollback().Write([]byte(stderr))
+	return c
+}
+
+func TestSearchOutput(t *testing.T) {
+	s := newServer()
+	c1 := cmdWithOutput(t, s, "one\ntwo Error\nthree\nfour\n", "error: x\n")
+	c2 := cmdWithOutput(t, s, "ERROR and error", "")
+	ms, err := s.searchOutput(searchOptions{Q: "error", Context: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 2 {
+		t.Fatalf("Expected 2 matches, got %#v", ms)
+	}
+	if m := ms[0]; m.Id != c1.Id() || m.Stream != "stderr" || m.Offset != 0 || m.LineNo != 1 || len(m.Before) != 0 {
+		t.Errorf("Unexpected first match: %#v", m)
+	}
+	if m := ms[1]; m.Id != c2.Id() || m.Offset != 10 || m.Length != 5 || m.Line != "ERROR and error" {
+		t.Errorf("Unexpected second match: %#v", m)
+	}
+	ms, err = s.searchOutput(searchOptions{Q: "error", IgnoreCase: true, Id: c1.Id(), Stream: "stdout", Context: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 1 {
+		t.Fatalf("Expected 1 match, got %#v", ms)
+	}
+	m := ms[0]
+	if m.Offset != 8 || m.LineNo != 2 || m.Line != "two Error" {
+		t.Errorf("Unexpected match: %#v", m)
+	}
+	if fmt.Sprint(m.Before, m.After) != "[one] [three]" {
+		t.Errorf("Unexpected context: %q %q", m.Before, m.After)
+	}
+	ms, err = s.searchOutput(searchOptions{Q: `^t\w+$`, Regex: true, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 1 || ms[0].Line != "three" {
+		t.Errorf("Unexpected regex matches: %#v", ms)
+	}
+	// not a regex
+	ms, _ = s.searchOutput(searchOptions{Q: "x."})
+	if len(ms) != 0 {
+		t.Errorf("Expected no matches for a literal, got %#v", ms)
+	}
+	for _, o := range []searchOptions{
+		{},
+		{Q: "(", Regex: true},
+		{Q: "x", Stream: "stdin"},
+		{Q: "x", Id: 1000},
+	} {
+		if _, err := s.searchOutput(o); err == nil {
+			t.Errorf("Expected an error for %#v", o)
+		}
+	}
+}
+
+func TestSearchBrokenRune(t *testing.T) {
+	s := newServer()
+	c := cmdWithOutput(t, s, "", "")
+	c.Stdout().Scrollback().Resize(8)
+	// the first é is cut in half
+	c.Stdout().Scrollback().Write([]byte("caféé\nfoo\n"))
+	ms, err := s.searchOutput(searchOptions{Q: "foo", Context: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 1 || ms[0].Offset != 4 || fmt.Sprint(ms[0].Before) != "[é]" {
+		t.Errorf("Unexpected matches: %#v", ms)
+	}
+}
+
+func TestSearchEvents(t *testing.T) {
+	s := newServer()
+	var buf bytes.Buffer
+	s.ctrlclients.AddWriter(&buf)
+	c := cmdWithOutput(t, s, "hello world\n", "")
+	buf.Reset()
+	err := wseventSearch(s, `{"q": "world", "userdata": "x"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := fmt.Sprintf(`searchresults;{"userdata":"x","matches":[{"nid":%d,"stream":"stdout","offset":6,"length":5,"lineno":1,"line":"hello world","before":[],"after":[]}]}`, c.Id())
+	if strings.TrimSpace(buf.String()) != expected {
+		t.Errorf("Expected %s, got %s", expected, buf.String())
+	}
+	if _, ok := wseventSearch(s, `{"q": ""}`).(lushError); !ok {
+		t.Error("Expected a lushError for an empty query")
+	}
+	ts := httptest.NewServer(s.httpHandler)
+	defer ts.Close()
+	code, body := restRequest(t, "GET", ts.URL+"/api/search?q=WORLD&icase=1&stream=stdout", "")
+	var ms []searchMatch
+	if code != 200 || json.Unmarshal([]byte(body), &ms) != nil || len(ms) != 1 {
+		t.Errorf("Unexpected search response: %d %s", code, body)
+	}
+	code, _ = restRequest(t, "GET", ts.URL+"/api/search?q=x&limit=many", "")
+	if code != 400 {
+		t.Errorf("Expected 400 for an invalid limit, got %d", code)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/hraban/httpauth"
 	"github.com/hraban/lush/liblush"
@@ -35,6 +36,38 @@ type server struct {
 	// If non-empty, this password must be supplied by users before connection
 	// succeeds
 	password string
+	// alternative to password: user name -> user. see SetUsers.
+	users       map[string]lushUser
+	accountlock sync.Mutex
+	history     *history
+	execIndex   *execIndex
+	// aliases are saved here after every change, if not empty
+	aliasfile string
+	aliaslock sync.Mutex
+	// of the alias file, nil for us. see openOwnedFile.
+	aliasowner *liblush.Account
+	// defaults for new commands that don't specify one
+	stdoutScrollback int
+	stderrScrollback int
+	// load ~/.lushrc of the account when the session gets bound to one
+	homeRc   bool
+	rcerrors []string
+	rclock   sync.Mutex
+	// likewise keep the aliases and history in the home dir of the account
+	homeAliases bool
+	homeHistory bool
+	// run when commands exit, see hooks.go
+	hooks []hook
+	// by id, see schedule.go
+	schedules   map[int]*schedule
+	lastschedid int
+	schedlock   sync.Mutex
+	// by the id of the latest run, see watch.go
+	watchers  map[liblush.CmdId]*cmdWatcher
+	watchlock sync.Mutex
+	// streams already proxied to the websocket clients, see wseventSubscribe
+	subscriptions map[liblush.CmdId]map[string]bool
+	subscribelock sync.Mutex
 }
 
 // functions added to this slice at init() time will be called for every new
@@ -47,9 +80,23 @@ var path string
 func newServer() *server {
 	assets := getAssets()
 	s := &server{
-		session: liblush.NewSession(),
-		web:     web.NewServer(),
+		session:          liblush.NewSession(),
+		web:              web.NewServer(),
+		history:          newHistory(),
+		execIndex:        newExecIndex(),
+		schedules:        map[int]*schedule{},
+		watchers:         map[liblush.CmdId]*cmdWatcher{},
+		subscriptions:    map[liblush.CmdId]map[string]bool{},
+		stdoutScrollback: 1000,
+		stderrScrollback: 1000,
 	}
+	// events happen without websocket clients too (eg through the REST API),
+	// which shouldn't fail for lack of an audience
+	s.ctrlclients.AddWriter(liblush.Devnull)
+	// whoever changes the directory: a chdir event, the cd builtin, ...
+	s.session.NotifyChdir(func(dir string) {
+		writePrefixedJson(&s.ctrlclients, "chdir;", dir)
+	})
 	s.httpHandler = s.web
 	s.web.Config.StaticDirs = []string{assets.Web}
 	s.web.User = s
@@ -83,7 +130,7 @@ func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 // must be "lush", the password is given here. Can only be called once! Will
 // panic if called twice.
 func (s *server) SetPassword(passwd string) {
-	if s.password != "" {
+	if s.password != "" || s.users != nil {
 		panic("Password can only be set once")
 	}
 	if passwd == "" {
@@ -110,7 +157,7 @@ func (s *server) Run(listenaddr string) error {
 		return errors.New("Illegal listen address")
 	}
 	// Don't allow unprotected listening on non-localhost ports
-	if s.password == "" && !isLocalhost(host) {
+	if s.password == "" && s.users == nil && !isLocalhost(host) {
 		const msg = `
 Password required when listening on public interface.
 
@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"regexp"
 	"testing"
 )
@@ -43,6 +44,58 @@ func TestServerAuthentication(t *testing.T) {
 	}
 }
 
+func TestServerUsers(t *testing.T) {
+	f, err := ioutil.TempFile("", "lush-users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("# test users\nalice:pw1:nobody\n\nbob:pw2\n")
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, err := parseUsersFile(f.Name())
+	if err != nil {
+		t.Fatal("Failed to parse users file:", err)
+	}
+	if users["alice"].account != "nobody" || users["bob"].account != "bob" {
+		t.Fatalf("Unexpected users: %#v", users)
+	}
+	s := newServer()
+	s.SetUsers(users)
+	req := mustRequest(http.NewRequest("GET", "/", nil))
+	for _, c := range []struct {
+		user, pass string
+		code       int
+	}{
+		{"alice", "pw1", 200},
+		{"bob", "pw2", 200},
+		{"alice", "pw2", 401},
+		{"lush", "pw1", 401},
+	} {
+		req.SetBasicAuth(c.user, c.pass)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != c.code {
+			t.Errorf("Expected %d status for %s:%s, got %d", c.code, c.user,
+				c.pass, rec.Code)
+		}
+	}
+	req.SetBasicAuth("alice", "pw1")
+	err = s.bindAccount(req)
+	if err != nil {
+		t.Skip("Couldn't bind account:", err)
+	}
+	if a := s.session.Account(); a == nil || a.Name != "nobody" {
+		t.Errorf("Expected session to run as nobody, got %#v", a)
+	}
+	req.SetBasicAuth("bob", "pw2")
+	if s.bindAccount(req) == nil {
+		t.Error("Expected error binding session to a second account")
+	}
+}
+
 func testGetIndexPage(t *testing.T, url string) {
 	res, err := http.Get(url)
 	if err != nil {
@@ -0,0 +1,78 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/hraban/lush/liblush"
+)
+
+// signals that clients can refer to by name. only the ones that exist on every
+// platform; whether sending them actually works is another matter.
+var signalsByName = map[string]os.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGKILL": syscall.SIGKILL,
+	"SIGTERM": syscall.SIGTERM,
+}
+
+func parseSignal(name string) (os.Signal, error) {
+	sig, ok := signalsByName[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown signal: %q", name)
+	}
+	return sig, nil
+}
+
+// name of the signal as accepted by parseSignal, if possible
+func signalName(sig os.Signal) string {
+	for name, sig2 := range signalsByName {
+		if sig == sig2 {
+			return name
+		}
+	}
+	return sig.String()
+}
+
+type stopStepJson struct {
+	Signal string `json:"signal"`
+	// seconds
+	Wait float64 `json:"wait"`
+}
+
+func parseStopSequence(stepsjson []stopStepJson) ([]liblush.StopStep, error) {
+	steps := make([]liblush.StopStep, len(stepsjson))
+	for i, stepjson := range stepsjson {
+		sig, err := parseSignal(stepjson.Signal)
+		if err != nil {
+			return nil, err
+		}
+		steps[i] = liblush.StopStep{
+			Signal: sig,
+			Wait:   seconds2duration(stepjson.Wait),
+		}
+	}
+	return steps, nil
+}
+
+func stopSequence2json(steps []liblush.StopStep) []stopStepJson {
+	stepsjson := make([]stopStepJson, len(steps))
+	for i, step := range steps {
+		stepsjson[i] = stopStepJson{
+			Signal: signalName(step.Signal),
+			Wait:   step.Wait.Seconds(),
+		}
+	}
+	return stepsjson
+}
+
+func seconds2duration(secs float64) time.Duration {
+	return time.Duration(secs * float64(time.Second))
+}
@@ -0,0 +1,269 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+// Server-Sent Events: the websocket events, read-only, for anything that can
+// do HTTP. GET /events, optionally filtered:
+//
+//     /events?cmd=3,5&type=status,stream
+//
+// Every websocket event becomes an SSE event of the same name, with the
+// payload as data. Property events about the status of a command are called
+// status instead, because that's what most observers are after. With a cmd
+// filter, events that aren't about a command (eg allclients) are left out.
+//
+// Unlike websocket clients, SSE clients don't subscribe to stream data: they
+// get it for all commands they're interested in, including new ones.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hraban/lush/liblush"
+	"github.com/hraban/web"
+)
+
+// comment line to keep the connection alive through proxies
+const ssePingInterval = 30 * time.Second
+
+var errSseClosed = errors.New("SSE client closed")
+
+var sseNewlines = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+type sseClient struct {
+	s       *server
+	w       http.ResponseWriter
+	flusher http.Flusher
+	// nil for all
+	cmds  map[liblush.CmdId]bool
+	types map[string]bool
+	lock  sync.Mutex
+	// can't write to w after the handler returned
+	closed bool
+}
+
+// delivers data straight to the client, bypassing the filter for stream data
+type sseDirect struct {
+	*sseClient
+}
+
+func (d sseDirect) Write(data []byte) (int, error) {
+	return len(data), d.deliver(data)
+}
+
+// comma separated list to a set, nil if empty
+func parseSseFilter(list string) map[string]bool {
+	if list == "" {
+		return nil
+	}
+	set := map[string]bool{}
+	for _, x := range strings.Split(list, ",") {
+		set[strings.TrimSpace(x)] = true
+	}
+	return set
+}
+
+func newSseClient(s *server, w http.ResponseWriter, cmds, types string) (*sseClient, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("streaming not supported")
+	}
+	c := &sseClient{
+		s:       s,
+		w:       w,
+		flusher: flusher,
+		types:   parseSseFilter(types),
+	}
+	if ids := parseSseFilter(cmds); ids != nil {
+		c.cmds = map[liblush.CmdId]bool{}
+		for idstr := range ids {
+			id, err := liblush.ParseCmdId(idstr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid command id: %q", idstr)
+			}
+			c.cmds[id] = true
+		}
+	}
+	return c, nil
+}
+
+// ids of the commands this event is about, if any
+func eventCmdIds(event, payload string) []liblush.CmdId {
+	switch event {
+	case "stream", "record", "cmd_released":
+		id, err := liblush.ParseCmdId(strings.SplitN(payload, ";", 2)[0])
+		if err != nil {
+			return nil
+		}
+		return []liblush.CmdId{id}
+	}
+	// all JSON events about commands have one of these
+	var ids struct {
+		Name     string
+		Nid      liblush.CmdId
+		From, To liblush.CmdId
+	}
+	if json.Unmarshal([]byte(payload), &ids) != nil {
+		return nil
+	}
+	switch {
+	case event == "property" && strings.HasPrefix(ids.Name, "cmd"):
+		id, err := liblush.ParseCmdId(ids.Name[3:])
+		if err != nil {
+			return nil
+		}
+		return []liblush.CmdId{id}
+	case event == "rerun":
+		return []liblush.CmdId{ids.From, ids.To}
+	case ids.Nid != 0:
+		return []liblush.CmdId{ids.Nid}
+	}
+	return nil
+}
+
+func (c *sseClient) wantsCmd(id liblush.CmdId) bool {
+	return c.cmds == nil || c.cmds[id]
+}
+
+func (c *sseClient) wantsStreams() bool {
+	return c.types == nil || c.types["stream"] || c.types["record"]
+}
+
+// send stream data of this command to the client from now on
+func (c *sseClient) subscribe(cmd liblush.Cmd) {
+	if !c.wantsCmd(cmd.Id()) || !c.wantsStreams() {
+		return
+	}
+	for name, stream := range map[string]liblush.OutStream{
+		"stdout": cmd.Stdout(),
+		"stderr": cmd.Stderr(),
+	} {
+		prefix := fmt.Sprintf("%d;%s;", cmd.Id(), name)
+		w := newPrefixedWriter(sseDirect{c}, []byte("stream;"+prefix))
+		// removed by the stream as soon as it fails, after closing
+		stream.Peeker().AddWriter(newNopWriteCloser(w))
+		w = newPrefixedWriter(sseDirect{c}, []byte("record;"+prefix))
+		stream.RecordPeeker().AddWriter(newNopWriteCloser(w))
+	}
+}
+
+// an event from the websocket broadcast
+func (c *sseClient) Write(data []byte) (int, error) {
+	msg := string(data)
+	switch {
+	case strings.HasPrefix(msg, "stream;"), strings.HasPrefix(msg, "record;"):
+		// it has its own subscriptions
+		return len(data), nil
+	case strings.HasPrefix(msg, "newcmd;"):
+		var md struct{ Nid liblush.CmdId }
+		if json.Unmarshal(data[len("newcmd;"):], &md) == nil {
+			if cmd := c.s.session.GetCommand(md.Nid); cmd != nil {
+				c.subscribe(cmd)
+			}
+		}
+	}
+	return len(data), c.deliver(data)
+}
+
+// send an event to the client, if it passes the filters
+func (c *sseClient) deliver(data []byte) error {
+	msg := strings.SplitN(string(data), ";", 2)
+	if len(msg) != 2 {
+		return nil
+	}
+	event, payload := msg[0], msg[1]
+	if event == "property" {
+		var prop struct{ Prop string }
+		if json.Unmarshal([]byte(payload), &prop) == nil && prop.Prop == "status" {
+			event = "status"
+		}
+	}
+	if c.types != nil && !c.types[event] {
+		return nil
+	}
+	if c.cmds != nil {
+		wanted := false
+		for _, id := range eventCmdIds(msg[0], payload) {
+			wanted = wanted || c.cmds[id]
+		}
+		if !wanted {
+			return nil
+		}
+	}
+	var buf []byte
+	buf = append(buf, "event: "+event+"\n"...)
+	// SSE data can't contain newlines, every line is a data field. any of
+	// \r\n, \r and \n ends a line: otherwise output could sneak in fields of
+	// its own. the client joins them with \n.
+	for _, line := range strings.Split(sseNewlines.Replace(payload), "\n") {
+		buf = append(buf, "data: "+line+"\n"...)
+	}
+	buf = append(buf, '\n')
+	return c.send(buf)
+}
+
+func (c *sseClient) send(data []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return errSseClosed
+	}
+	_, err := c.w.Write(data)
+	if err != nil {
+		return err
+	}
+	c.flusher.Flush()
+	return nil
+}
+
+func (c *sseClient) close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.closed = true
+}
+
+func handleGetEvents(ctx *web.Context) error {
+	s := ctx.User.(*server)
+	c, err := newSseClient(s, ctx.Response, ctx.Params["cmd"], ctx.Params["type"])
+	if err != nil {
+		return web.WebError{400, err.Error()}
+	}
+	h := ctx.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	ctx.WriteHeader(200)
+	c.flusher.Flush()
+	for _, id := range s.session.GetCommandIds() {
+		if cmd := s.session.GetCommand(id); cmd != nil {
+			c.subscribe(cmd)
+		}
+	}
+	s.ctrlclients.AddWriter(c)
+	defer c.close()
+	defer s.ctrlclients.RemoveWriter(c)
+	ticker := time.NewTicker(ssePingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return nil
+		case <-ticker.C:
+			if c.send([]byte(": ping\n\n")) != nil {
+				return nil
+			}
+		}
+	}
+}
+
+func init() {
+	serverinitializers = append(serverinitializers, func(s *server) {
+		s.web.Get(`/events`, handleGetEvents)
+	})
+}
@@ -0,0 +1,96 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// read SSE events until one passes f, return that one's data
+func readSseUntil(t *testing.T, r *bufio.Reader, f func(event, data string) bool) string {
+	var event string
+	var data []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal("Reading SSE stream:", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = line[len("event: "):]
+		case strings.HasPrefix(line, "data: "):
+			data = append(data, line[len("data: "):])
+		case line == "":
+			if event != "" && f(event, strings.Join(data, "\n")) {
+				return strings.Join(data, "\n")
+			}
+			event, data = "", nil
+		}
+	}
+}
+
+func TestSse(t *testing.T) {
+	s := newServer()
+	ts := httptest.NewServer(s.httpHandler)
+	defer ts.Close()
+	_, body := restRequest(t, "POST", ts.URL+"/api/cmds", `{"cmd":"pwd"}`)
+	var md cmdmetadata
+	json.Unmarshal([]byte(body), &md)
+	_, body = restRequest(t, "POST", ts.URL+"/api/cmds", `{"cmd":"pwd"}`)
+	var other cmdmetadata
+	json.Unmarshal([]byte(body), &other)
+	client := http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(fmt.Sprintf("%s/events?cmd=%d&type=status,stream", ts.URL, md.Id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Unexpected content type: %q", ct)
+	}
+	r := bufio.NewReader(resp.Body)
+	restRequest(t, "POST", fmt.Sprintf("%s/api/cmds/%d/start", ts.URL, other.Id), "")
+	restRequest(t, "POST", fmt.Sprintf("%s/api/cmds/%d/start", ts.URL, md.Id), "")
+	cmdname := fmt.Sprintf(`"name":"cmd%d"`, md.Id)
+	var events []string
+	readSseUntil(t, r, func(event, data string) bool {
+		events = append(events, event)
+		if event == "status" && !strings.Contains(data, cmdname) {
+			t.Errorf("Status of another command: %s", data)
+		}
+		if event == "stream" && !strings.HasPrefix(data, fmt.Sprintf("%d;stdout;", md.Id)) {
+			t.Errorf("Unexpected stream data: %q", data)
+		}
+		return event == "status" && strings.Contains(data, `"code":2`)
+	})
+	if strings.Join(events, ",") != "status,stream,status" {
+		t.Errorf("Unexpected events: %v", events)
+	}
+}
+
+func TestSseNewlines(t *testing.T) {
+	rec := httptest.NewRecorder()
+	c := &sseClient{w: rec, flusher: rec}
+	err := c.deliver([]byte("stream;3;stdout;a\rid: 6\r\nevent: fake\nb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "event: stream\n" +
+		"data: 3;stdout;a\n" +
+		"data: id: 6\n" +
+		"data: event: fake\n" +
+		"data: b\n\n"
+	if got := rec.Body.String(); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
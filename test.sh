@@ -18,7 +18,7 @@ cleanecho () {
 }
 trap cleanecho EXIT
 
-ECHOBIN=$ECHOBIN go test . ./liblush
+ECHOBIN=$ECHOBIN go test -race . ./liblush ./lushclient ./posixtools/...
 
 phantompath="$(which phantomjs)"
 if [[ -z "$phantompath" ]]
@@ -0,0 +1,110 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+// JSON for liblush.Trigger, and the trigger event. Every match of a trigger is
+// broadcast:
+//
+//     trigger;{"nid":3,"trigger":0,"pattern":"ERROR","stream":"stdout","line":"ERROR: oops","offset":1234,"time":"..."}
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/hraban/lush/liblush"
+)
+
+type triggerJson struct {
+	// stdout, stderr or empty for both
+	Stream  string `json:"stream,omitempty"`
+	Pattern string `json:"pattern"`
+	// stop the command on a match
+	Stop bool `json:"stop,omitempty"`
+	// start this command on a match
+	Start liblush.CmdId `json:"start,omitempty"`
+}
+
+type triggerMatchJson struct {
+	Trigger int       `json:"trigger"`
+	Stream  string    `json:"stream"`
+	Line    string    `json:"line"`
+	Offset  int64     `json:"offset"`
+	Time    time.Time `json:"time"`
+}
+
+type triggerEventJson struct {
+	Id      liblush.CmdId `json:"nid"`
+	Pattern string        `json:"pattern"`
+	triggerMatchJson
+}
+
+func triggers2json(ts []liblush.Trigger) []triggerJson {
+	tjs := []triggerJson{}
+	for _, t := range ts {
+		tjs = append(tjs, triggerJson{
+			Stream:  t.Stream,
+			Pattern: t.Pattern.String(),
+			Stop:    t.Stop,
+			Start:   t.Start,
+		})
+	}
+	return tjs
+}
+
+func parseTriggers(tjs []triggerJson) ([]liblush.Trigger, error) {
+	var ts []liblush.Trigger
+	for _, tj := range tjs {
+		switch tj.Stream {
+		case "", "stdout", "stderr":
+		default:
+			return nil, fmt.Errorf("unknown stream: %q", tj.Stream)
+		}
+		re, err := regexp.Compile(tj.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		ts = append(ts, liblush.Trigger{
+			Stream:  tj.Stream,
+			Pattern: re,
+			Stop:    tj.Stop,
+			Start:   tj.Start,
+		})
+	}
+	return ts, nil
+}
+
+func triggerMatch2json(m liblush.TriggerMatch) triggerMatchJson {
+	return triggerMatchJson{
+		Trigger: m.Trigger,
+		Stream:  m.Stream,
+		Line:    m.Line,
+		Offset:  m.Offset,
+		Time:    m.Time,
+	}
+}
+
+func triggerMatches2json(ms []liblush.TriggerMatch) []triggerMatchJson {
+	mjs := []triggerMatchJson{}
+	for _, m := range ms {
+		mjs = append(mjs, triggerMatch2json(m))
+	}
+	return mjs
+}
+
+// broadcast every match of a trigger of this command
+func announceTriggers(s *server, c liblush.Cmd) {
+	c.NotifyTrigger(func(m liblush.TriggerMatch) {
+		var pattern string
+		if ts := c.Triggers(); m.Trigger < len(ts) {
+			pattern = ts[m.Trigger].Pattern.String()
+		}
+		writePrefixedJson(&s.ctrlclients, "trigger;", triggerEventJson{
+			Id:               c.Id(),
+			Pattern:          pattern,
+			triggerMatchJson: triggerMatch2json(m),
+		})
+	})
+}
@@ -0,0 +1,61 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestTriggers(t *testing.T) {
+	if _, err := exec.LookPath("echo"); err != nil {
+		t.Skip("no echo in PATH")
+	}
+	s := newServer()
+	var buf bytes.Buffer
+	s.ctrlclients.AddWriter(&buf)
+	_, err := newCmd(s, `{"cmd": "echo", "triggers": [{"pattern": "("}]}`)
+	if _, ok := err.(lushError); !ok {
+		t.Errorf("Expected a lushError for an invalid pattern, got %v", err)
+	}
+	_, err = newCmd(s, `{"cmd": "echo", "triggers": [{"stream": "stdin", "pattern": "x"}]}`)
+	if _, ok := err.(lushError); !ok {
+		t.Errorf("Expected a lushError for an invalid stream, got %v", err)
+	}
+	if ids := s.session.GetCommandIds(); len(ids) != 0 {
+		t.Errorf("Invalid commands left behind in the session: %v", ids)
+	}
+	c, err := newCmd(s, `{"cmd": "echo", "args": ["it's an ERROR"], "triggers": [{"pattern": "ERR"}, {"stream": "stderr", "pattern": "ERR"}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Start()
+	c.Wait()
+	md, err := metacmd{c}.Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(md.Triggers) != 2 || md.Triggers[1].Stream != "stderr" {
+		t.Errorf("Unexpected triggers in metadata: %#v", md.Triggers)
+	}
+	ms := md.TriggerMatches
+	if len(ms) != 1 || ms[0].Trigger != 0 || ms[0].Line != "it's an ERROR" || ms[0].Offset != 0 {
+		t.Errorf("Unexpected trigger matches: %#v", ms)
+	}
+	prefix := fmt.Sprintf(`trigger;{"nid":%d,"pattern":"ERR","trigger":0,"stream":"stdout","line":"it's an ERROR","offset":0,`, c.Id())
+	if !strings.Contains(buf.String(), prefix) {
+		t.Errorf("Expected a trigger event, got %q", buf.String())
+	}
+	err = wseventUpdatecmd(s, fmt.Sprintf(`{"nid": %d, "triggers": []}`, c.Id()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Triggers()) != 0 {
+		t.Errorf("Expected triggers to be removed, got %v", c.Triggers())
+	}
+}
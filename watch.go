@@ -0,0 +1,239 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+// Watch mode: once a command with a watch (see liblush.Watch) has been
+// started, changes to its files rerun it. A rerun stops the command if it is
+// still running, and then replaces it by a clone: the clone is announced like
+// a rerun event, the previous run is released and the clone started. The
+// watch moves on to the clone, so there is only ever one run of a watched
+// command around.
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hraban/lush/liblush"
+)
+
+const defaultWatchDebounce = 200 * time.Millisecond
+
+type watchJson struct {
+	Paths []string `json:"paths"`
+	// seconds to wait for more changes before rerunning, 0 for the default
+	Debounce float64 `json:"debounce,omitempty"`
+}
+
+func watch2json(w *liblush.Watch) *watchJson {
+	if w == nil {
+		return nil
+	}
+	return &watchJson{
+		Paths:    w.Paths,
+		Debounce: w.Debounce.Seconds(),
+	}
+}
+
+// nil without paths
+func json2watch(wj *watchJson) *liblush.Watch {
+	if wj == nil || len(wj.Paths) == 0 {
+		return nil
+	}
+	return &liblush.Watch{
+		Paths:    wj.Paths,
+		Debounce: seconds2duration(wj.Debounce),
+	}
+}
+
+// watches the files of one command
+type cmdWatcher struct {
+	s        *server
+	cmd      liblush.Cmd
+	debounce time.Duration
+	// absolute
+	patterns []string
+	fs       *fsWatcher
+	lock     sync.Mutex
+	timer    *time.Timer
+	// closed, or busy rerunning
+	done bool
+}
+
+func hasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[\`)
+}
+
+// directories to watch for changes matching this pattern
+func watchDirs(pattern string) []string {
+	if !hasGlobMeta(pattern) {
+		if fi, err := os.Stat(pattern); err == nil && fi.IsDir() {
+			return []string{pattern}
+		}
+		return []string{filepath.Dir(pattern)}
+	}
+	dir := filepath.Dir(pattern)
+	if !hasGlobMeta(dir) {
+		return []string{dir}
+	}
+	matches, _ := filepath.Glob(dir)
+	var dirs []string
+	for _, m := range matches {
+		if fi, err := os.Stat(m); err == nil && fi.IsDir() {
+			dirs = append(dirs, m)
+		}
+	}
+	return dirs
+}
+
+// does a change to this path concern us?
+func (w *cmdWatcher) matches(path string) bool {
+	for _, p := range w.patterns {
+		if hasGlobMeta(p) {
+			if ok, _ := filepath.Match(p, path); ok {
+				return true
+			}
+		} else if path == p || filepath.Dir(path) == p {
+			// the file itself or an entry of the directory
+			return true
+		}
+	}
+	return false
+}
+
+func newCmdWatcher(s *server, c liblush.Cmd, watch *liblush.Watch) (*cmdWatcher, error) {
+	w := &cmdWatcher{
+		s:        s,
+		cmd:      c,
+		debounce: watch.Debounce,
+	}
+	if w.debounce <= 0 {
+		w.debounce = defaultWatchDebounce
+	}
+	for _, p := range watch.Paths {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(c.StartWd(), p)
+		}
+		w.patterns = append(w.patterns, filepath.Clean(p))
+	}
+	var err error
+	w.fs, err = newFsWatcher(w.changed)
+	if err != nil {
+		return nil, err
+	}
+	watched := 0
+	for _, p := range w.patterns {
+		for _, dir := range watchDirs(p) {
+			err = w.fs.Add(dir)
+			if err == nil {
+				watched++
+			}
+		}
+	}
+	if watched == 0 {
+		w.fs.Close()
+		if err == nil {
+			err = fmt.Errorf("nothing to watch in %v", watch.Paths)
+		}
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *cmdWatcher) changed(path string) {
+	if !w.matches(path) {
+		return
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.done {
+		return
+	}
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.timer = time.AfterFunc(w.debounce, w.rerun)
+}
+
+func (w *cmdWatcher) Close() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.done = true
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.fs.Close()
+}
+
+func (w *cmdWatcher) rerun() {
+	w.lock.Lock()
+	if w.done {
+		w.lock.Unlock()
+		return
+	}
+	// no more changes while we're at it, the rerun sees them anyway
+	w.done = true
+	w.lock.Unlock()
+	s := w.s
+	c := w.cmd
+	id := c.Id()
+	if c.Status().Exited() == nil {
+		err := wseventStop(s, fmt.Sprint(id))
+		// exiting by itself in the meantime is just as good
+		if err != nil && c.Status().Exited() == nil {
+			log.Printf("Watch failed to stop command %d: %v", id, err)
+			s.unwatch(id)
+			return
+		}
+		c.Wait()
+	}
+	clone, err := rerunCmd(s, id)
+	// the clone gets a watcher of its own when it starts
+	s.unwatch(id)
+	if err != nil {
+		log.Printf("Watch failed to rerun command %d: %v", id, err)
+		return
+	}
+	err = wseventRelease(s, fmt.Sprint(id))
+	if err != nil {
+		log.Printf("Watch failed to release previous run %d: %v", id, err)
+	}
+	clone.Start()
+}
+
+// (re)start or stop watching the files of a command according to its watch.
+// only started commands are watched.
+func (s *server) updateWatch(c liblush.Cmd) {
+	s.unwatch(c.Id())
+	watch := c.Watch()
+	if watch == nil || c.Status().Started() == nil {
+		return
+	}
+	w, err := newCmdWatcher(s, c, watch)
+	if err != nil {
+		log.Printf("Failed to watch files of command %d: %v", c.Id(), err)
+		return
+	}
+	s.watchlock.Lock()
+	defer s.watchlock.Unlock()
+	if old := s.watchers[c.Id()]; old != nil {
+		// raced with another update
+		old.Close()
+	}
+	s.watchers[c.Id()] = w
+}
+
+func (s *server) unwatch(id liblush.CmdId) {
+	s.watchlock.Lock()
+	defer s.watchlock.Unlock()
+	if w := s.watchers[id]; w != nil {
+		w.Close()
+		delete(s.watchers, id)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright © 2013 - 2016 Hraban Luyat <hraban@0brg.net>
+//
+// This source code is licensed under the AGPLv3. Details in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hraban/lush/liblush"
+)
+
+// id of the command being watched, 0 if none. fatal if more than one.
+func watchedCmd(t *testing.T, s *server) liblush.CmdId {
+	s.watchlock.Lock()
+	defer s.watchlock.Unlock()
+	if len(s.watchers) > 1 {
+		t.Fatalf("Expected at most one watcher, got %d", len(s.watchers))
+	}
+	for id := range s.watchers {
+		return id
+	}
+	return 0
+}
+
+// change a file and wait for the watched command c to be replaced by a new
+// run, which is returned
+func waitRerun(t *testing.T, s *server, c liblush.Cmd, fname string) liblush.Cmd {
+	ioutil.WriteFile(fname, []byte("x"), 0600)
+	deadline := time.Now().Add(5 * time.Second)
+	var id liblush.CmdId
+	for {
+		id = watchedCmd(t, s)
+		if id != 0 && id != c.Id() {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Command wasn't rerun")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if c.Status().Exited() == nil {
+		t.Error("Expected the previous run to be stopped")
+	}
+	if s.session.GetCommand(c.Id()) != nil {
+		t.Error("Expected the previous run to be released")
+	}
+	c2 := s.session.GetCommand(id)
+	if c2 == nil {
+		t.Fatalf("Rerun %d isn't in the session", id)
+	}
+	if c2.Status().Started() == nil || c2.Status().Exited() != nil {
+		t.Error("Expected the rerun to be running")
+	}
+	return c2
+}
+
+func TestWatch(t *testing.T) {
+	if _, err := exec.LookPath("cat"); err != nil {
+		t.Skip("no cat in PATH")
+	}
+	dir, err := ioutil.TempDir("", "lush-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := newServer()
+	c, err := newCmd(s, fmt.Sprintf(`{"cmd": "cat", "watch": {"paths": [%q], "debounce": 0.05}}`,
+		filepath.Join(dir, "*.txt")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err := metacmd{c}.Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Watch == nil || len(md.Watch.Paths) != 1 || md.Watch.Debounce != 0.05 {
+		t.Errorf("Unexpected watch in metadata: %#v", md.Watch)
+	}
+	if watchedCmd(t, s) != 0 {
+		t.Error("Watching before the command started")
+	}
+	err = c.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if watchedCmd(t, s) != c.Id() {
+		t.Fatalf("Expected command %d to be watched", c.Id())
+	}
+	// not a match
+	ioutil.WriteFile(filepath.Join(dir, "foo.log"), []byte("x"), 0600)
+	time.Sleep(300 * time.Millisecond)
+	if c.Status().Exited() != nil || watchedCmd(t, s) != c.Id() {
+		t.Fatal("Command was rerun for a file that doesn't match")
+	}
+	c2 := waitRerun(t, s, c, filepath.Join(dir, "foo.txt"))
+	if w := c2.Watch(); w == nil || w.Debounce != 50*time.Millisecond {
+		t.Errorf("Expected the rerun to inherit the watch, got %#v", w)
+	}
+	// every run replaces the previous one
+	c2 = waitRerun(t, s, c2, filepath.Join(dir, "bar.txt"))
+	if ids := s.session.GetCommandIds(); len(ids) != 1 || ids[0] != c2.Id() {
+		t.Errorf("Expected only the last run in the session, got %v", ids)
+	}
+	id := c2.Id()
+	// turning it off
+	err = wseventUpdatecmd(s, fmt.Sprintf(`{"nid": %d, "watch": {"paths": []}}`, id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if watchedCmd(t, s) != 0 || c2.Watch() != nil {
+		t.Error("Still watching after removing the watch")
+	}
+	c2.Stdin().Close()
+	c2.Wait()
+}
@@ -8,13 +8,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"log"
 	"net/http"
 	"net/url"
-	"os"
 	"path/filepath"
 	"regexp"
-	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -39,17 +37,23 @@ func remoteAddr(ctx *web.Context) string {
 
 // claim that I am master. returns false if someone else already did
 func claimMaster(ctx *web.Context) bool {
-	if ctx.User.(*server).everybodyMaster {
-		return true
-	}
-	remote := remoteAddr(ctx)
-	if remote != masterAddr {
-		if masterAddr == "" {
-			masterAddr = remote
-		} else {
-			return false
+	s := ctx.User.(*server)
+	if !s.everybodyMaster {
+		remote := remoteAddr(ctx)
+		if remote != masterAddr {
+			if masterAddr == "" {
+				masterAddr = remote
+			} else {
+				return false
+			}
 		}
 	}
+	// commands run as the master's account so there can only be one
+	err := s.bindAccount(ctx.Request)
+	if err != nil {
+		log.Printf("Refusing master to %s: %v", remoteAddr(ctx), err)
+		return false
+	}
 	return true
 }
 
@@ -158,23 +162,73 @@ func handleGetNewNames(ctx *web.Context) error {
 	if err := errorIfNotMaster(ctx); err != nil {
 		return err
 	}
-	var bins []string
-	term := ctx.Params["term"]
-	for _, d := range strings.Split(os.Getenv("PATH"), string(os.PathListSeparator)) {
-		fis, err := ioutil.ReadDir(d)
+	s := ctx.User.(*server)
+	bins := s.execIndex.Complete(getPath(), ctx.Params["term"])
+	enc := json.NewEncoder(ctx)
+	err := enc.Encode(bins)
+	return err
+}
+
+// Completions for the last word of a command line, best first, eg:
+//
+//     GET /complete.json?line=git%20che
+//
+//     [{"text":"checkout","type":"subcommand"},{"text":"cherry","type":"subcommand"},...]
+//
+// optional limit parameter caps the number of results.
+func handleGetComplete(ctx *web.Context) error {
+	if err := errorIfNotMaster(ctx); err != nil {
+		return err
+	}
+	s := ctx.User.(*server)
+	comps := complete(s, ctx.Params["line"])
+	if l := ctx.Params["limit"]; l != "" {
+		var limit int
+		_, err := fmt.Sscan(l, &limit)
 		if err != nil {
-			// ignore unreadable dirs
-			continue
+			return web.WebError{400, "invalid limit: " + l}
 		}
-		for _, fi := range fis {
-			name := fi.Name()
-			if strings.HasPrefix(name, term) {
-				bins = append(bins, fi.Name())
-			}
+		if limit > 0 && len(comps) > limit {
+			comps = comps[:limit]
 		}
 	}
-	enc := json.NewEncoder(ctx)
-	err := enc.Encode(bins)
+	ctx.ContentType("json")
+	return json.NewEncoder(ctx).Encode(comps)
+}
+
+// ?q=...&mode=prefix|substring&limit=N, see history.Search
+func handleGetHistory(ctx *web.Context) error {
+	if err := errorIfNotMaster(ctx); err != nil {
+		return err
+	}
+	s := ctx.User.(*server)
+	var limit int
+	if l := ctx.Params["limit"]; l != "" {
+		_, err := fmt.Sscan(l, &limit)
+		if err != nil {
+			return web.WebError{400, "invalid limit: " + l}
+		}
+	}
+	entries, err := s.history.Search(ctx.Params["q"], ctx.Params["mode"], limit)
+	if err != nil {
+		return web.WebError{400, err.Error()}
+	}
+	ctx.ContentType("json")
+	return json.NewEncoder(ctx).Encode(entries)
+}
+
+func handlePostDeleteHistory(ctx *web.Context, idstr string) error {
+	if err := errorIfNotMaster(ctx); err != nil {
+		return err
+	}
+	s := ctx.User.(*server)
+	var id int64
+	fmt.Sscan(idstr, &id)
+	err := s.history.Delete(id)
+	if err != nil {
+		return web.WebError{404, err.Error()}
+	}
+	_, err = fmt.Fprintf(&s.ctrlclients, "history_deleted;%d", id)
 	return err
 }
 
@@ -251,6 +305,10 @@ func handleWsCtrl(ctx *web.Context) error {
 	wseventAllclients(s, "") // pretend somebody generated this event
 	// TODO: keep clients updated about disconnects, too
 	ws.isMaster = claimMaster(ctx)
+	// the first client gets to hear what went wrong loading the rc file
+	for _, msg := range s.takeRcErrors() {
+		writePrefixedJson(ws, "error;", "rc file: "+msg)
+	}
 	for {
 		msg, err := ws.ReadTextMessage()
 		if err != nil {
@@ -304,9 +362,12 @@ func init() {
 		s.web.Post(`/(\d+)/send`, handlePostSend)
 		s.web.Post(`/(\d+)/close`, handlePostClose)
 		s.web.Get(`/new/names.json`, handleGetNewNames)
+		s.web.Get(`/complete.json`, handleGetComplete)
 		s.web.Get(`/files.json`, handleGetFiles)
 		s.web.Get(`/environ.json`, handleGetEnviron)
 		s.web.Post(`/setenv`, handlePostSetenv)
 		s.web.Post(`/unsetenv`, handlePostUnsetenv)
+		s.web.Get(`/history.json`, handleGetHistory)
+		s.web.Post(`/history/(\d+)/delete`, handlePostDeleteHistory)
 	})
 }
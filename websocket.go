@@ -16,10 +16,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"os/user"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -32,11 +32,15 @@ type wsClient struct {
 	Id       uint32
 	isMaster bool
 	*websocket.Conn
+	// the connection allows only one writer at a time, and broadcasts come
+	// from timers and exiting commands as well as handlers
+	writelock sync.Mutex
 }
 
-// Write a message to this websocket client. Safety for concurrent use is
-// undefined.
+// Write a message to this websocket client. Safe for concurrent use.
 func (ws *wsClient) Write(data []byte) (int, error) {
+	ws.writelock.Lock()
+	defer ws.writelock.Unlock()
 	return len(data), ws.WriteMessage(websocket.TextMessage, data)
 }
 
@@ -57,7 +61,7 @@ var totalWsClients uint32
 func newWsClient(conn *websocket.Conn) *wsClient {
 	// Assign a (session-local) unique ID to this connection
 	id := atomic.AddUint32(&totalWsClients, 1)
-	return &wsClient{id, false, conn}
+	return &wsClient{Id: id, Conn: conn}
 }
 
 func getCmd(s *server, idstr string) (liblush.Cmd, error) {
@@ -72,6 +76,14 @@ func getCmd(s *server, idstr string) (liblush.Cmd, error) {
 
 // subscribe all websocket clients to stream data
 // eg subscribe;3;stdout
+//
+// every client receives the data once, no matter how many of them subscribed:
+// subscribing again is a no-op.
+//
+// data is sent as stream;3;stdout;... events. if the stream is in record mode
+// every JSON record is also sent separately, eg:
+//
+//     record;3;stdout;{"name":"foo","size":123}
 func wseventSubscribe(s *server, options string) error {
 	args := strings.Split(options, ";")
 	if len(args) != 2 {
@@ -92,11 +104,22 @@ func wseventSubscribe(s *server, options string) error {
 	default:
 		return errors.New("unknown stream: " + streamname)
 	}
+	s.subscribelock.Lock()
+	defer s.subscribelock.Unlock()
+	if s.subscriptions[c.Id()][streamname] {
+		return nil
+	}
+	if s.subscriptions[c.Id()] == nil {
+		s.subscriptions[c.Id()] = map[string]bool{}
+	}
+	s.subscriptions[c.Id()][streamname] = true
 	// proxy stream data
 	w := newPrefixedWriter(&s.ctrlclients, []byte("stream;"+idstr+";"+streamname+";"))
 	// do not close websocket stream when command exits
 	wc := newNopWriteCloser(w)
 	stream.Peeker().AddWriter(wc)
+	w = newPrefixedWriter(&s.ctrlclients, []byte("record;"+idstr+";"+streamname+";"))
+	stream.RecordPeeker().AddWriter(newNopWriteCloser(w))
 	return nil
 }
 
@@ -107,9 +130,40 @@ type cmdOptions struct {
 	Args             []string
 	StdoutScrollback int
 	StderrScrollback int
-	UserData         interface{}
-	Stdoutto         liblush.CmdId
-	Stderrto         liblush.CmdId
+	// keep this many lines (within the above bytes) rather than bytes, 0 for
+	// bytes. see liblush.LineBuffer
+	StdoutScrollbackLines int
+	StderrScrollbackLines int
+	// streams emit JSON records, see liblush.OutStream.RecordMode
+	StdoutRecords bool
+	StderrRecords bool
+	UserData      interface{}
+	Stdoutto      liblush.CmdId
+	Stderrto      liblush.CmdId
+	// successors, see liblush.ChainCondition
+	Onexit, Onsuccess, Onfailure liblush.CmdId
+	// in seconds, 0 for none
+	Timeout      float64
+	StopSequence []stopStepJson
+	Limits       *limitsJson
+	// by index in [cmd, args...]: don't expand, see liblush/expand.go
+	Literal []bool
+	// expand args at all, see liblush.Cmd.SetExpand
+	Expand bool
+	// rerun when these files change, see watch.go
+	Watch *watchJson
+	// see triggers.go
+	Triggers []triggerJson
+}
+
+// JSON encoding of liblush.Limits
+type limitsJson struct {
+	AddressSpace uint64  `json:"addressspace,omitempty"`
+	CPUTime      uint64  `json:"cputime,omitempty"`
+	OpenFiles    uint64  `json:"openfiles,omitempty"`
+	Nice         int     `json:"nice,omitempty"`
+	Memory       uint64  `json:"memory,omitempty"`
+	CPUs         float64 `json:"cpus,omitempty"`
 }
 
 func cmdId2Json(id liblush.CmdId) string {
@@ -118,19 +172,96 @@ func cmdId2Json(id liblush.CmdId) string {
 
 // eg new;{"cmd":"echo","args":["arg1","arg2"],...}
 func wseventNew(s *server, optionsJSON string) error {
+	_, err := newCmd(s, optionsJSON)
+	return err
+}
+
+// create a command from the options of a new event and announce it
+func newCmd(s *server, optionsJSON string) (liblush.Cmd, error) {
 	var options cmdOptions
 	err := json.Unmarshal([]byte(optionsJSON), &options)
 	if err != nil {
-		return fmt.Errorf("malformed JSON: %v", err)
+		return nil, fmt.Errorf("malformed JSON: %v", err)
+	}
+	if options.Cmd == "" {
+		return nil, lushError{errors.New("no command given")}
+	}
+	// validate everything before creating the command: a command that is
+	// never announced would linger in the session unseen
+	triggers, err := parseTriggers(options.Triggers)
+	if err != nil {
+		return nil, lushError{fmt.Errorf("Invalid trigger: %v", err)}
+	}
+	var seq []liblush.StopStep
+	if options.StopSequence != nil {
+		seq, err = parseStopSequence(options.StopSequence)
+		if err != nil {
+			return nil, lushError{fmt.Errorf("Invalid stop sequence: %v", err)}
+		}
+	}
+	// in a fixed order, not that of a map
+	chains := []struct {
+		cond liblush.ChainCondition
+		id   liblush.CmdId
+	}{
+		{liblush.OnExit, options.Onexit},
+		{liblush.OnSuccess, options.Onsuccess},
+		{liblush.OnFailure, options.Onfailure},
+	}
+	for _, chain := range chains {
+		if chain.id != 0 && s.session.GetCommand(chain.id) == nil {
+			return nil, errors.New("unknown command in to")
+		}
 	}
 	c := s.session.NewCommand(options.Cmd, options.Args...)
 	c.Stdout().SetListener(liblush.Devnull)
 	c.Stderr().SetListener(liblush.Devnull)
+	// parse as raw map to lookup which keys were specified
+	var cm map[string]interface{}
+	json.Unmarshal([]byte(optionsJSON), &cm)
+	if cm["stdoutScrollback"] == nil {
+		options.StdoutScrollback = s.stdoutScrollback
+	}
+	if cm["stderrScrollback"] == nil {
+		options.StderrScrollback = s.stderrScrollback
+	}
 	c.Stdout().Scrollback().Resize(options.StdoutScrollback)
 	c.Stderr().Scrollback().Resize(options.StderrScrollback)
+	c.Stdout().SetScrollbackLines(options.StdoutScrollbackLines)
+	c.Stderr().SetScrollbackLines(options.StderrScrollbackLines)
+	c.Stdout().SetRecordMode(options.StdoutRecords)
+	c.Stderr().SetRecordMode(options.StderrRecords)
+	// can't fail on a fresh command
+	c.SetLiteralArgs(options.Literal)
+	c.SetExpand(options.Expand)
 	c.SetName(options.Name)
 	c.SetUserData(options.UserData)
-	// broadcast newcmd message to all connected websocket clients
+	c.SetTimeout(seconds2duration(options.Timeout))
+	c.SetWatch(json2watch(options.Watch))
+	c.SetTriggers(triggers)
+	if seq != nil {
+		c.SetStopSequence(seq)
+	}
+	if options.Limits != nil {
+		// can't fail on a fresh command
+		c.SetLimits(liblush.Limits(*options.Limits))
+	}
+	for _, chain := range chains {
+		if chain.id != 0 {
+			err = chainCmdsById(s, c.Id(), chain.id, chain.cond)
+			if err != nil {
+				// the target was released in the meantime
+				s.session.ReleaseCommand(c.Id())
+				return nil, err
+			}
+		}
+	}
+	return c, announceNewCmd(s, c)
+}
+
+// broadcast a newcmd message for this command to all connected websocket
+// clients and keep them informed about its status from now on
+func announceNewCmd(s *server, c liblush.Cmd) error {
 	w := newPrefixedWriter(&s.ctrlclients, []byte("newcmd;"))
 	md, err := metacmd{c}.Metadata()
 	if err != nil {
@@ -150,6 +281,18 @@ func wseventNew(s *server, optionsJSON string) error {
 			Value:    jsonstatus,
 		})
 	})
+	addHooks(s, c)
+	// keep a record of every command line that runs
+	var histid int64
+	c.Status().NotifyChange(func(status liblush.CmdStatus) error {
+		switch {
+		case status.Exited() != nil && histid != 0:
+			s.history.Finish(histid, *status.Exited(), cmdstatus2json(status))
+		case status.Started() != nil && histid == 0:
+			histid = s.history.Add(c.Argv(), c.StartWd(), *status.Started())
+		}
+		return nil
+	})
 	// Starting a command changes its StartWd if none was explicitly set (which
 	// is always because SetStartWd is not implemented yet). There are better
 	// places to handle this, but this is already pretty good.
@@ -164,9 +307,86 @@ func wseventNew(s *server, optionsJSON string) error {
 		}
 		return nil
 	})
+	// as is the expanded argv
+	c.Status().NotifyChange(func(status liblush.CmdStatus) error {
+		if status.Started() != nil && status.Exited() == nil {
+			return notifyPropertyUpdate(&s.ctrlclients, getPropResponse{
+				Objname:  cmdId2Json(c.Id()),
+				Propname: "expandedArgv",
+				Value:    c.ExpandedArgv(),
+			})
+		}
+		return nil
+	})
+	announceTriggers(s, c)
+	// watch mode starts when the command does
+	watching := false
+	c.Status().NotifyChange(func(status liblush.CmdStatus) error {
+		if status.Started() != nil && !watching {
+			watching = true
+			s.updateWatch(c)
+		}
+		return nil
+	})
 	return nil
 }
 
+// create a fresh copy of a command (see Session.CloneCommand) and announce it
+// like any new command. the copy is not started.
+//
+//     rerun;3
+//
+// followed by the usual newcmd event for the copy, and:
+//
+//     rerun;{"from":3,"to":8}
+func wseventRerun(s *server, idstr string) error {
+	id, err := liblush.ParseCmdId(idstr)
+	if err != nil {
+		return lushError{fmt.Errorf("Couldn't rerun command %q: %v", idstr, err)}
+	}
+	_, err = rerunCmd(s, id)
+	return err
+}
+
+// clone a command and announce the clone with a rerun event
+func rerunCmd(s *server, id liblush.CmdId) (liblush.Cmd, error) {
+	c, err := s.session.CloneCommand(id)
+	if err != nil {
+		return nil, lushError{fmt.Errorf("Couldn't rerun command: %v", err)}
+	}
+	err = announceNewCmd(s, c)
+	if err != nil {
+		return nil, err
+	}
+	return c, writePrefixedJson(&s.ctrlclients, "rerun;", map[string]liblush.CmdId{
+		"from": id,
+		"to":   c.Id(),
+	})
+}
+
+// resource limits of all commands created from now on. eg:
+//
+//     setlimits;{"openfiles":1024,"cputime":3600}
+//
+// is broadcast to all clients as:
+//
+//     limits;{"openfiles":1024,"cputime":3600}
+func wseventSetlimits(s *server, limitsJSON string) error {
+	var limits limitsJson
+	err := json.Unmarshal([]byte(limitsJSON), &limits)
+	if err != nil {
+		return fmt.Errorf("malformed JSON: %v", err)
+	}
+	s.session.SetDefaultLimits(liblush.Limits(limits))
+	return wseventGetlimits(s, "")
+}
+
+// eg getlimits;
+func wseventGetlimits(s *server, _ string) error {
+	return writePrefixedJson(&s.ctrlclients, "limits;",
+		limitsJson(s.session.DefaultLimits()))
+}
+
 // eg setpath;["c:\foo\bar\bin", "c:\bin"]
 func wseventSetpath(s *server, pathJSON string) error {
 	var path []string
@@ -207,6 +427,47 @@ func wseventUpdatecmd(s *server, cmdmetaJSON string) error {
 	// parse as raw map to lookup which keys were specified
 	var cm map[string]interface{}
 	json.Unmarshal(jsonbytes, &cm)
+	// validate everything before changing anything: failing halfway would
+	// leave part of the update applied, and unannounced
+	var triggers []liblush.Trigger
+	if cm["triggers"] != nil {
+		triggers, err = parseTriggers(options.Triggers)
+		if err != nil {
+			return lushError{fmt.Errorf("Invalid trigger: %v", err)}
+		}
+	}
+	var seq []liblush.StopStep
+	if cm["stopSequence"] != nil {
+		seq, err = parseStopSequence(options.StopSequence)
+		if err != nil {
+			return lushError{fmt.Errorf("Invalid stop sequence: %v", err)}
+		}
+	}
+	if st := c.Status(); st.Started() != nil || st.Err() != nil {
+		for _, name := range []string{"cmd", "args", "literal", "expand", "limits"} {
+			if cm[name] != nil {
+				return lushError{fmt.Errorf("cannot change %s after command has started", name)}
+			}
+		}
+	}
+	for _, chain := range []struct {
+		name string
+		id   liblush.CmdId
+	}{
+		{"onexit", options.Onexit},
+		{"onsuccess", options.Onsuccess},
+		{"onfailure", options.Onfailure},
+	} {
+		if cm[chain.name] == nil || chain.id == 0 {
+			continue
+		}
+		if chain.id == options.Id {
+			return errors.New("a command cannot succeed itself")
+		}
+		if s.session.GetCommand(chain.id) == nil {
+			return errors.New("unknown command in to")
+		}
+	}
 	// update every key that was specified in the update object
 	if cm["stdoutScrollback"] != nil {
 		c.Stdout().Scrollback().Resize(options.StdoutScrollback)
@@ -214,12 +475,47 @@ func wseventUpdatecmd(s *server, cmdmetaJSON string) error {
 	if cm["stderrScrollback"] != nil {
 		c.Stderr().Scrollback().Resize(options.StderrScrollback)
 	}
+	if cm["stdoutScrollbackLines"] != nil {
+		c.Stdout().SetScrollbackLines(options.StdoutScrollbackLines)
+	}
+	if cm["stderrScrollbackLines"] != nil {
+		c.Stderr().SetScrollbackLines(options.StderrScrollbackLines)
+	}
+	if cm["stdoutRecords"] != nil {
+		c.Stdout().SetRecordMode(options.StdoutRecords)
+	}
+	if cm["stderrRecords"] != nil {
+		c.Stderr().SetRecordMode(options.StderrRecords)
+	}
 	if cm["name"] != nil {
 		c.SetName(options.Name)
 	}
 	if cm["userdata"] != nil {
 		c.SetUserData(options.UserData)
 	}
+	if cm["timeout"] != nil {
+		c.SetTimeout(seconds2duration(options.Timeout))
+	}
+	if cm["watch"] != nil {
+		c.SetWatch(json2watch(options.Watch))
+		s.updateWatch(c)
+	}
+	if cm["triggers"] != nil {
+		c.SetTriggers(triggers)
+	}
+	if cm["stopSequence"] != nil {
+		c.SetStopSequence(seq)
+	}
+	if cm["limits"] != nil {
+		var limits limitsJson
+		if options.Limits != nil {
+			limits = *options.Limits
+		}
+		err := c.SetLimits(liblush.Limits(limits))
+		if err != nil {
+			return lushError{err}
+		}
+	}
 	if cm["cmd"] != nil {
 		argv := c.Argv()
 		argv[0] = options.Cmd
@@ -235,12 +531,42 @@ func wseventUpdatecmd(s *server, cmdmetaJSON string) error {
 			return fmt.Errorf("failed to update args: %v", err)
 		}
 	}
+	if cm["literal"] != nil {
+		err := c.SetLiteralArgs(options.Literal)
+		if err != nil {
+			return fmt.Errorf("failed to update literal args: %v", err)
+		}
+	}
+	if cm["expand"] != nil {
+		err := c.SetExpand(options.Expand)
+		if err != nil {
+			return fmt.Errorf("failed to update expand: %v", err)
+		}
+	}
 	if cm["stdoutto"] != nil {
 		connectCmdsById(s, options.Id, options.Stdoutto, "stdout")
 	}
 	if cm["stderrto"] != nil {
 		connectCmdsById(s, options.Id, options.Stderrto, "stderr")
 	}
+	if cm["onexit"] != nil {
+		err := chainCmdsById(s, options.Id, options.Onexit, liblush.OnExit)
+		if err != nil {
+			return err
+		}
+	}
+	if cm["onsuccess"] != nil {
+		err := chainCmdsById(s, options.Id, options.Onsuccess, liblush.OnSuccess)
+		if err != nil {
+			return err
+		}
+	}
+	if cm["onfailure"] != nil {
+		err := chainCmdsById(s, options.Id, options.Onfailure, liblush.OnFailure)
+		if err != nil {
+			return err
+		}
+	}
 	// obsolete:
 	// broadcast command update to all connected websocket clients
 	//w := newPrefixedWriter(&s.ctrlclients, []byte("updatecmd;"))
@@ -350,6 +676,35 @@ func disconnectStream(stream liblush.OutStream) error {
 	return nil
 }
 
+// names of the successor properties, by condition
+var chainPropnames = map[string]liblush.ChainCondition{
+	"onexit":    liblush.OnExit,
+	"onsuccess": liblush.OnSuccess,
+	"onfailure": liblush.OnFailure,
+}
+
+// start command toId automatically when fromId exits under condition cond.
+// toId 0 clears the successor.
+func chainCmdsById(s *server, fromId, toId liblush.CmdId, cond liblush.ChainCondition) error {
+	from := s.session.GetCommand(fromId)
+	if from == nil {
+		return errors.New("unknown command in from")
+	}
+	if toId == 0 {
+		from.SetSuccessor(cond, nil)
+		return nil
+	}
+	to := s.session.GetCommand(toId)
+	if to == nil {
+		return errors.New("unknown command in to")
+	}
+	if to == from {
+		return errors.New("a command cannot succeed itself")
+	}
+	from.SetSuccessor(cond, to)
+	return nil
+}
+
 // start a command
 // eg start;3
 func wseventStart(s *server, idstr string) error {
@@ -383,22 +738,63 @@ func wseventStart(s *server, idstr string) error {
 	return nil
 }
 
-// kill a running command
+// stop a running command by walking through its stop sequence
 // eg stop;3
+//
+// every signal sent is reported to all clients, eg:
+//
+//     stopping;{"nid":3,"signal":"SIGTERM","err":""}
 func wseventStop(s *server, idstr string) error {
 	c, err := getCmd(s, idstr)
 	if err != nil {
 		return err
 	}
-	err = c.Signal(StopSignal)
+	err = c.Stop(func(step liblush.StopStep, err error) {
+		var errstr string
+		if err != nil {
+			errstr = err.Error()
+		}
+		writePrefixedJson(&s.ctrlclients, "stopping;", stopProgressJson{
+			Id:     c.Id(),
+			Signal: signalName(step.Signal),
+			ErrStr: errstr,
+		})
+	})
 	if err != nil {
-		// TODO: what to do with this error?
-		log.Println("Error sending signal:", err)
+		return lushError{fmt.Errorf("Couldn't stop command %d: %v", c.Id(), err)}
 	}
 	// status update will be sent to subscribed clients automatically
 	return nil
 }
 
+// send a signal (see signalsByName) to a running command
+// eg signal;3;SIGINT
+func wseventSignal(s *server, options string) error {
+	args := strings.Split(options, ";")
+	if len(args) != 2 {
+		return errors.New("signal requires 2 args")
+	}
+	c, err := getCmd(s, args[0])
+	if err != nil {
+		return err
+	}
+	sig, err := parseSignal(args[1])
+	if err != nil {
+		return lushError{err}
+	}
+	err = c.Signal(sig)
+	if err != nil {
+		return lushError{fmt.Errorf("Couldn't signal command %d: %v", c.Id(), err)}
+	}
+	return nil
+}
+
+type stopProgressJson struct {
+	Id     liblush.CmdId `json:"nid"`
+	Signal string        `json:"signal"`
+	ErrStr string        `json:"err"`
+}
+
 // free resources associated with a command. eg:
 //
 //     release;3
@@ -414,10 +810,105 @@ func wseventRelease(s *server, idstr string) error {
 	if err != nil {
 		return err
 	}
+	s.unwatch(id)
+	s.subscribelock.Lock()
+	delete(s.subscriptions, id)
+	s.subscribelock.Unlock()
 	_, err = fmt.Fprintf(&s.ctrlclients, "cmd_released;%s", idstr)
 	return err
 }
 
+// search the history for command lines matching q (see history.Search for
+// the modes). all fields are optional, the default lists everything.
+//
+//     gethistory;{"q":"git ","mode":"prefix","limit":20}
+//
+// results, most recent first, are sent as a history event:
+//
+//     history;[{"id":12,"argv":["git","status"],"cwd":"/home/hraban/lush",...},...]
+func wseventGethistory(s *server, optionsJSON string) error {
+	var options struct {
+		Q     string
+		Mode  string
+		Limit int
+	}
+	if optionsJSON != "" {
+		err := json.Unmarshal([]byte(optionsJSON), &options)
+		if err != nil {
+			return fmt.Errorf("malformed JSON: %v", err)
+		}
+	}
+	entries, err := s.history.Search(options.Q, options.Mode, options.Limit)
+	if err != nil {
+		return lushError{err}
+	}
+	return writePrefixedJson(&s.ctrlclients, "history;", entries)
+}
+
+// remove an entry from the history. generates a history_deleted event:
+//
+//     delhistory;12
+//     history_deleted;12
+func wseventDelhistory(s *server, idstr string) error {
+	var id int64
+	_, err := fmt.Sscan(idstr, &id)
+	if err != nil {
+		return fmt.Errorf("invalid history id: %q", idstr)
+	}
+	err = s.history.Delete(id)
+	if err != nil {
+		return lushError{err}
+	}
+	_, err = fmt.Fprintf(&s.ctrlclients, "history_deleted;%d", id)
+	return err
+}
+
+type aliasJson struct {
+	Name     string   `json:"name"`
+	Template []string `json:"template"`
+}
+
+// define (or redefine) an alias, see liblush/alias.go for the template
+// syntax. generates an alias event with the same payload:
+//
+//     setalias;{"name":"gco","template":["git","checkout","$1"]}
+//     alias;{"name":"gco","template":["git","checkout","$1"]}
+func wseventSetalias(s *server, aliasJSON string) error {
+	var a aliasJson
+	err := json.Unmarshal([]byte(aliasJSON), &a)
+	if err != nil {
+		return fmt.Errorf("malformed JSON: %v", err)
+	}
+	err = s.session.SetAlias(a.Name, a.Template)
+	if err != nil {
+		return lushError{err}
+	}
+	s.saveAliases()
+	return writePrefixedJson(&s.ctrlclients, "alias;", a)
+}
+
+// all aliases by name:
+//
+//     getaliases;
+//     aliases;{"gco":["git","checkout","$1"],"ll":["ls","-l"]}
+func wseventGetaliases(s *server, _ string) error {
+	return writePrefixedJson(&s.ctrlclients, "aliases;", s.session.Aliases())
+}
+
+// remove an alias. generates an alias_deleted event:
+//
+//     delalias;gco
+//     alias_deleted;gco
+func wseventDelalias(s *server, name string) error {
+	if _, ok := s.session.Aliases()[name]; !ok {
+		return lushError{fmt.Errorf("no such alias: %q", name)}
+	}
+	s.session.UnsetAlias(name)
+	s.saveAliases()
+	_, err := fmt.Fprintf(&s.ctrlclients, "alias_deleted;%s", name)
+	return err
+}
+
 // first write the given prefix to w, then serialize jsonobj to JSON and write
 // it to w as well. Ensures that w is only written to once, and only if
 // serialization succeeded.
@@ -461,6 +952,79 @@ type setPropResponse getPropResponse
 type delPropRequest getPropRequest
 type delPropResponse getPropRequest
 
+// value of a command property by its name in getprop
+func cmdProp(c liblush.Cmd, propname string) (interface{}, error) {
+	switch propname {
+	case "name":
+		return c.Name(), nil
+	case "cmd":
+		return c.Argv()[0], nil
+	case "args":
+		return c.Argv()[1:], nil
+	case "literal":
+		return c.LiteralArgs(), nil
+	case "expand":
+		return c.Expand(), nil
+	case "expandedArgv":
+		return c.ExpandedArgv(), nil
+	case "cwd":
+		cwd, err := c.Cwd()
+		// TODO: This is not a client error, it should not disconnect the
+		// client but just inform it of a server-side problem
+		if err != nil {
+			return nil, fmt.Errorf("Error getting working directory: %v", err)
+		}
+		return cwd, nil
+	case "startwd":
+		return c.StartWd(), nil
+	case "status":
+		return cmdstatus2json(c.Status()), nil
+	case "userdata":
+		return c.UserData(), nil
+	case "timeout":
+		return c.Timeout().Seconds(), nil
+	case "watch":
+		return watch2json(c.Watch()), nil
+	case "triggers":
+		return triggers2json(c.Triggers()), nil
+	case "triggermatches":
+		return triggerMatches2json(c.TriggerMatches()), nil
+	case "stopSequence":
+		return stopSequence2json(c.StopSequence()), nil
+	case "limits":
+		return limitsJson(c.Limits()), nil
+	case "sandbox":
+		return sandbox2json(c.Sandbox()), nil
+	case "stdoutScrollback":
+		return c.Stdout().Scrollback().Size(), nil
+	case "stderrScrollback":
+		return c.Stderr().Scrollback().Size(), nil
+	case "stdoutScrollbackLines":
+		return c.Stdout().ScrollbackLines(), nil
+	case "stderrScrollbackLines":
+		return c.Stderr().ScrollbackLines(), nil
+	case "stdoutRecords":
+		return c.Stdout().RecordMode(), nil
+	case "stderrRecords":
+		return c.Stderr().RecordMode(), nil
+	case "stdoutto":
+		if tocmd := pipedcmd(c.Stdout()); tocmd != nil {
+			return tocmd.Id(), nil
+		}
+	case "stderrto":
+		if tocmd := pipedcmd(c.Stderr()); tocmd != nil {
+			return tocmd.Id(), nil
+		}
+	case "onexit", "onsuccess", "onfailure":
+		if next := c.Successor(chainPropnames[propname]); next != nil {
+			return next.Id(), nil
+		}
+	default:
+		return nil, errors.New("Unknown command property name: " + propname)
+	}
+	return nil, nil
+}
+
 func wseventGetprop(s *server, reqstr string) error {
 	var r getPropResponse
 	var err error
@@ -475,40 +1039,9 @@ func wseventGetprop(s *server, reqstr string) error {
 		if err != nil {
 			return err
 		}
-		switch r.Propname {
-		case "name":
-			r.Value = c.Name()
-		case "cmd":
-			r.Value = c.Argv()[0]
-		case "args":
-			r.Value = c.Argv()[1:]
-		case "cwd":
-			r.Value, err = c.Cwd()
-			// TODO: This is not a client error, it should not disconnect the
-			// client but just inform it of a server-side problem
-			if err != nil {
-				return fmt.Errorf("Error getting working directory: %v", err)
-			}
-		case "startwd":
-			r.Value = c.StartWd()
-		case "status":
-			r.Value = cmdstatus2json(c.Status())
-		case "userdata":
-			r.Value = c.UserData()
-		case "stdoutScrollback":
-			r.Value = c.Stdout().Scrollback().Size()
-		case "stderrScrollback":
-			r.Value = c.Stderr().Scrollback().Size()
-		case "stdoutto":
-			if tocmd := pipedcmd(c.Stdout()); tocmd != nil {
-				r.Value = tocmd.Id()
-			}
-		case "stderrto":
-			if tocmd := pipedcmd(c.Stderr()); tocmd != nil {
-				r.Value = tocmd.Id()
-			}
-		default:
-			return errors.New("Unknown command property name: " + r.Propname)
+		r.Value, err = cmdProp(c, r.Propname)
+		if err != nil {
+			return err
 		}
 		return notifyPropertyUpdate(&s.ctrlclients, r)
 	}
@@ -569,6 +1102,9 @@ func wseventDelprop(s *server, reqstr string) error {
 					idstr, err)
 			}
 			break
+		case "onexit", "onsuccess", "onfailure":
+			c.SetSuccessor(chainPropnames[r.Propname], nil)
+			break
 		default:
 			return errors.New("delprop: unknown property: " + r.Propname)
 		}
@@ -589,10 +1125,13 @@ func wseventDelprop(s *server, reqstr string) error {
 func wseventAllclients(s *server, reqstr string) error {
 	clients := s.ctrlclients.Writers()
 	// yup. who needs map(), right?
-	ids := make([]uint32, len(clients))
+	ids := []uint32{}
 	// yeah. MUCH more readable. especially if you are new to Go.
-	for i, client := range clients {
-		ids[i] = client.(*wsClient).Id
+	for _, client := range clients {
+		// not everybody listening is a websocket client
+		if ws, ok := client.(*wsClient); ok {
+			ids = append(ids, ws.Id)
+		}
 	}
 	return writePrefixedJson(&s.ctrlclients, "allclients;", ids)
 }
@@ -603,6 +1142,9 @@ type lushError struct {
 }
 
 func wseventChdir(s *server, dir string) error {
+	if dir == "" && s.session.Account() != nil {
+		dir = s.session.Account().Home
+	}
 	if dir == "" {
 		user, err := user.Current()
 		if err != nil {
@@ -615,7 +1157,8 @@ func wseventChdir(s *server, dir string) error {
 	if err != nil {
 		return lushError{err}
 	}
-	return writePrefixedJson(&s.ctrlclients, "chdir;", dir)
+	// the chdir event is sent by the listener, see newServer
+	return nil
 }
 
 func wseventExit(s *server, _ string) error {
@@ -634,6 +1177,12 @@ var wsPublicHandlers = map[string]wsHandler{
 	"getuserdata": wseventGetuserdata,
 	"getprop":     wseventGetprop,
 	"allclients":  wseventAllclients,
+	"getlimits":   wseventGetlimits,
+	"getaliases":  wseventGetaliases,
+	"search":      wseventSearch,
+
+	// see schedule.go
+	"getschedules": wseventGetschedules,
 }
 
 // only master!
@@ -644,11 +1193,24 @@ var wsMasterHandlers = map[string]wsHandler{
 	"connect":     wseventConnect,
 	"start":       wseventStart,
 	"stop":        wseventStop,
+	"signal":      wseventSignal,
 	"release":     wseventRelease,
+	"rerun":       wseventRerun,
+	"setlimits":   wseventSetlimits,
+	"gethistory":  wseventGethistory,
+	"delhistory":  wseventDelhistory,
+	"setalias":    wseventSetalias,
+	"delalias":    wseventDelalias,
 	"setprop":     wseventSetprop,
 	"delprop":     wseventDelprop,
 	"chdir":       wseventChdir,
 	"exit":        wseventExit,
+
+	// see schedule.go
+	"addschedule":    wseventAddschedule,
+	"pauseschedule":  wseventPauseschedule,
+	"resumeschedule": wseventResumeschedule,
+	"delschedule":    wseventDelschedule,
 	// obsolete
 	//"updatecmd":   wseventUpdatecmd,
 }
@@ -10,12 +10,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
-	"regexp"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/hraban/lush/lushclient"
 )
 
 // parse URL, panic on error
@@ -53,23 +53,6 @@ func setDeadline(ws *websocket.Conn, d time.Duration) {
 	ws.SetWriteDeadline(time.Now().Add(d))
 }
 
-func performWebsocketHandshake(t *testing.T, ws *websocket.Conn) {
-	setDeadline(ws, 4*time.Second)
-	// Must be consumed if you want to use this connection
-	err := ws.WriteMessage(websocket.TextMessage, []byte(getWebsocketKey()))
-	if err != nil {
-		t.Fatalf("Error writing websocket key: %v", err)
-	}
-	msg := getTextMessage(t, ws)
-	if !regexp.MustCompile(`^clientid;[0-9]+$`).MatchString(msg) {
-		t.Errorf("Unexpected websocket handshake (clientid): %q", msg)
-	}
-	msg = getTextMessage(t, ws)
-	if !regexp.MustCompile(`^allclients;\[[0-9, ]*\]$`).MatchString(msg) {
-		t.Errorf("Unexpected websocket handshake (allclients): %q", msg)
-	}
-}
-
 func connectWebsocketNoHandshake(t *testing.T, server *httptest.Server, header http.Header) (*websocket.Conn, error) {
 	conn := connectToTestServer(t, server)
 	url := urlMustParse(server.URL)
@@ -82,22 +65,22 @@ func connectWebsocketNoHandshake(t *testing.T, server *httptest.Server, header h
 	return ws, nil
 }
 
-func connectWebsocket(t *testing.T, server *httptest.Server, header http.Header) (*websocket.Conn, error) {
-	ws, err := connectWebsocketNoHandshake(t, server, header)
+// connect a client, all errors are fatal
+func connectClient(t *testing.T, server *httptest.Server, opts *lushclient.Options) *lushclient.Conn {
+	c, err := lushclient.Dial(server.URL, opts)
 	if err != nil {
-		return nil, fmt.Errorf("raw websocket connection: %v", err)
+		t.Fatal("lush websocket connection:", err)
 	}
-	performWebsocketHandshake(t, ws)
-	return ws, nil
-}
-
-// no auth, all errors are fatal
-func connectWebsocketSimple(t *testing.T, server *httptest.Server) *websocket.Conn {
-	ws, err := connectWebsocket(t, server, nil)
+	c.SetDeadline(time.Now().Add(4 * time.Second))
+	// every new client is announced to all clients, including itself
+	e, err := c.Next()
 	if err != nil {
-		t.Fatal("lush websocket connection:", err)
+		t.Fatal("Error reading websocket message:", err)
 	}
-	return ws
+	if ac, ok := e.(*lushclient.AllClientsEvent); !ok || len(ac.Ids) == 0 {
+		t.Errorf("Unexpected websocket handshake (allclients): %#v", e)
+	}
+	return c
 }
 
 // Test websocket with live TCP connection
@@ -105,8 +88,8 @@ func TestWebsocket(t *testing.T) {
 	s := newServer()
 	ts := httptest.NewServer(s.httpHandler)
 	defer ts.Close()
-	ws := connectWebsocketSimple(t, ts)
-	defer ws.Close()
+	c := connectClient(t, ts, nil)
+	defer c.Close()
 }
 
 // Ensure access to websocket resource is denied w/o password
@@ -115,19 +98,13 @@ func TestWebsocketAuthentication(t *testing.T) {
 	s.SetPassword("test")
 	ts := httptest.NewServer(s.httpHandler)
 	defer ts.Close()
-	ws, err := connectWebsocket(t, ts, nil)
+	c, err := lushclient.Dial(ts.URL, nil)
 	if err == nil {
+		c.Close()
 		t.Error("Expected error when connecting without authentication")
 	}
-	// prehashed credentials: lush:test (net/http.Header does not support
-	// SetBasicAuth)
-	header := http.Header{}
-	header.Set("Authorization", "Basic bHVzaDp0ZXN0")
-	ws, err = connectWebsocket(t, ts, header)
-	if err != nil {
-		t.Fatal("Couldn't create authenticated websocket connection:", err)
-	}
-	defer ws.Close()
+	c = connectClient(t, ts, &lushclient.Options{Password: "test"})
+	defer c.Close()
 }
 
 func TestWebsocketNoKey(t *testing.T) {
@@ -165,3 +142,12 @@ func TestWebsocketWrongKey(t *testing.T) {
 		t.Errorf("Sent illegal key but reply looks like a command: %q", msg)
 	}
 }
+
+func TestWseventRerunBadId(t *testing.T) {
+	s := newServer()
+	for _, idstr := range []string{"", "x", "123"} {
+		if _, ok := wseventRerun(s, idstr).(lushError); !ok {
+			t.Errorf("Expected an error rerunning %q", idstr)
+		}
+	}
+}